@@ -0,0 +1,132 @@
+package bboltfs
+
+import (
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// Afero 返回实现 afero.Fs 的包装, 可以交给 Viper、Hugo、go-git 等使用 afero 的代码.
+// 返回值还实现了 afero.Lstater 和 afero.Symlinker (包括 afero.Linker 与 afero.LinkReader),
+// 以便 afero.Walk 等工具识别符号链接
+func (fs *BBolt) Afero() afero.Fs {
+	return aferoFs{fs: fs}
+}
+
+// aferoFs 转换路径和返回值的类型, File 的方法集已经覆盖了 afero.File
+type aferoFs struct {
+	fs *BBolt
+}
+
+var _ afero.Symlinker = aferoFs{}
+
+// key 将 afero 风格的路径 (常以 "/" 开头) 转换为 BBolt 使用的路径, 根目录为 ""
+func (a aferoFs) key(name string) string {
+	name = strings.TrimLeft(path.Clean(a.fs.separators(name)), "/")
+	if name == "." {
+		return ""
+	}
+	return name
+}
+
+// root 返回根目录的句柄, 根目录在数据库中没有对应的记录
+func (a aferoFs) root() afero.File {
+	return a.fs.track(&bboltDirFile{fs: a.fs, meta: fileMeta{Mode: os.ModeDir | 0755, IsDir: true}})
+}
+
+func (a aferoFs) Create(name string) (afero.File, error) {
+	return aferoFile(a.fs.Create(a.key(name)))
+}
+
+func (a aferoFs) Mkdir(name string, perm os.FileMode) error {
+	return a.fs.Mkdir(a.key(name), perm)
+}
+
+func (a aferoFs) MkdirAll(name string, perm os.FileMode) error {
+	key := a.key(name)
+	if key == "" {
+		return nil
+	}
+	return a.fs.MkdirAll(key, perm)
+}
+
+func (a aferoFs) Open(name string) (afero.File, error) {
+	key := a.key(name)
+	if key == "" {
+		return a.root(), nil
+	}
+	return aferoFile(a.fs.Open(key))
+}
+
+func (a aferoFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	key := a.key(name)
+	if key == "" && flag&(os.O_CREATE|os.O_RDWR|os.O_WRONLY|os.O_APPEND|os.O_TRUNC) == 0 {
+		return a.root(), nil
+	}
+	return aferoFile(a.fs.OpenFile(key, flag, perm))
+}
+
+func (a aferoFs) Remove(name string) error {
+	return a.fs.Remove(a.key(name))
+}
+
+func (a aferoFs) RemoveAll(name string) error {
+	return a.fs.RemoveAll(a.key(name))
+}
+
+func (a aferoFs) Rename(oldname, newname string) error {
+	return a.fs.Rename(a.key(oldname), a.key(newname))
+}
+
+func (a aferoFs) Stat(name string) (os.FileInfo, error) {
+	key := a.key(name)
+	if key == "" {
+		return rootInfo(), nil
+	}
+	return a.fs.Stat(key)
+}
+
+func (a aferoFs) Name() string {
+	return a.fs.Name()
+}
+
+func (a aferoFs) Chmod(name string, mode os.FileMode) error {
+	return a.fs.Chmod(a.key(name), mode)
+}
+
+func (a aferoFs) Chown(name string, uid, gid int) error {
+	return a.fs.Chown(a.key(name), uid, gid)
+}
+
+func (a aferoFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return a.fs.Chtimes(a.key(name), atime, mtime)
+}
+
+// LstatIfPossible 实现 afero.Lstater, 总是使用 Lstat
+func (a aferoFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	key := a.key(name)
+	if key == "" {
+		return rootInfo(), true, nil
+	}
+	fi, err := a.fs.Lstat(key)
+	return fi, true, err
+}
+
+func (a aferoFs) SymlinkIfPossible(oldname, newname string) error {
+	return a.fs.Symlink(oldname, a.key(newname))
+}
+
+func (a aferoFs) ReadlinkIfPossible(name string) (string, error) {
+	return a.fs.Readlink(a.key(name))
+}
+
+// aferoFile 将 File 转换为 afero.File, 出错时返回 nil 接口而不是包含 nil 指针的接口
+func aferoFile(f File, err error) (afero.File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,104 @@
+package bboltfs
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestBBoltFs_Afero(t *testing.T) {
+	fs := newTestFs(t)
+	_ = fs.Mkdir("conf", 0755)
+	if err := fs.WriteString("conf/app.yaml", "port: 8080\n", 0644); err != nil {
+		t.Fatal(err)
+	}
+	ro := afero.NewReadOnlyFs(fs.Afero())
+	data, err := afero.ReadFile(ro, "conf/app.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "port: 8080\n" {
+		t.Errorf("ReadFile = %q", data)
+	}
+	if err = afero.WriteFile(ro, "conf/app.yaml", []byte("x"), 0644); err == nil {
+		t.Error("WriteFile through ReadOnlyFs succeeded")
+	}
+	if _, err = ro.Open("missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Open(missing) = %v, want ErrNotExist", err)
+	}
+
+	// 写入通过包装落到 BBolt 上
+	afs := fs.Afero()
+	if err = afero.WriteFile(afs, "conf/extra.yaml", []byte("debug: true\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, fs, "conf/extra.yaml"); got != "debug: true\n" {
+		t.Errorf("content = %q", got)
+	}
+	names, err := afero.ReadDir(afs, "conf")
+	if err != nil || len(names) != 2 {
+		t.Errorf("ReadDir = %v, %v", names, err)
+	}
+
+	// 可选接口
+	linker, ok := afs.(afero.Symlinker)
+	if !ok {
+		t.Fatal("Afero() does not implement afero.Symlinker")
+	}
+	if err = linker.SymlinkIfPossible("conf/app.yaml", "app.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	if target, err := linker.ReadlinkIfPossible("app.yaml"); err != nil || target != "conf/app.yaml" {
+		t.Errorf("ReadlinkIfPossible = %q, %v", target, err)
+	}
+	fi, lstat, err := linker.LstatIfPossible("app.yaml")
+	if err != nil || !lstat || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("LstatIfPossible = %v, %v, %v", fi, lstat, err)
+	}
+}
+
+func TestBBoltFs_AferoAbsolutePaths(t *testing.T) {
+	fs := newTestFs(t)
+	afs := fs.Afero()
+	if err := afs.MkdirAll("/cfg/sub", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(afs, "/cfg/x", []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(afs, "/cfg/sub/../sub/y", []byte("y"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// 绝对路径与相对路径落到同一个 key 上
+	if got := readAll(t, fs, "cfg/x"); got != "x" {
+		t.Errorf("cfg/x = %q", got)
+	}
+	if fi, err := afs.Stat("/cfg"); err != nil || !fi.IsDir() {
+		t.Errorf("Stat(/cfg) = %v, %v", fi, err)
+	}
+
+	var walked []string
+	err := afero.Walk(afs, "/", func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		walked = append(walked, p)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/", "/cfg", "/cfg/sub", "/cfg/sub/y", "/cfg/x"}
+	if !reflect.DeepEqual(walked, want) {
+		t.Errorf("Walk = %v, want %v", walked, want)
+	}
+	if err = afs.RemoveAll("/cfg"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = fs.Stat("cfg/x"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat(cfg/x) after RemoveAll = %v", err)
+	}
+}
@@ -2,13 +2,21 @@ package bboltfs
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"go.etcd.io/bbolt"
@@ -24,6 +32,7 @@ type File interface {
 	io.WriterAt
 
 	Name() string
+	ReadDir(n int) ([]os.DirEntry, error)
 	Readdir(count int) ([]os.FileInfo, error)
 	Readdirnames(n int) ([]string, error)
 	Stat() (os.FileInfo, error)
@@ -58,6 +67,10 @@ type Fs interface {
 	// happens.
 	Remove(name string) error
 
+	// ReadDir reads the named directory, returning its entries sorted by
+	// filename.
+	ReadDir(name string) ([]os.DirEntry, error)
+
 	// RemoveAll removes a directory path and any children it contains. It
 	// does not fail if the path does not exist (return nil).
 	RemoveAll(path string) error
@@ -81,97 +94,557 @@ type Fs interface {
 	// Chtimes changes the access and modification times of the named file
 	Chtimes(name string, atime time.Time, mtime time.Time) error
 
+	// Truncate changes the size of the named file.
+	Truncate(name string, size int64) error
+
 	// Close the FileSystem
 	Close() error
 }
 
+var (
+	_ Fs   = (*BBolt)(nil)
+	_ File = (*bboltFile)(nil)
+	_ File = (*bboltDirFile)(nil)
+)
+
 var (
 	ErrFileNotFound      = os.ErrNotExist
 	ErrFileExists        = os.ErrExist
 	ErrDestinationExists = os.ErrExist
+	ErrReadOnlyMedium    = errors.New("bboltfs: database is on a read-only medium")
+	ErrIsDirectory       = errors.New("bboltfs: is a directory")
+	ErrNotDirectory      = errors.New("bboltfs: not a directory")
+	ErrPathTooDeep       = errors.New("bboltfs: path too deep")
+	ErrDirNotEmpty       = errors.New("bboltfs: directory not empty")
+	ErrNotEmpty          = ErrDirNotEmpty
+
+	// 以下错误替代 bbolt 对应的错误返回给调用方
+	ErrClosed   = errors.New("bboltfs: filesystem is closed")
+	ErrLocked   = errors.New("bboltfs: database is locked by another process")
+	ErrReadOnly = errors.New("bboltfs: filesystem is read-only")
 )
 
+// translateErr 将 bbolt 的错误转换为本包的错误, 调用方无需依赖 bbolt
+func translateErr(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, bbolt.ErrDatabaseNotOpen):
+		return ErrClosed
+	case errors.Is(err, bbolt.ErrTimeout):
+		return ErrLocked
+	case errors.Is(err, bbolt.ErrDatabaseReadOnly), errors.Is(err, bbolt.ErrTxNotWritable):
+		return ErrReadOnly
+	}
+	return err
+}
+
 const (
-	bucketFiles = "files" // 存储文件
-	bucketDirs  = "dirs"  // 存储目录
+	bucketFiles  = "files"  // 存储文件
+	bucketDirs   = "dirs"   // 存储目录
+	bucketIndex  = "index"  // 目录到子项的索引
+	bucketChunks = "chunks" // 分块存储的文件内容
+
+	removeBatchSize = 10000 // RemoveAll 单个事务最多删除的 key 数量
 )
 
 // BBolt 文件系统实现
 type BBolt struct {
-	db   *bbolt.DB
-	name string
+	db        *bbolt.DB
+	dbMu      sync.RWMutex // Compact 替换 db 时持有写锁, 其他事务持有读锁
+	dbErr     error        // Compact 或 Relocate 之后无法重新打开数据库时的错误, 之后的所有操作都返回它
+	name      string
+	batchSize int
+
+	readOnly      bool
+	backslash     bool
+	syncOnClose   bool
+	syncOnCreate  bool
+	exclCreate    bool // 所有创建文件的途径都按 O_EXCL 处理
+	lazyRead      bool // Open 时不读取文件内容
+	strictDirRead bool
+	readableMeta  bool // 以 JSON 格式写入元数据
+
+	caseInsensitive bool // 路径不区分大小写, key 统一转换为小写
+	flat            bool // 不保存目录, 目录由文件路径推导
+	creationOrder   bool // 目录列表按创建顺序排列
+
+	maxPathDepth int // 路径最多包含的层数, <=0 表示不限制
+	maxFiles     int // 最多允许的文件数, <=0 表示不限制
+
+	spillThreshold int // 缓冲句柄在内存中保存的内容超过该大小时写入数据库并释放, <=0 表示不限制
+	writeBuffer    int // 普通句柄积累多少字节的修改后写入数据库, 0 表示每次修改都立即写入
+
+	inlineThreshold int // 不小于该大小的文件使用分块存储, <=0 表示全部内联
+	chunkSize       int
+
+	opTimeout   time.Duration
+	lockTimeout time.Duration // 等待其他进程释放数据库文件锁的时间, 0 表示一直等待
+	updateHook  func()        // 每个写事务开始时调用, 用于在测试中模拟慢速磁盘
+
+	saves atomic.Int64 // saveFile 写入次数
+
+	statCache  *statCache
+	ioStats    *ioStats
+	txPool     *txPool
+	txPoolSize int
+
+	handlesMu sync.Mutex
+	handles   map[File]string // 尚未关闭的句柄及其路径
+
+	sharedMu sync.Mutex
+	shared   map[string]*sharedFile // OpenShared 打开的共享内容
+
+	journal   io.Writer
+	journalMu sync.Mutex
+	changeLog bool
+	pending   [][]byte // 当前写事务中记录的日志, 提交后由 update 写入 journal; 只在写事务中访问
+
+	maintenance *MaintenanceConfig
+	maintainer  *maintainer
 }
 
-func New(path string) (Fs, error) {
-	bolt, err := bbolt.Open(path, os.ModePerm, &bbolt.Options{})
+func New(path string, opts ...Option) (Fs, error) {
+	fs := &BBolt{name: path, batchSize: removeBatchSize, chunkSize: defaultChunkSize}
+	for _, opt := range opts {
+		opt(fs)
+	}
+
+	bolt, err := fs.openDB(path)
+	if err != nil {
+		return nil, translateErr(err)
+	}
+
+	if fs.readOnly {
+		// 只读模式下无法创建 bucket, 只能检查它们是否存在
+		err = bolt.View(func(tx *bbolt.Tx) error {
+			if err := checkFormat(detectFormat(tx)); err != nil {
+				return err
+			}
+			for _, name := range []string{bucketFiles, bucketDirs, bucketIndex, bucketChunks} {
+				if tx.Bucket([]byte(name)) == nil {
+					return fmt.Errorf("%w: %s is not initialized", ErrReadOnlyMedium, path)
+				}
+			}
+			return nil
+		})
+	} else {
+		err = bolt.Update(func(tx *bbolt.Tx) error {
+			version := detectFormat(tx)
+			if err := checkFormat(version); err != nil {
+				return err
+			}
+			if _, e := tx.CreateBucketIfNotExists([]byte(bucketFiles)); e != nil {
+				return e
+			}
+			if _, e := tx.CreateBucketIfNotExists([]byte(bucketDirs)); e != nil {
+				return e
+			}
+			if _, e := tx.CreateBucketIfNotExists([]byte(bucketChunks)); e != nil {
+				return e
+			}
+			if _, e := tx.CreateBucketIfNotExists([]byte(bucketXattrs)); e != nil {
+				return e
+			}
+			if fs.changeLog {
+				if _, e := tx.CreateBucketIfNotExists([]byte(bucketChanges)); e != nil {
+					return e
+				}
+			}
+			if _, e := tx.CreateBucketIfNotExists([]byte(bucketIndex)); e != nil {
+				return e
+			}
+			// 旧版本数据库在首次打开时升级, 如生成目录索引
+			if e := fs.migrate(tx, version); e != nil {
+				return e
+			}
+			if fs.maxFiles > 0 {
+				if e := countFiles(tx); e != nil {
+					return e
+				}
+			}
+			if fs.creationOrder {
+				return ensureOrder(tx)
+			}
+			return nil
+		})
+	}
 	if err != nil {
+		_ = bolt.Close()
 		return nil, err
 	}
+	fs.setDB(bolt)
+	if fs.maintenance != nil && !fs.readOnly {
+		fs.maintainer = fs.startMaintenance(*fs.maintenance)
+	}
+	return fs, nil
+}
+
+// boltOpen 打开 bbolt 数据库, 测试中可替换以模拟只读介质
+var boltOpen = bbolt.Open
+
+// openDB 打开数据库文件, 若文件位于只读介质上则自动退回只读模式
+func (fs *BBolt) openDB(path string) (*bbolt.DB, error) {
+	bolt, err := boltOpen(path, os.ModePerm, &bbolt.Options{ReadOnly: fs.readOnly, Timeout: fs.lockTimeout})
+	if err == nil || fs.readOnly || !isReadOnlyMedium(err) {
+		return bolt, err
+	}
+	bolt, roErr := boltOpen(path, os.ModePerm, &bbolt.Options{ReadOnly: true, Timeout: fs.lockTimeout})
+	if roErr != nil {
+		return nil, fmt.Errorf("%w: %v", ErrReadOnlyMedium, err)
+	}
+	fs.readOnly = true
+	return bolt, nil
+}
+
+func isReadOnlyMedium(err error) bool {
+	return errors.Is(err, syscall.EROFS) || errors.Is(err, os.ErrPermission)
+}
 
-	err = bolt.Update(func(tx *bbolt.Tx) error {
-		if _, e := tx.CreateBucketIfNotExists([]byte(bucketFiles)); e != nil {
-			return e
+// ReadOnly 返回文件系统是否以只读模式打开
+func (fs *BBolt) ReadOnly() bool { return fs.readOnly }
+
+// update 执行一个写事务. 设置了 WithOpTimeout 时, 事务在独立的 goroutine 中运行,
+// 超时后立即返回 context.DeadlineExceeded; bbolt 事务无法被强制取消, 它仍会在后台提交或回滚
+func (fs *BBolt) update(fn func(tx *bbolt.Tx) error) error {
+	run := func() error {
+		// 写事务结束后 (无论成功与否) 使缓存失效
+		defer fs.statCache.clear()
+		// Compact 和 Relocate 在 dbMu 的写锁下替换 db 和 txPool, 读取它们之前先持有读锁
+		fs.dbMu.RLock()
+		defer fs.dbMu.RUnlock()
+		if fs.dbErr != nil {
+			return fs.dbErr
+		}
+		if fs.txPool != nil {
+			// 缓存的只读事务会阻塞 bbolt 扩容时的重新映射, 写入前先关闭; 提交后再关闭一次丢弃旧快照
+			fs.txPool.beginWrite()
+			defer fs.txPool.endWrite()
 		}
-		if _, e := tx.CreateBucketIfNotExists([]byte(bucketDirs)); e != nil {
-			return e
+		var lines [][]byte
+		err := fs.db.Update(func(tx *bbolt.Tx) error {
+			if fs.updateHook != nil {
+				fs.updateHook()
+			}
+			fs.pending = nil
+			if err := fn(tx); err != nil {
+				return err
+			}
+			lines = fs.pending
+			return nil
+		})
+		if err != nil {
+			return err
 		}
+		return fs.writeJournal(lines)
+	}
+	if fs.opTimeout <= 0 {
+		return translateErr(run())
+	}
+	done := make(chan error, 1)
+	go func() { done <- run() }()
+	timer := time.NewTimer(fs.opTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return translateErr(err)
+	case <-timer.C:
+		return context.DeadlineExceeded
+	}
+}
+
+// checkDepth 在设置了 WithMaxPathDepth 时检查路径的层数
+func (fs *BBolt) checkDepth(name string) error {
+	if fs.maxPathDepth <= 0 {
 		return nil
-	})
-	if err != nil {
-		return nil, err
 	}
-	return &BBolt{db: bolt, name: path}, nil
+	depth := 0
+	for _, part := range strings.Split(name, "/") {
+		if part != "" {
+			depth++
+		}
+	}
+	if depth > fs.maxPathDepth {
+		return fmt.Errorf("%w: %s", ErrPathTooDeep, name)
+	}
+	return nil
 }
 
-func (fs *BBolt) saveFile(name string, data []byte, meta fileMeta) error {
-	return fs.db.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(bucketFiles))
-		key := []byte(name)
-		val := append(fs.encodeMeta(meta), data...)
-		return b.Put(key, val)
+// normalize 将调用方传入的路径转换为存储使用的形式
+func (fs *BBolt) normalize(name string) string {
+	name = fs.separators(name)
+	if fs.caseInsensitive {
+		name = strings.ToLower(name)
+	}
+	return name
+}
+
+func (fs *BBolt) saveFile(name string, data []byte, meta fileMeta, recs ...JournalRecord) error {
+	return fs.putFile(name, data, meta, true, recs...)
+}
+
+// putFile 写入文件内容和元数据. bump 为 true 时从 files bucket 的序列号分配新的内容版本号,
+// 版本号全局递增, 删除后重建的文件也不会与之前的版本重复; 只修改元数据时保持版本号不变
+func (fs *BBolt) putFile(name string, data []byte, meta fileMeta, bump bool, recs ...JournalRecord) error {
+	return fs.update(func(tx *bbolt.Tx) error {
+		if err := fs.putFileTx(tx, name, data, meta, bump); err != nil {
+			return err
+		}
+		return fs.recordTx(tx, recs...)
 	})
 }
 
+// putFileTx 在事务 tx 中完成 putFile 的写入
+func (fs *BBolt) putFileTx(tx *bbolt.Tx, name string, data []byte, meta fileMeta, bump bool) error {
+	b := tx.Bucket([]byte(bucketFiles))
+	key := []byte(name)
+	// 同一路径不能同时是文件和目录
+	if tx.Bucket([]byte(bucketDirs)).Get(key) != nil {
+		return ErrFileExists
+	}
+	var old *fileMeta
+	meta.Version = 0
+	if v := b.Get(key); v != nil {
+		m := fs.decodeMeta(v)
+		old = &m
+		// 属主只由 Chown 修改, 句柄中的旧元数据不会覆盖它
+		meta.Version, meta.Seq, meta.Uid, meta.Gid = m.Version, m.Seq, m.Uid, m.Gid
+	} else if err := fs.checkDepth(name); err != nil {
+		return err
+	} else if err = fs.addFiles(tx, 1); err != nil {
+		return err
+	} else if meta.Seq, err = b.NextSequence(); err != nil {
+		return err
+	}
+	if bump {
+		var err error
+		if meta.Version, err = b.NextSequence(); err != nil {
+			return err
+		}
+	}
+	val, err := fs.encodeFile(tx, old, meta, data)
+	if err != nil {
+		return err
+	}
+	if err = b.Put(key, val); err != nil {
+		return err
+	}
+	fs.saves.Add(1)
+	if old == nil {
+		if err = fs.touchParent(tx, name); err != nil {
+			return err
+		}
+	}
+	return indexPut(tx, name, false)
+}
+
 func (fs *BBolt) loadFile(name string) ([]byte, fileMeta, error) {
 	var data []byte
 	var meta fileMeta
-	err := fs.db.View(func(tx *bbolt.Tx) error {
+	err := fs.view(func(tx *bbolt.Tx) error {
 		b := tx.Bucket([]byte(bucketFiles))
 		val := b.Get([]byte(name))
 		if val == nil {
 			return ErrFileNotFound
 		}
-		meta = fs.decodeMeta(val)
-		data = val[fs.metaLen():]
-		return nil
+		var err error
+		meta, data, err = fs.fileContent(tx, val)
+		return err
 	})
 	return data, meta, err
 }
 
-func (fs *BBolt) saveDir(name string, meta fileMeta) error {
-	return fs.db.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(bucketDirs))
-		return b.Put([]byte(name), fs.encodeMeta(meta))
+// loadMeta 只解码文件或目录 name 的元数据头部, 不复制文件内容, 开销与文件大小无关
+func (fs *BBolt) loadMeta(name string) (fileMeta, error) {
+	var meta fileMeta
+	err := fs.view(func(tx *bbolt.Tx) error {
+		val := tx.Bucket([]byte(bucketFiles)).Get([]byte(name))
+		if val == nil {
+			val = tx.Bucket([]byte(bucketDirs)).Get([]byte(name))
+		}
+		if val == nil {
+			return ErrFileNotFound
+		}
+		meta = fs.decodeMeta(val)
+		return nil
 	})
+	return meta, err
+}
+
+// saveDirTx 在事务 tx 中写入目录 name 的元数据, 新建的目录同时更新父目录的修改时间和索引
+func (fs *BBolt) saveDirTx(tx *bbolt.Tx, name string, meta fileMeta) error {
+	b := tx.Bucket([]byte(bucketDirs))
+	if tx.Bucket([]byte(bucketFiles)).Get([]byte(name)) != nil {
+		return ErrFileExists
+	}
+	if err := fs.checkDepth(name); err != nil {
+		return err
+	}
+	if v := b.Get([]byte(name)); v != nil {
+		old := fs.decodeMeta(v)
+		meta.Seq, meta.Uid, meta.Gid = old.Seq, old.Uid, old.Gid
+	} else {
+		if err := fs.touchParent(tx, name); err != nil {
+			return err
+		}
+		var err error
+		if meta.Seq, err = tx.Bucket([]byte(bucketFiles)).NextSequence(); err != nil {
+			return err
+		}
+	}
+	if err := b.Put([]byte(name), fs.encodeMeta(meta)); err != nil {
+		return err
+	}
+	return indexPut(tx, name, true)
 }
 
 func (fs *BBolt) Create(name string) (File, error) {
+	raw := name
+	name = fs.normalize(name)
 	now := time.Now().UnixNano()
 	meta := fileMeta{Mode: 0666, Size: 0, ModTime: now, IsDir: false}
 	buf := &bytes.Buffer{}
-	if err := fs.saveFile(name, buf.Bytes(), meta); err != nil {
+	name, err := fs.createFile(name, raw, buf.Bytes(), meta, false, JournalRecord{Op: OpCreate})
+	if err != nil {
 		return nil, err
 	}
-	return &bboltFile{fs: fs, name: name, meta: meta, buffer: buf}, nil
+	return fs.track(&bboltFile{fs: fs, name: name, meta: meta, buffer: buf, bufSize: fs.writeBuffer}), nil
+}
+
+// CreatePos 是 CreateWith 返回的句柄的初始位置
+type CreatePos int
+
+const (
+	CreateAtEnd   CreatePos = iota // 位置在文件末尾, 后续写入追加到内容之后
+	CreateAtStart                  // 位置在文件开头, 可以直接读出内容或从头覆盖
+)
+
+// CreateWith 在一个事务中创建内容为 content、权限为 perm 的文件.
+// 返回的句柄位置默认在文件末尾, 传入 CreateAtStart 时在文件开头
+func (fs *BBolt) CreateWith(name string, content []byte, perm os.FileMode, pos ...CreatePos) (File, error) {
+	raw := name
+	name = fs.normalize(name)
+	meta := fileMeta{Mode: perm, Size: int64(len(content)), ModTime: time.Now().UnixNano(), IsDir: false}
+	buf := bytes.NewBuffer(append([]byte(nil), content...))
+	recs := []JournalRecord{{Op: OpCreate, Mode: perm}}
+	if len(content) > 0 {
+		recs = append(recs, JournalRecord{Op: OpWrite, Data: content, Size: meta.Size})
+	}
+	name, err := fs.createFile(name, raw, buf.Bytes(), meta, false, recs...)
+	if err != nil {
+		return nil, err
+	}
+	offset := meta.Size
+	if len(pos) > 0 && pos[0] == CreateAtStart {
+		offset = 0
+	}
+	return fs.track(&bboltFile{fs: fs, name: name, meta: meta, buffer: buf, offset: offset, bufSize: fs.writeBuffer}), nil
+}
+
+// createFile 在一个事务中写入新文件、父目录的修改时间和索引以及原始大小写.
+// excl 的含义见 checkCreate. 开启 WithSyncOnCreate 时提交后再同步一次数据库, 返回即表示这些修改已一起落盘.
+// 与 os.Create 一样, 非 excl 时跟随 name 上的符号链接写入链接的目标, 返回实际写入的 key.
+// recs 的 Path 设置为实际写入的 key 后在同一个事务中记录
+func (fs *BBolt) createFile(name, raw string, data []byte, meta fileMeta, excl bool, recs ...JournalRecord) (string, error) {
+	err := fs.update(func(tx *bbolt.Tx) error {
+		if !excl {
+			var err error
+			if name, raw, err = fs.writeTargetTx(tx, name, raw); err != nil {
+				return err
+			}
+		}
+		if err := fs.checkCreate(tx, name, excl); err != nil {
+			return err
+		}
+		if err := fs.putFileTx(tx, name, data, meta, true); err != nil {
+			return err
+		}
+		if err := fs.keepCaseTx(tx, name, raw); err != nil {
+			return err
+		}
+		for i := range recs {
+			recs[i].Path = name
+		}
+		return fs.recordTx(tx, recs...)
+	})
+	if err != nil || !fs.syncOnCreate {
+		return name, err
+	}
+	fs.dbMu.RLock()
+	defer fs.dbMu.RUnlock()
+	return name, fs.db.Sync()
+}
+
+// checkCreate 在事务 tx 中创建文件 name 之前调用. excl 为 true 或开启了 WithExclusiveCreate 时,
+// name 已存在则返回 ErrFileExists; 检查与创建在同一个事务中完成, 保证 O_EXCL 不会被绕过
+func (fs *BBolt) checkCreate(tx *bbolt.Tx, name string, excl bool) error {
+	if (excl || fs.exclCreate) && tx.Bucket([]byte(bucketFiles)).Get([]byte(name)) != nil {
+		return ErrFileExists
+	}
+	return nil
 }
 
 func (fs *BBolt) Mkdir(name string, perm os.FileMode) error {
+	if fs.flat {
+		return nil
+	}
+	raw := name
+	name = fs.normalize(name)
 	now := time.Now().UnixNano()
 	meta := fileMeta{Mode: perm | os.ModeDir, Size: 0, ModTime: now, IsDir: true}
-	return fs.saveDir(name, meta)
+	return fs.update(func(tx *bbolt.Tx) error {
+		if err := fs.saveDirTx(tx, name, meta); err != nil {
+			return err
+		}
+		if err := fs.keepCaseTx(tx, name, raw); err != nil {
+			return err
+		}
+		return fs.recordTx(tx, JournalRecord{Op: OpMkdir, Path: name, Mode: perm})
+	})
+}
+
+// MkdirIfNotExist 在一个事务中创建目录 name, 返回是否新建. 目录已存在时返回 false 和 nil,
+// 同名文件已存在时返回 ErrFileExists
+func (fs *BBolt) MkdirIfNotExist(name string, perm os.FileMode) (bool, error) {
+	if fs.flat {
+		return false, nil
+	}
+	name = fs.normalize(name)
+	var created bool
+	err := fs.update(func(tx *bbolt.Tx) error {
+		if tx.Bucket([]byte(bucketFiles)).Get([]byte(name)) != nil {
+			return ErrFileExists
+		}
+		b := tx.Bucket([]byte(bucketDirs))
+		if b.Get([]byte(name)) != nil {
+			return nil
+		}
+		if err := fs.checkDepth(name); err != nil {
+			return err
+		}
+		seq, err := tx.Bucket([]byte(bucketFiles)).NextSequence()
+		if err != nil {
+			return err
+		}
+		meta := fileMeta{Mode: perm | os.ModeDir, ModTime: time.Now().UnixNano(), IsDir: true, Seq: seq}
+		if err := b.Put([]byte(name), fs.encodeMeta(meta)); err != nil {
+			return err
+		}
+		created = true
+		if err := fs.touchParent(tx, name); err != nil {
+			return err
+		}
+		if err := indexPut(tx, name, true); err != nil {
+			return err
+		}
+		return fs.recordTx(tx, JournalRecord{Op: OpMkdir, Path: name, Mode: perm})
+	})
+	return created && err == nil, err
 }
 
 func (fs *BBolt) MkdirAll(p string, perm os.FileMode) error {
+	// 由 Mkdir 统一转换大小写, 以便记录每一层的原始名称
+	p = fs.separators(p)
 	dirs := strings.Split(filepath.Clean(p), string(os.PathSeparator))
 	dir := ""
 	for _, d := range dirs {
@@ -188,187 +661,1163 @@ func (fs *BBolt) MkdirAll(p string, perm os.FileMode) error {
 }
 
 func (fs *BBolt) Open(name string) (File, error) {
-	data, meta, err := fs.loadFile(name)
-	if err == nil {
-		return &bboltFile{fs: fs, name: name, meta: meta, buffer: bytes.NewBuffer(data)}, nil
+	name = fs.normalize(name)
+	var f File
+	err := fs.view(func(tx *bbolt.Tx) error {
+		name, err := fs.resolveTx(tx, name, true)
+		if err != nil {
+			return err
+		}
+		f, err = fs.openTx(tx, name)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	// 如果不是文件，尝试打开目录
-	var dmeta fileMeta
-	dirErr := fs.db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(bucketDirs))
-		val := b.Get([]byte(name))
-		if val == nil {
-			return ErrFileNotFound
+	return fs.track(f), nil
+}
+
+// openDir 打开目录, name 是文件时返回 ErrNotDirectory
+func (fs *BBolt) openDir(name string) (File, error) {
+	var f File
+	err := fs.view(func(tx *bbolt.Tx) error {
+		if tx.Bucket([]byte(bucketFiles)).Get([]byte(name)) != nil {
+			return ErrNotDirectory
 		}
-		dmeta = fs.decodeMeta(val)
-		return nil
+		var err error
+		f, err = fs.openTx(tx, name)
+		return err
 	})
-	if dirErr == nil {
-		return &bboltDirFile{fs: fs, name: name, meta: dmeta}, nil
+	if err != nil {
+		return nil, err
 	}
-	return nil, ErrFileNotFound
+	return fs.track(f), nil
 }
 
-func (fs *BBolt) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
-	if flag&(os.O_CREATE|os.O_RDWR|os.O_WRONLY) != 0 {
-		return fs.Create(name)
+// openTx 在事务 tx 中读出文件内容或目录元信息, 返回尚未登记的句柄
+func (fs *BBolt) openTx(tx *bbolt.Tx, name string) (File, error) {
+	if val := tx.Bucket([]byte(bucketFiles)).Get([]byte(name)); val != nil {
+		if meta := fs.decodeMeta(val); fs.lazyRead || meta.Storage == storageChunked {
+			// 内容视为已写入数据库的部分, 读取时只访问涉及的分块, 覆盖写入等需要整个内容时由 unspill 读入.
+			// 分块存储的文件总是这样打开, 读取稀疏文件不会分配整个逻辑大小的内存
+			return &bboltFile{fs: fs, name: name, meta: meta, buffer: new(bytes.Buffer), base: meta.Size, bufSize: fs.writeBuffer}, nil
+		}
+		meta, data, err := fs.fileContent(tx, val)
+		if err != nil {
+			return nil, err
+		}
+		return &bboltFile{fs: fs, name: name, meta: meta, buffer: bytes.NewBuffer(data), bufSize: fs.writeBuffer}, nil
 	}
-	return fs.Open(name)
+	// 如果不是文件，尝试打开目录
+	val := tx.Bucket([]byte(bucketDirs)).Get([]byte(name))
+	if val == nil && fs.flat && isPseudoDir(tx, name) {
+		return &bboltDirFile{fs: fs, name: name, meta: fileMeta{Mode: pseudoDirMode, IsDir: true}}, nil
+	}
+	if val == nil {
+		return nil, ErrFileNotFound
+	}
+	return &bboltDirFile{fs: fs, name: name, meta: fs.decodeMeta(val)}, nil
 }
 
-func (fs *BBolt) Remove(name string) error {
-	return fs.db.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(bucketFiles))
-		return b.Delete([]byte(name))
+// NewSectionReader 返回读取文件 [off, off+n) 范围内容的 io.SectionReader. 每次读取只访问涉及的分块,
+// 不会将整个文件读入内存, 空洞读作 0
+func (fs *BBolt) NewSectionReader(name string, off, n int64) (*io.SectionReader, error) {
+	name = fs.normalize(name)
+	err := fs.view(func(tx *bbolt.Tx) error {
+		if tx.Bucket([]byte(bucketFiles)).Get([]byte(name)) != nil {
+			return nil
+		}
+		if exists(tx, name) {
+			return ErrIsDirectory
+		}
+		return ErrFileNotFound
 	})
+	if err != nil {
+		return nil, err
+	}
+	return io.NewSectionReader(&rangeReader{fs: fs, name: name}, off, n), nil
 }
 
-func (fs *BBolt) RemoveAll(p string) error {
-	// 递归删除子文件
-	err := fs.db.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(bucketFiles))
-		c := b.Cursor()
-		prefix := []byte(p)
-		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
-			if err := b.Delete(k); err != nil {
-				return err
+// ReadFileInto 将文件的完整内容读入调用方提供的 buf, 返回文件大小. buf 不足以容纳内容时
+// 不读取任何数据, 返回所需的大小和 io.ErrShortBuffer, 调用方可以据此从 sync.Pool 中复用缓冲区
+func (fs *BBolt) ReadFileInto(name string, buf []byte) (int, error) {
+	name = fs.normalize(name)
+	var n int
+	err := fs.view(func(tx *bbolt.Tx) error {
+		val := tx.Bucket([]byte(bucketFiles)).Get([]byte(name))
+		if val == nil {
+			if tx.Bucket([]byte(bucketDirs)).Get([]byte(name)) != nil {
+				return ErrIsDirectory
 			}
+			return ErrFileNotFound
+		}
+		meta, inline := fs.splitMeta(val)
+		n = int(meta.Size)
+		if len(buf) < n {
+			return io.ErrShortBuffer
 		}
+		fs.readAt(tx, meta, inline, buf[:n], 0)
 		return nil
 	})
-	if err != nil {
-		return err
+	if err == nil {
+		fs.ioStats.add(name, n, 0)
 	}
-	// 删除目录元数据
-	return fs.db.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(bucketDirs))
-		return b.Delete([]byte(p))
-	})
+	return n, err
 }
 
-func (fs *BBolt) Rename(oldname, newname string) error {
-	data, meta, err := fs.loadFile(oldname)
-	if err != nil {
+// ReadString 在一个读事务中返回文件的完整内容, 适合读取配置等文本文件
+func (fs *BBolt) ReadString(name string) (string, error) {
+	name = fs.normalize(name)
+	var s string
+	err := fs.view(func(tx *bbolt.Tx) error {
+		name, err := fs.resolveTx(tx, name, true)
+		if err != nil {
+			return err
+		}
+		val := tx.Bucket([]byte(bucketFiles)).Get([]byte(name))
+		if val == nil {
+			if tx.Bucket([]byte(bucketDirs)).Get([]byte(name)) != nil {
+				return ErrIsDirectory
+			}
+			return ErrFileNotFound
+		}
+		_, data, err := fs.fileContent(tx, val)
+		s = string(data)
 		return err
+	})
+	if err == nil {
+		fs.ioStats.add(name, len(s), 0)
 	}
-	if err = fs.saveFile(newname, data, meta); err != nil {
+	return s, err
+}
+
+// WriteString 在一个事务中将文件 name 的内容替换为 s (不存在时以权限 perm 创建)
+func (fs *BBolt) WriteString(name, s string, perm os.FileMode) error {
+	f, err := fs.CreateWith(name, []byte(s), perm)
+	if err != nil {
 		return err
 	}
-	return fs.Remove(oldname)
+	return f.Close()
 }
 
-func (fs *BBolt) Stat(name string) (os.FileInfo, error) {
-	_, meta, err := fs.loadFile(name)
+// OpenBuffered 打开文件用于写入 (不存在时创建), 位置在文件末尾, 返回的句柄在内存中积累修改,
+// 缓冲超过 bufSize 字节或调用 Sync/Close 时才写入数据库, 适合频繁的小块追加.
+// 返回的句柄实现 Checksummer
+func (fs *BBolt) OpenBuffered(name string, bufSize int) (File, error) {
+	// 与 OpenFile 一样跟随符号链接写入链接的目标
+	name, err := fs.resolve(fs.normalize(name), false)
 	if err != nil {
-		// 尝试作为目录
-		var dmeta fileMeta
-		errDir := fs.db.View(func(tx *bbolt.Tx) error {
-			b := tx.Bucket([]byte(bucketDirs))
-			val := b.Get([]byte(name))
-			if val == nil {
-				return ErrFileNotFound
-			}
-			dmeta = fs.decodeMeta(val)
-			return nil
-		})
-		if errDir != nil {
+		return nil, err
+	}
+	data, meta, err := fs.loadFile(name)
+	if errors.Is(err, ErrFileNotFound) {
+		f, err := fs.Create(name)
+		if err != nil {
 			return nil, err
 		}
-		return &fileInfo{
-			name:    filepath.Base(name),
-			size:    0,
-			mode:    dmeta.Mode,
-			modTime: time.Unix(0, dmeta.ModTime),
-			isDir:   true,
-		}, nil
+		bf := f.(*bboltFile)
+		bf.bufSize, bf.hash = bufSize, sha256.New()
+		return f, nil
 	}
-	return &fileInfo{
-		name:    filepath.Base(name),
-		size:    meta.Size,
-		mode:    meta.Mode,
-		modTime: time.Unix(0, meta.ModTime),
-		isDir:   meta.IsDir,
-	}, nil
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	h.Write(data)
+	return fs.track(&bboltFile{fs: fs, name: name, meta: meta, buffer: bytes.NewBuffer(data), offset: meta.Size, bufSize: bufSize, hash: h}), nil
 }
 
-func (fs *BBolt) Name() string { return fs.name }
+// O_DIRECTORY 可与 os.O_RDONLY 等标志组合传给 OpenFile, 行为同 Linux 的 O_DIRECTORY:
+// 目标不是目录时返回 ErrNotDirectory. 取值避开了 os 包的所有打开标志
+const O_DIRECTORY = 1 << 30
 
-func (fs *BBolt) Chmod(name string, mode os.FileMode) error {
-	data, meta, err := fs.loadFile(name)
+func (fs *BBolt) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	excl := flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL
+	// 与 POSIX 一致, O_EXCL 不跟随最后一个路径分量上的符号链接
+	name, err := fs.resolve(fs.normalize(name), excl || flag&O_NOFOLLOW != 0)
 	if err != nil {
+		return nil, err
+	}
+	if flag&O_DIRECTORY != 0 {
+		return fs.openDir(name)
+	}
+	if excl {
+		return fs.createExcl(name, flag, perm)
+	}
+	if flag&(os.O_CREATE|os.O_RDWR|os.O_WRONLY|os.O_APPEND) != 0 {
+		return fs.openWrite(name, flag, perm)
+	}
+	return fs.Open(name)
+}
+
+// createExcl 处理 O_CREATE|O_EXCL: 只在 name 不存在时创建权限为 perm 的空文件, 已存在时返回 ErrFileExists,
+// 多个调用方竞争创建同一路径时只有一个成功
+func (fs *BBolt) createExcl(name string, flag int, perm os.FileMode) (File, error) {
+	meta := fileMeta{Mode: perm, ModTime: time.Now().UnixNano()}
+	if _, err := fs.createFile(name, name, nil, meta, true, JournalRecord{Op: OpCreate, Mode: perm}); err != nil {
+		return nil, err
+	}
+	return fs.track(&bboltFile{fs: fs, name: name, meta: meta, buffer: &bytes.Buffer{}, bufSize: fs.writeBuffer, appendOnly: flag&os.O_APPEND != 0}), nil
+}
+
+// openWrite 以写方式打开文件并保留原有内容, 指定 O_TRUNC 时才清空. 文件不存在时只有指定了 O_CREATE
+// 才以权限 perm 创建. O_APPEND 打开时位置在文件末尾, 之后的每次 Write 都追加到末尾
+func (fs *BBolt) openWrite(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := fs.Open(name)
+	if errors.Is(err, ErrFileNotFound) && flag&os.O_CREATE != 0 {
+		// 与其他调用方同时创建时打开对方创建的文件, 而不是把它清空
+		if f, err = fs.createExcl(name, 0, perm); errors.Is(err, ErrFileExists) {
+			f, err = fs.Open(name)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	bf, ok := f.(*bboltFile)
+	if !ok {
+		_ = f.Close()
+		return nil, ErrIsDirectory
+	}
+	if flag&os.O_TRUNC != 0 {
+		if err = bf.Truncate(0); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+	}
+	if flag&os.O_APPEND != 0 {
+		bf.appendOnly, bf.offset = true, bf.meta.Size
+	}
+	return f, nil
+}
+
+// Remove 删除文件或空目录, 目录非空时返回 ErrDirNotEmpty
+func (fs *BBolt) Remove(name string) error {
+	name = fs.normalize(name)
+	return fs.update(func(tx *bbolt.Tx) error {
+		// name 不存在时没有删除任何内容, 不记录日志
+		if removed, err := fs.removeTx(tx, name); err != nil || !removed {
+			return err
+		}
+		return fs.recordTx(tx, JournalRecord{Op: OpRemove, Path: name})
+	})
+}
+
+// RemoveIfExists 删除文件或空目录, 返回是否删除了内容. name 不存在时返回 false 和 nil,
+// 目录非空时返回 ErrDirNotEmpty
+func (fs *BBolt) RemoveIfExists(name string) (bool, error) {
+	name = fs.normalize(name)
+	var removed bool
+	err := fs.update(func(tx *bbolt.Tx) error {
+		var err error
+		if removed, err = fs.removeTx(tx, name); err != nil || !removed {
+			return err
+		}
+		return fs.recordTx(tx, JournalRecord{Op: OpRemove, Path: name})
+	})
+	return removed && err == nil, err
+}
+
+// removeTx 在事务 tx 中删除文件或空目录, 返回是否找到了 name
+func (fs *BBolt) removeTx(tx *bbolt.Tx, name string) (bool, error) {
+	if tx.Bucket([]byte(bucketFiles)).Get([]byte(name)) != nil {
+		return true, fs.deleteFile(tx, name)
+	}
+	dirs := tx.Bucket([]byte(bucketDirs))
+	if dirs.Get([]byte(name)) == nil {
+		return false, nil
+	}
+	prefix := indexPrefix(name)
+	if k, _ := tx.Bucket([]byte(bucketIndex)).Cursor().Seek(prefix); k != nil && bytes.HasPrefix(k, prefix) {
+		return true, ErrDirNotEmpty
+	}
+	if err := dirs.Delete([]byte(name)); err != nil {
+		return true, err
+	}
+	if err := deleteXattrs(tx, name); err != nil {
+		return true, err
+	}
+	if err := fs.touchParent(tx, name); err != nil {
+		return true, err
+	}
+	return true, indexDelete(tx, name)
+}
+
+func (fs *BBolt) RemoveAll(p string) error {
+	p = fs.normalize(p)
+	// 只匹配 p 之下的路径, 不能误删 p10、p.txt 等只是前缀相同的兄弟
+	prefix := []byte(p + "/")
+	if p == "" || strings.HasSuffix(p, "/") {
+		prefix = []byte(p)
+	}
+	// 分批递归删除子文件和子目录, 避免单个写事务过大; 中途失败时重新调用即可继续删除
+	for _, bucket := range []string{bucketFiles, bucketDirs} {
+		for {
+			n, err := fs.removeBatch(bucket, prefix, fs.batchSize)
+			if err != nil {
+				return err
+			}
+			if n < fs.batchSize {
+				break
+			}
+		}
+	}
+	// 最后删除 p 本身, 此时目录已经为空
+	return fs.update(func(tx *bbolt.Tx) error {
+		if _, err := fs.removeTx(tx, p); err != nil {
+			return err
+		}
+		return fs.recordTx(tx, JournalRecord{Op: OpRemoveAll, Path: p})
+	})
+}
+
+// removeAllTx 在事务 tx 中删除 p 及其下的所有文件和子目录, p 不存在时不做任何事.
+// 与 RemoveAll 不同, 所有删除都在同一个事务中完成
+func (fs *BBolt) removeAllTx(tx *bbolt.Tx, p string) error {
+	prefix := []byte(p + "/")
+	for _, bucket := range []string{bucketFiles, bucketDirs} {
+		var keys []string
+		c := tx.Bucket([]byte(bucket)).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			keys = append(keys, string(k))
+		}
+		// 先删除子目录再删除父目录
+		for i := len(keys) - 1; i >= 0; i-- {
+			if _, err := fs.removeTx(tx, keys[i]); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := fs.removeTx(tx, p)
+	return err
+}
+
+// removeBatch 在一个写事务中删除 bucket 内最多 limit 个以 prefix 开头的 key, 返回实际删除的数量
+func (fs *BBolt) removeBatch(bucket string, prefix []byte, limit int) (int, error) {
+	var n int
+	err := fs.update(func(tx *bbolt.Tx) error {
+		c := tx.Bucket([]byte(bucket)).Cursor()
+		for n < limit {
+			// 删除后重新 Seek, 避免游标在删除后跳过 key
+			k, v := c.Seek(prefix)
+			if k == nil || !bytes.HasPrefix(k, prefix) {
+				break
+			}
+			if bucket == bucketFiles {
+				if err := fs.deleteChunks(tx, fs.decodeMeta(v), 0); err != nil {
+					return err
+				}
+				if err := fs.addFiles(tx, -1); err != nil {
+					return err
+				}
+			}
+			name := string(k)
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			if err := indexDelete(tx, name); err != nil {
+				return err
+			}
+			if err := deleteXattrs(tx, name); err != nil {
+				return err
+			}
+			if err := fs.touchParent(tx, name); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+func (fs *BBolt) Rename(oldname, newname string) error {
+	rawOld, rawNew := oldname, newname
+	oldname, newname = fs.normalize(oldname), fs.normalize(newname)
+	if fs.caseInsensitive && oldname == newname && rawOld != rawNew {
+		// 只改变大小写时 key 不变, 删除再重建会丢失文件
+		return fs.update(func(tx *bbolt.Tx) error {
+			if err := fs.renameCase(tx, newname, rawNew); err != nil {
+				return err
+			}
+			return fs.recordTx(tx, JournalRecord{Op: OpRename, Path: rawOld, NewPath: rawNew})
+		})
+	}
+	// 在同一个事务中移动数据和索引, 保证新旧父目录的列表同时更新
+	return fs.update(func(tx *bbolt.Tx) error {
+		if err := fs.rename(tx, oldname, newname); err != nil {
+			return err
+		}
+		if err := fs.setDisplayName(tx, newname, rawNew); err != nil {
+			return err
+		}
+		return fs.recordTx(tx, JournalRecord{Op: OpRename, Path: oldname, NewPath: newname})
+	})
+}
+
+// rename 在事务 tx 中将文件或目录 oldname 移动到 newname. 已有的同名文件会被覆盖;
+// newname 是空目录时被替换, 非空目录时返回 ErrNotEmpty, 与 POSIX rename 覆盖目录的规则一致
+func (fs *BBolt) rename(tx *bbolt.Tx, oldname, newname string) error {
+	b := tx.Bucket([]byte(bucketFiles))
+	val := b.Get([]byte(oldname))
+	if val == nil {
+		if tx.Bucket([]byte(bucketDirs)).Get([]byte(oldname)) != nil {
+			return fs.renameDir(tx, oldname, newname)
+		}
+		return ErrFileNotFound
+	}
+	if oldname == newname {
+		return nil
+	}
+	if err := fs.checkDepth(newname); err != nil {
+		return err
+	}
+	if err := fs.replaceEmptyDir(tx, newname); err != nil {
+		return err
+	}
+	// 覆盖已有文件时释放它的分块; 分块按 inode 存储, 移动文件本身无需复制内容
+	if dst := b.Get([]byte(newname)); dst != nil {
+		if err := fs.deleteChunks(tx, fs.decodeMeta(dst), 0); err != nil {
+			return err
+		}
+		if err := fs.addFiles(tx, -1); err != nil {
+			return err
+		}
+	}
+	if err := b.Put([]byte(newname), append([]byte(nil), val...)); err != nil {
+		return err
+	}
+	if err := indexPut(tx, newname, false); err != nil {
+		return err
+	}
+	if err := b.Delete([]byte(oldname)); err != nil {
+		return err
+	}
+	if err := moveXattrs(tx, oldname, newname); err != nil {
+		return err
+	}
+	if err := fs.touchParent(tx, oldname); err != nil {
 		return err
 	}
-	meta.Mode = mode
-	return fs.saveFile(name, data, meta)
+	if err := fs.touchParent(tx, newname); err != nil {
+		return err
+	}
+	return indexDelete(tx, oldname)
 }
 
-func (fs *BBolt) Chown(name string, uid, gid int) error {
-	// 不支持，忽略
-	return nil
+// replaceEmptyDir 在 rename 覆盖目录 name 前删除它, name 不是目录时不做任何事,
+// 非空时返回同时匹配 ErrDestinationExists 和 ErrNotEmpty 的错误
+func (fs *BBolt) replaceEmptyDir(tx *bbolt.Tx, name string) error {
+	if tx.Bucket([]byte(bucketDirs)).Get([]byte(name)) == nil {
+		return nil
+	}
+	_, err := fs.removeTx(tx, name)
+	if errors.Is(err, ErrNotEmpty) {
+		return fmt.Errorf("%w: %w", ErrDestinationExists, err)
+	}
+	return err
 }
 
-func (fs *BBolt) Chtimes(name string, atime, mtime time.Time) error {
-	data, meta, err := fs.loadFile(name)
+// renameDir 在事务 tx 中将目录 oldname 连同其下的所有文件和子目录移动到 newname.
+// newname 是文件时返回同时匹配 ErrDestinationExists 和 ErrNotDirectory 的错误, 不能移动到自身之下
+func (fs *BBolt) renameDir(tx *bbolt.Tx, oldname, newname string) error {
+	if oldname == newname {
+		return nil
+	}
+	if strings.HasPrefix(newname, oldname+"/") {
+		return fmt.Errorf("%w: cannot move %s into itself", os.ErrInvalid, oldname)
+	}
+	if tx.Bucket([]byte(bucketFiles)).Get([]byte(newname)) != nil {
+		return fmt.Errorf("%w: %w", ErrDestinationExists, ErrNotDirectory)
+	}
+	if err := fs.replaceEmptyDir(tx, newname); err != nil {
+		return err
+	}
+	type move struct {
+		bucket   string
+		old, new string
+		val      []byte
+	}
+	// 先收集再移动, 遍历期间不能修改 bucket
+	moves := []move{{bucketDirs, oldname, newname, tx.Bucket([]byte(bucketDirs)).Get([]byte(oldname))}}
+	prefix := []byte(oldname + "/")
+	for _, bucket := range []string{bucketDirs, bucketFiles} {
+		c := tx.Bucket([]byte(bucket)).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			moves = append(moves, move{bucket, string(k), newname + string(k[len(oldname):]), v})
+		}
+	}
+	for i := range moves {
+		m := &moves[i]
+		m.val = append([]byte(nil), m.val...)
+		if err := fs.checkDepth(m.new); err != nil {
+			return err
+		}
+	}
+	for _, m := range moves {
+		b := tx.Bucket([]byte(m.bucket))
+		if err := b.Put([]byte(m.new), m.val); err != nil {
+			return err
+		}
+		if err := b.Delete([]byte(m.old)); err != nil {
+			return err
+		}
+		if err := indexDelete(tx, m.old); err != nil {
+			return err
+		}
+		if err := indexPut(tx, m.new, m.bucket == bucketDirs); err != nil {
+			return err
+		}
+		if err := moveXattrs(tx, m.old, m.new); err != nil {
+			return err
+		}
+	}
+	if err := fs.touchParent(tx, oldname); err != nil {
+		return err
+	}
+	return fs.touchParent(tx, newname)
+}
+
+// MoveInto 将文件 src 移动到目录 destDir 下, 保持文件名不变, 相当于 mv src destDir/.
+// destDir 不是目录时返回 ErrFileNotFound 或 ErrNotDirectory, 目标已存在同名文件或目录时返回 ErrFileExists 而不会覆盖
+func (fs *BBolt) MoveInto(src, destDir string) error {
+	src, destDir = fs.normalize(src), fs.normalize(destDir)
+	_, base := splitPath(src)
+	dst := base
+	if destDir != "" {
+		dst = strings.TrimSuffix(destDir, "/") + "/" + base
+		if destDir != "/" {
+			destDir = strings.TrimSuffix(destDir, "/")
+		}
+	}
+	return fs.update(func(tx *bbolt.Tx) error {
+		if tx.Bucket([]byte(bucketFiles)).Get([]byte(src)) == nil {
+			return ErrFileNotFound
+		}
+		if destDir != "" && destDir != "/" && tx.Bucket([]byte(bucketDirs)).Get([]byte(destDir)) == nil {
+			if tx.Bucket([]byte(bucketFiles)).Get([]byte(destDir)) != nil {
+				return ErrNotDirectory
+			}
+			return ErrFileNotFound
+		}
+		if dst == src {
+			return nil
+		}
+		if tx.Bucket([]byte(bucketFiles)).Get([]byte(dst)) != nil || tx.Bucket([]byte(bucketDirs)).Get([]byte(dst)) != nil {
+			return ErrFileExists
+		}
+		if err := fs.rename(tx, src, dst); err != nil {
+			return err
+		}
+		return fs.recordTx(tx, JournalRecord{Op: OpRename, Path: src, NewPath: dst})
+	})
+}
+
+func (fs *BBolt) Stat(name string) (os.FileInfo, error) {
+	name = fs.normalize(name)
+	if fi, ok := fs.statCache.get(name); ok {
+		return fi, nil
+	}
+	gen := fs.statCache.generation()
+	fi, err := fs.stat(name)
 	if err != nil {
+		return nil, err
+	}
+	fs.statCache.add(gen, name, fi)
+	return fi, nil
+}
+
+func (fs *BBolt) stat(name string) (*fileInfo, error) {
+	var fi *fileInfo
+	err := fs.view(func(tx *bbolt.Tx) error {
+		var err error
+		fi, err = fs.statFollowTx(tx, name)
 		return err
+	})
+	return fi, err
+}
+
+// statTx 在事务 tx 中查询 name 的元信息, 先按文件查找, 再按目录查找
+func (fs *BBolt) statTx(tx *bbolt.Tx, name string) (*fileInfo, error) {
+	if val := tx.Bucket([]byte(bucketFiles)).Get([]byte(name)); val != nil {
+		meta, inline := fs.splitMeta(val)
+		return &fileInfo{
+			key:     name,
+			name:    fs.displayName(tx, name, filepath.Base(name)),
+			size:    meta.Size,
+			mode:    meta.Mode,
+			modTime: time.Unix(0, meta.ModTime),
+			isDir:   meta.IsDir,
+			nlink:   1,
+			disk:    fs.diskSize(tx, meta, inline),
+			storage: storageOf(meta),
+			owner:   ownerOf(meta),
+		}, nil
+	}
+	// 尝试作为目录
+	val := tx.Bucket([]byte(bucketDirs)).Get([]byte(name))
+	if val == nil && fs.flat && isPseudoDir(tx, name) {
+		return &fileInfo{key: name, name: filepath.Base(name), mode: pseudoDirMode, modTime: time.Unix(0, 0), isDir: true, nlink: 2}, nil
+	}
+	if val == nil {
+		return nil, ErrFileNotFound
+	}
+	dmeta := fs.decodeMeta(val)
+	return &fileInfo{
+		key:     name,
+		name:    fs.displayName(tx, name, filepath.Base(name)),
+		size:    0,
+		mode:    dmeta.Mode,
+		modTime: time.Unix(0, dmeta.ModTime),
+		isDir:   true,
+		nlink:   2 + subdirCount(tx, name),
+		owner:   ownerOf(dmeta),
+	}, nil
+}
+
+func (fs *BBolt) Name() string { return fs.name }
+
+// DB 返回底层的 bbolt 数据库. 直接修改数据后需要调用 InvalidateCache 或 InvalidateAll.
+// 开启 WithTxPool 时会先关闭缓存的只读事务, 否则直接写入需要扩容时会一直等待这些事务结束
+func (fs *BBolt) DB() *bbolt.DB {
+	fs.dbMu.RLock()
+	defer fs.dbMu.RUnlock()
+	if fs.txPool != nil {
+		fs.txPool.drain()
 	}
-	meta.ModTime = mtime.UnixNano()
-	return fs.saveFile(name, data, meta)
+	return fs.db
 }
 
-func (fs *BBolt) Close() error {
-	return fs.db.Close()
+// Chmod 修改文件或目录的权限位, 文件类型保持不变
+func (fs *BBolt) Chmod(name string, mode os.FileMode) error {
+	name = fs.normalize(name)
+	return fs.update(func(tx *bbolt.Tx) error {
+		meta, err := fs.updateMetaTx(tx, name, func(meta *fileMeta) {
+			meta.Mode = meta.Mode&os.ModeType | mode&^os.ModeType
+		})
+		if err != nil {
+			return err
+		}
+		return fs.recordTx(tx, JournalRecord{Op: OpChmod, Path: name, Mode: mode, Size: meta.Size})
+	})
 }
 
-func (fs *BBolt) readDir(dir string, count int) ([]os.FileInfo, error) {
-	var fis []os.FileInfo
-	prefix := dir
-	if !strings.HasSuffix(prefix, "/") && prefix != "" {
-		prefix += "/"
+// Chown 修改文件或目录的属主, 可以通过 Stat().Sys().(*SysInfo) 读取
+func (fs *BBolt) Chown(name string, uid, gid int) error {
+	name = fs.normalize(name)
+	return fs.update(func(tx *bbolt.Tx) error {
+		if _, err := fs.updateMetaTx(tx, name, func(meta *fileMeta) { meta.Uid, meta.Gid = int32(uid), int32(gid) }); err != nil {
+			return err
+		}
+		return fs.recordTx(tx, JournalRecord{Op: OpChown, Path: name, Uid: uid, Gid: gid})
+	})
+}
+
+// updateMetaTx 在事务 tx 中用 fn 修改文件或目录 name 的元数据并返回修改后的值.
+// 只改写元数据头部, 内联内容原样复制, 分块不受影响, 内容版本号不变
+func (fs *BBolt) updateMetaTx(tx *bbolt.Tx, name string, fn func(meta *fileMeta)) (fileMeta, error) {
+	b := tx.Bucket([]byte(bucketFiles))
+	val := b.Get([]byte(name))
+	if val == nil {
+		if b = tx.Bucket([]byte(bucketDirs)); b.Get([]byte(name)) == nil {
+			return fileMeta{}, ErrFileNotFound
+		}
+		val = b.Get([]byte(name))
 	}
-	err := fs.db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(bucketFiles))
-		c := b.Cursor()
-		for k, v := c.First(); k != nil; k, v = c.Next() {
-			if !strings.HasPrefix(string(k), prefix) {
-				continue
+	meta, inline := fs.splitMeta(val)
+	fn(&meta)
+	return meta, b.Put([]byte(name), append(fs.encodeMeta(meta), inline...))
+}
+
+// Chtimes 修改文件或目录的修改时间, 不保存访问时间
+func (fs *BBolt) Chtimes(name string, atime, mtime time.Time) error {
+	name = fs.normalize(name)
+	return fs.update(func(tx *bbolt.Tx) error {
+		meta, err := fs.updateMetaTx(tx, name, func(meta *fileMeta) { meta.ModTime = mtime.UnixNano() })
+		if err != nil {
+			return err
+		}
+		return fs.recordTx(tx, JournalRecord{Op: OpChtimes, Path: name, ModTime: meta.ModTime, Size: meta.Size})
+	})
+}
+
+func (fs *BBolt) Truncate(name string, size int64) error {
+	name = fs.normalize(name)
+	if size < 0 {
+		return os.ErrInvalid
+	}
+	return fs.update(func(tx *bbolt.Tx) error {
+		name, err := fs.resolveTx(tx, name, true)
+		if err != nil {
+			return err
+		}
+		if err = fs.truncateTx(tx, name, size, time.Now().UnixNano()); err != nil {
+			return err
+		}
+		return fs.recordTx(tx, JournalRecord{Op: OpTruncate, Path: name, Size: size})
+	})
+}
+
+// CopyRange 在一个事务中将文件 name 的 [srcOff, srcOff+length) 复制到 dstOff 处,
+// 允许区间重叠; 分块存储的文件只读写涉及的分块
+func (fs *BBolt) CopyRange(name string, srcOff, dstOff, length int64) error {
+	name = fs.normalize(name)
+	if srcOff < 0 || dstOff < 0 || length < 0 {
+		return os.ErrInvalid
+	}
+	return fs.update(func(tx *bbolt.Tx) error {
+		name, err := fs.resolveTx(tx, name, true)
+		if err != nil {
+			return err
+		}
+		val := tx.Bucket([]byte(bucketFiles)).Get([]byte(name))
+		if val == nil {
+			return ErrFileNotFound
+		}
+		m, inline := fs.splitMeta(val)
+		if srcOff+length > m.Size {
+			return os.ErrInvalid
+		}
+		// 先完整读出源区间, 再写入目标区间, 重叠时结果与 memmove 一致
+		data := make([]byte, length)
+		fs.readAt(tx, m, inline, data, srcOff)
+		meta, err := fs.writeAt(tx, name, val, data, dstOff, time.Now().UnixNano())
+		if err != nil {
+			return err
+		}
+		return fs.recordTx(tx, JournalRecord{Op: OpWrite, Path: name, Offset: dstOff, Data: data, Size: meta.Size})
+	})
+}
+
+// Append 在一个事务中将 data 追加到文件 name 的末尾 (不存在时创建), 返回写入的字节数.
+// 读取大小和写入在同一个事务中完成, 并发追加不会互相覆盖
+func (fs *BBolt) Append(name string, data []byte) (int, error) {
+	raw := name
+	name = fs.normalize(name)
+	err := fs.update(func(tx *bbolt.Tx) error {
+		name, raw, err := fs.writeTargetTx(tx, name, raw)
+		if err != nil {
+			return err
+		}
+		val := tx.Bucket([]byte(bucketFiles)).Get([]byte(name))
+		now := time.Now().UnixNano()
+		if val == nil && tx.Bucket([]byte(bucketDirs)).Get([]byte(name)) != nil {
+			return ErrIsDirectory
+		}
+		if val == nil {
+			meta := fileMeta{Mode: 0666, Size: int64(len(data)), ModTime: now}
+			if err = fs.putFileTx(tx, name, data, meta, true); err != nil {
+				return err
 			}
-			rest := strings.TrimPrefix(string(k), prefix)
-			if rest == "" || strings.Contains(rest, "/") {
-				continue // 只返回当前目录下的
+			if err = fs.keepCaseTx(tx, name, raw); err != nil {
+				return err
 			}
-			meta := fs.decodeMeta(v)
-			fis = append(fis, &fileInfo{
-				name:    rest,
-				size:    meta.Size,
-				mode:    meta.Mode,
-				modTime: time.Unix(0, meta.ModTime),
-				isDir:   meta.IsDir,
-			})
-			if count > 0 && len(fis) >= count {
-				break
+			return fs.recordTx(tx, JournalRecord{Op: OpCreate, Path: name}, JournalRecord{Op: OpWrite, Path: name, Data: data, Size: meta.Size})
+		}
+		off := fs.decodeMeta(val).Size
+		meta, err := fs.writeAt(tx, name, val, data, off, now)
+		if err != nil {
+			return err
+		}
+		return fs.recordTx(tx, JournalRecord{Op: OpWrite, Path: name, Offset: off, Data: data, Size: meta.Size})
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// CompareAndSwap 在一个事务中检查文件内容是否等于 old, 相等时替换为 new 并返回 true.
+// 先比较大小, 大小一致时才读出内容比较, 分块存储的文件逐块比较
+func (fs *BBolt) CompareAndSwap(name string, old, new []byte) (bool, error) {
+	name = fs.normalize(name)
+	var swapped bool
+	err := fs.update(func(tx *bbolt.Tx) error {
+		name, err := fs.resolveTx(tx, name, true)
+		if err != nil {
+			return err
+		}
+		b := tx.Bucket([]byte(bucketFiles))
+		key := []byte(name)
+		val := b.Get(key)
+		if val == nil {
+			return ErrFileNotFound
+		}
+		meta, inline := fs.splitMeta(val)
+		if meta.Size != int64(len(old)) || !fs.contentEqual(tx, meta, inline, old) {
+			return nil
+		}
+		m := meta
+		m.Size = int64(len(new))
+		m.ModTime = time.Now().UnixNano()
+		if m.Version, err = b.NextSequence(); err != nil {
+			return err
+		}
+		v, err := fs.encodeFile(tx, &meta, m, new)
+		if err != nil {
+			return err
+		}
+		if err = b.Put(key, v); err != nil {
+			return err
+		}
+		fs.saves.Add(1)
+		swapped = true
+		return fs.recordTx(tx, JournalRecord{Op: OpTruncate, Path: name, Size: 0}, JournalRecord{Op: OpWrite, Path: name, Data: new, Size: int64(len(new))})
+	})
+	return swapped && err == nil, err
+}
+
+// Swap 在一个事务中将文件内容替换为 data 并返回原来的内容. 文件不存在时以 0666 权限创建, prev 为 nil
+func (fs *BBolt) Swap(name string, data []byte) (prev []byte, err error) {
+	name = fs.normalize(name)
+	err = fs.update(func(tx *bbolt.Tx) error {
+		name, err := fs.resolveTx(tx, name, true)
+		if err != nil {
+			return err
+		}
+		meta := fileMeta{Mode: 0666}
+		rec := JournalRecord{Op: OpCreate, Path: name}
+		if val := tx.Bucket([]byte(bucketFiles)).Get([]byte(name)); val != nil {
+			if meta, prev, err = fs.fileContent(tx, val); err != nil {
+				return err
 			}
+			rec = JournalRecord{Op: OpTruncate, Path: name, Size: 0}
+		}
+		meta.Size = int64(len(data))
+		meta.ModTime = time.Now().UnixNano()
+		if err = fs.putFileTx(tx, name, data, meta, true); err != nil {
+			return err
+		}
+		return fs.recordTx(tx, rec, JournalRecord{Op: OpWrite, Path: name, Data: data, Size: int64(len(data))})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return prev, nil
+}
+
+// FilesEqual 判断两个文件的内容是否相同. 先比较大小, 大小相同时在一个读事务中逐块比较内容,
+// 不会把两个文件完整读入内存
+func (fs *BBolt) FilesEqual(a, b string) (bool, error) {
+	a, b = fs.normalize(a), fs.normalize(b)
+	var equal bool
+	err := fs.view(func(tx *bbolt.Tx) error {
+		files := tx.Bucket([]byte(bucketFiles))
+		va, vb := files.Get([]byte(a)), files.Get([]byte(b))
+		if va == nil || vb == nil {
+			return ErrFileNotFound
 		}
+		ma, ia := fs.splitMeta(va)
+		mb, ib := fs.splitMeta(vb)
+		equal = fs.sameContent(tx, ma, ia, mb, ib)
 		return nil
 	})
-	return fis, err
+	return equal, err
+}
+
+// sameContent 在事务 tx 中比较两个文件的内容, 大小不同时直接返回 false, 否则逐块比较
+func (fs *BBolt) sameContent(tx *bbolt.Tx, ma fileMeta, ia []byte, mb fileMeta, ib []byte) bool {
+	if ma.Size != mb.Size {
+		return false
+	}
+	block := int64(defaultChunkSize)
+	if ma.Storage == storageChunked {
+		block = int64(ma.ChunkSize)
+	}
+	bufA, bufB := make([]byte, block), make([]byte, block)
+	for off := int64(0); off < ma.Size; off += block {
+		n := fs.readAt(tx, ma, ia, bufA, off)
+		fs.readAt(tx, mb, ib, bufB, off)
+		if !bytes.Equal(bufA[:n], bufB[:n]) {
+			return false
+		}
+	}
+	return true
+}
+
+// contentEqual 判断文件内容是否等于 want, 调用方需保证大小一致
+func (fs *BBolt) contentEqual(tx *bbolt.Tx, meta fileMeta, inline []byte, want []byte) bool {
+	size := meta.Size
+	if meta.Storage == storageChunked {
+		size = int64(meta.ChunkSize)
+	}
+	if size == 0 {
+		return true
+	}
+	buf := make([]byte, size)
+	for off := int64(0); off < meta.Size; off += size {
+		n := fs.readAt(tx, meta, inline, buf, off)
+		if !bytes.Equal(buf[:n], want[off:off+int64(n)]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (fs *BBolt) ReadDir(name string) ([]os.DirEntry, error) {
+	name, err := fs.resolve(fs.normalize(name), false)
+	if err != nil {
+		return nil, err
+	}
+	if name != "" {
+		fi, err := fs.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			// 与 os.ReadDir 一致, 对文件调用时返回错误而不是空列表
+			return nil, &os.PathError{Op: "readdir", Path: name, Err: ErrNotDirectory}
+		}
+	}
+	infos, err := fs.readDir(name, 0)
+	if err != nil {
+		return nil, err
+	}
+	return dirEntries(infos), nil
+}
+
+// DiskSize 返回文件内容在数据库中实际占用的字节数, 带空洞的分块文件会小于 Stat 返回的逻辑大小
+func (fs *BBolt) DiskSize(name string) (int64, error) {
+	fi, err := fs.stat(fs.normalize(name))
+	if err != nil {
+		return 0, err
+	}
+	if fi.IsDir() {
+		return 0, ErrIsDirectory
+	}
+	return fi.disk, nil
+}
+
+// ETag 返回文件当前内容的 ETag, 每次写入内容后都会变化, 只修改权限或时间时保持不变
+func (fs *BBolt) ETag(name string) (string, error) {
+	meta, err := fs.loadMeta(fs.normalize(name))
+	if err != nil {
+		return "", err
+	}
+	if meta.IsDir {
+		return "", ErrIsDirectory
+	}
+	return fmt.Sprintf(`"%x-%x"`, meta.Version, meta.Size), nil
+}
+
+// track 登记一个打开的句柄
+func (fs *BBolt) track(f File) File {
+	fs.handlesMu.Lock()
+	defer fs.handlesMu.Unlock()
+	if fs.handles == nil {
+		fs.handles = make(map[File]string)
+	}
+	fs.handles[f] = f.Name()
+	return f
+}
+
+// untrack 在句柄关闭时注销它
+func (fs *BBolt) untrack(f File) {
+	fs.handlesMu.Lock()
+	defer fs.handlesMu.Unlock()
+	delete(fs.handles, f)
+}
+
+// OpenHandles 返回所有尚未关闭的句柄对应的路径 (按字典序排列), 用于诊断句柄泄漏
+func (fs *BBolt) OpenHandles() []string {
+	fs.handlesMu.Lock()
+	defer fs.handlesMu.Unlock()
+	names := make([]string, 0, len(fs.handles))
+	for _, name := range fs.handles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (fs *BBolt) Close() error {
+	if fs.maintainer != nil {
+		fs.maintainer.close()
+	}
+	fs.dbMu.Lock()
+	defer fs.dbMu.Unlock()
+	if fs.dbErr != nil {
+		// 数据库已在重新打开失败前关闭
+		return nil
+	}
+	if fs.txPool != nil {
+		fs.txPool.close()
+	}
+	return fs.db.Close()
+}
+
+// dirEntries 将 FileInfo 列表转换为 DirEntry 列表
+func dirEntries(infos []os.FileInfo) []os.DirEntry {
+	entries := make([]os.DirEntry, 0, len(infos))
+	for _, fi := range infos {
+		entries = append(entries, fi.(*fileInfo))
+	}
+	return entries
+}
+
+// 元数据编码格式:
+//
+//	旧格式: Mode(4) Size(8) ModTime(8) IsDir(1), 共 21 字节
+//	新格式: magic(1) version(1) 头部长度(2) Mode(4) Size(8) ModTime(8) IsDir(1) Storage(1) Ino(8) ChunkSize(4) Version(8) Seq(8)
+//	        Uid(4) Gid(4), 没有 Uid/Gid 的旧头部解码为 0
+//
+// 旧格式第二个字节是 Mode 的 bit8-15, 而 os.FileMode 的 bit9-18 未使用, 因此恒为 0 或 1,
+// 新格式的 version 从 2 开始, 可以据此区分两种格式. 文件内容紧跟在头部之后.
+//
+// 新字段只能追加在已有字段之后并增加头部长度. 解码时只读取已知的字段, 头部中剩余的未知字段
+// 原样保存在 fileMeta.extra 中, 重新编码时写回, 这样旧版本改写元数据也不会丢失新版本的信息.
+//
+// 开启 WithReadableMeta 时写入 JSON 格式: 一行 JSON 对象后跟 '\n', 文件内容紧跟其后.
+// JSON 以 `{"` 开头, 旧格式第二个字节只能是 0 或 1, 新格式以 metaMagic 开头, 三种格式互不冲突
+const (
+	metaMagic     byte = 0xBF
+	metaVersion   byte = 2
+	legacyMetaLen      = 4 + 8 + 8 + 1
+)
+
+// jsonMeta 是 WithReadableMeta 使用的元数据格式, 时间以 RFC3339 字符串保存
+type jsonMeta struct {
+	Mode      os.FileMode `json:"mode"`
+	Size      int64       `json:"size"`
+	ModTime   time.Time   `json:"mod_time"`
+	IsDir     bool        `json:"is_dir,omitempty"`
+	Storage   uint8       `json:"storage,omitempty"`
+	Ino       uint64      `json:"ino,omitempty"`
+	ChunkSize uint32      `json:"chunk_size,omitempty"`
+	Version   uint64      `json:"version,omitempty"`
+	Seq       uint64      `json:"seq,omitempty"`
+	Uid       int32       `json:"uid,omitempty"`
+	Gid       int32       `json:"gid,omitempty"`
+
+	// 从更新版本的二进制格式转换而来时保留的格式版本和未知字段
+	FormatVersion byte   `json:"format_version,omitempty"`
+	Extra         []byte `json:"extra,omitempty"`
 }
 
 func (fs *BBolt) encodeMeta(meta fileMeta) []byte {
+	if fs.readableMeta {
+		return encodeJSONMeta(meta)
+	}
 	buf := new(bytes.Buffer)
+	buf.Write([]byte{metaMagic, metaVersion, 0, 0})
 	_ = binary.Write(buf, binary.LittleEndian, meta.Mode)
 	_ = binary.Write(buf, binary.LittleEndian, meta.Size)
 	_ = binary.Write(buf, binary.LittleEndian, meta.ModTime)
 	_ = binary.Write(buf, binary.LittleEndian, meta.IsDir)
-	return buf.Bytes()
+	_ = binary.Write(buf, binary.LittleEndian, meta.Storage)
+	_ = binary.Write(buf, binary.LittleEndian, meta.Ino)
+	_ = binary.Write(buf, binary.LittleEndian, meta.ChunkSize)
+	_ = binary.Write(buf, binary.LittleEndian, meta.Version)
+	_ = binary.Write(buf, binary.LittleEndian, meta.Seq)
+	_ = binary.Write(buf, binary.LittleEndian, meta.Uid)
+	_ = binary.Write(buf, binary.LittleEndian, meta.Gid)
+	buf.Write(meta.extra)
+	b := buf.Bytes()
+	if meta.version > metaVersion {
+		b[1] = meta.version
+	}
+	binary.LittleEndian.PutUint16(b[2:4], uint16(len(b)))
+	return b
 }
+
 func (fs *BBolt) decodeMeta(b []byte) fileMeta {
-	buf := bytes.NewReader(b)
+	meta, _ := fs.splitMeta(b)
+	return meta
+}
+
+// splitMeta 解析 value 头部的元数据, 返回元数据和其后的内联内容
+func (fs *BBolt) splitMeta(b []byte) (fileMeta, []byte) {
+	return parseMeta(b)
+}
+
+// parseMeta 是 splitMeta 的实现. 解码总能识别所有格式, 与 fs 的选项无关
+func parseMeta(b []byte) (fileMeta, []byte) {
 	var meta fileMeta
+	if len(b) >= 2 && b[0] == '{' && b[1] == '"' {
+		if meta, rest, ok := decodeJSONMeta(b); ok {
+			return meta, rest
+		}
+	}
+	if len(b) < 4 || b[0] != metaMagic || b[1] < metaVersion {
+		buf := bytes.NewReader(b)
+		_ = binary.Read(buf, binary.LittleEndian, &meta.Mode)
+		_ = binary.Read(buf, binary.LittleEndian, &meta.Size)
+		_ = binary.Read(buf, binary.LittleEndian, &meta.ModTime)
+		_ = binary.Read(buf, binary.LittleEndian, &meta.IsDir)
+		if len(b) < legacyMetaLen {
+			return meta, nil
+		}
+		return meta, b[legacyMetaLen:]
+	}
+	n := int(binary.LittleEndian.Uint16(b[2:4]))
+	if n > len(b) {
+		n = len(b)
+	}
+	buf := bytes.NewReader(b[4:n])
 	_ = binary.Read(buf, binary.LittleEndian, &meta.Mode)
 	_ = binary.Read(buf, binary.LittleEndian, &meta.Size)
 	_ = binary.Read(buf, binary.LittleEndian, &meta.ModTime)
 	_ = binary.Read(buf, binary.LittleEndian, &meta.IsDir)
-	return meta
+	_ = binary.Read(buf, binary.LittleEndian, &meta.Storage)
+	_ = binary.Read(buf, binary.LittleEndian, &meta.Ino)
+	_ = binary.Read(buf, binary.LittleEndian, &meta.ChunkSize)
+	_ = binary.Read(buf, binary.LittleEndian, &meta.Version)
+	_ = binary.Read(buf, binary.LittleEndian, &meta.Seq)
+	_ = binary.Read(buf, binary.LittleEndian, &meta.Uid)
+	_ = binary.Read(buf, binary.LittleEndian, &meta.Gid)
+	meta.version = b[1]
+	if rest := buf.Len(); rest > 0 {
+		meta.extra = append([]byte(nil), b[n-rest:n]...)
+	}
+	return meta, b[n:]
+}
+
+func encodeJSONMeta(meta fileMeta) []byte {
+	jm := jsonMeta{
+		Mode:      meta.Mode,
+		Size:      meta.Size,
+		ModTime:   time.Unix(0, meta.ModTime).UTC(),
+		IsDir:     meta.IsDir,
+		Storage:   meta.Storage,
+		Ino:       meta.Ino,
+		ChunkSize: meta.ChunkSize,
+		Version:   meta.Version,
+		Seq:       meta.Seq,
+		Uid:       meta.Uid,
+		Gid:       meta.Gid,
+		Extra:     meta.extra,
+	}
+	if meta.version > metaVersion {
+		jm.FormatVersion = meta.version
+	}
+	b, _ := json.Marshal(jm)
+	// json.Marshal 不会输出换行, 可以用 '\n' 分隔元数据和内容
+	return append(b, '\n')
+}
+
+// decodeJSONMeta 解析 JSON 格式的元数据, 格式不正确时返回 false
+func decodeJSONMeta(b []byte) (fileMeta, []byte, bool) {
+	n := bytes.IndexByte(b, '\n')
+	if n < 0 {
+		return fileMeta{}, nil, false
+	}
+	var jm jsonMeta
+	if err := json.Unmarshal(b[:n], &jm); err != nil {
+		return fileMeta{}, nil, false
+	}
+	meta := fileMeta{
+		Mode:      jm.Mode,
+		Size:      jm.Size,
+		ModTime:   jm.ModTime.UnixNano(),
+		IsDir:     jm.IsDir,
+		Storage:   jm.Storage,
+		Ino:       jm.Ino,
+		ChunkSize: jm.ChunkSize,
+		Version:   jm.Version,
+		Seq:       jm.Seq,
+		Uid:       jm.Uid,
+		Gid:       jm.Gid,
+		version:   jm.FormatVersion,
+		extra:     jm.Extra,
+	}
+	return meta, b[n+1:], true
 }
-func (fs *BBolt) metaLen() int { return 4 + 8 + 8 + 1 }
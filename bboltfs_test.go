@@ -1,20 +1,28 @@
 package bboltfs
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
+
+	"go.etcd.io/bbolt"
 )
 
-func mustTmpFile(t *testing.T) string {
+func mustTmpFile(t testing.TB) string {
 	t.Helper()
-	tmp := filepath.Join(os.TempDir(), "bboltfs_test_"+time.Now().Format("20060102150405"))
-	t.Cleanup(func() {
-		os.Remove(tmp)
-	})
-	return tmp
+	return filepath.Join(t.TempDir(), "bboltfs_test_"+time.Now().Format("20060102150405"))
 }
 
 func TestBBoltFs_Create_Write_Read(t *testing.T) {
@@ -176,6 +184,113 @@ func TestBBoltFs_Chmod_Chtimes(t *testing.T) {
 	}
 }
 
+func TestBBoltFs_Chown(t *testing.T) {
+	dbfile := mustTmpFile(t)
+	fs, err := New(dbfile)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	owner := func(name string) FileOwner {
+		t.Helper()
+		fi, err := fs.Stat(name)
+		if err != nil {
+			t.Fatalf("Stat(%s): %v", name, err)
+		}
+		return fi.Sys().(*SysInfo).FileOwner
+	}
+
+	_ = fs.Mkdir("dir", 0755)
+	f, _ := fs.(*BBolt).CreateWith("dir/own.txt", []byte("data"), 0644)
+	if err := fs.Chown("dir/own.txt", 1000, 1000); err != nil {
+		t.Fatalf("Chown: %v", err)
+	}
+	if err := fs.Chown("dir", 1001, 1002); err != nil {
+		t.Fatalf("Chown(dir): %v", err)
+	}
+	if got := owner("dir/own.txt"); got != (FileOwner{Uid: 1000, Gid: 1000}) {
+		t.Errorf("owner = %+v", got)
+	}
+	if got := owner("dir"); got != (FileOwner{Uid: 1001, Gid: 1002}) {
+		t.Errorf("dir owner = %+v", got)
+	}
+
+	// 句柄在 Chown 之前打开, 之后的写入和 Chmod 不会覆盖属主
+	_, _ = f.Write([]byte("!"))
+	_ = f.Close()
+	_ = fs.Chmod("dir/own.txt", 0600)
+	if got := readAll(t, fs, "dir/own.txt"); got != "data!" {
+		t.Errorf("content = %q", got)
+	}
+	if err := fs.Chown("missing", 1, 1); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Chown(missing) = %v, want ErrFileNotFound", err)
+	}
+	_ = fs.Close()
+
+	if fs, err = New(dbfile); err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+	if got := owner("dir/own.txt"); got != (FileOwner{Uid: 1000, Gid: 1000}) {
+		t.Errorf("owner after reopen = %+v", got)
+	}
+	entries, _ := fs.ReadDir("dir")
+	if info, _ := entries[0].Info(); info.Sys().(*SysInfo).Uid != 1000 {
+		t.Errorf("ReadDir owner = %+v", info.Sys())
+	}
+
+	// 没有 Uid/Gid 的旧头部解码为 0
+	b := fs.(*BBolt)
+	head := b.encodeMeta(fileMeta{Mode: 0644, Uid: 7, Gid: 7})
+	head = head[:len(head)-8]
+	binary.LittleEndian.PutUint16(head[2:4], uint16(len(head)))
+	if meta := b.decodeMeta(head); meta.Uid != 0 || meta.Gid != 0 || meta.Mode != 0644 || meta.extra != nil {
+		t.Errorf("old header decoded as %+v", meta)
+	}
+}
+
+// Stat、Chmod、Chtimes 只解码元数据头部, 分配次数与文件大小无关
+func TestBBoltFs_MetaOpsAllocs(t *testing.T) {
+	fs := newTestFs(t)
+	for _, name := range []string{"small", "large"} {
+		size := 16
+		if name == "large" {
+			size = 4 << 20
+		}
+		f, _ := fs.CreateWith(name, make([]byte, size), 0644)
+		f.Close()
+	}
+	allocs := func(name string) float64 {
+		return testing.AllocsPerRun(20, func() {
+			_, _ = fs.Stat(name)
+			_ = fs.Chmod(name, 0600)
+			_ = fs.Chtimes(name, time.Now(), time.Now())
+		})
+	}
+	if small, large := allocs("small"), allocs("large"); large > small+1 {
+		t.Errorf("allocs: small file %.0f, large file %.0f", small, large)
+	}
+	if got := readAll(t, fs, "large"); len(got) != 4<<20 {
+		t.Errorf("content size = %d after Chmod/Chtimes", len(got))
+	}
+}
+
+func BenchmarkBBoltFs_Stat_FileSize(b *testing.B) {
+	for _, size := range []int{1 << 10, 1 << 20, 16 << 20} {
+		b.Run(fmt.Sprintf("%dKiB", size>>10), func(b *testing.B) {
+			fs := newTestFs(b)
+			f, _ := fs.CreateWith("file", make([]byte, size), 0644)
+			f.Close()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := fs.Stat("file"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
 func TestBBoltFs_Readdir_Readdirnames(t *testing.T) {
 	dbfile := mustTmpFile(t)
 	fs, err := New(dbfile)
@@ -239,3 +354,1739 @@ func TestBBoltFs_Truncate(t *testing.T) {
 		t.Errorf("Truncate failed, got %q", string(buf[:n]))
 	}
 }
+
+// populate 在一个事务中直接写入 n 个空文件, 用于构造大目录树
+func populate(t testing.TB, b *BBolt, dir string, n int) {
+	t.Helper()
+	err := b.db.Update(func(tx *bbolt.Tx) error {
+		files := tx.Bucket([]byte(bucketFiles))
+		meta := b.encodeMeta(fileMeta{Mode: 0666, ModTime: time.Now().UnixNano()})
+		for i := 0; i < n; i++ {
+			if err := files.Put([]byte(fmt.Sprintf("%s/f%06d", dir, i)), meta); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("populate: %v", err)
+	}
+}
+
+func TestBBoltFs_RemoveAll_Batches(t *testing.T) {
+	dbfile := mustTmpFile(t)
+	fs, err := New(dbfile)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer fs.Close()
+
+	b := fs.(*BBolt)
+	b.batchSize = 100
+	_ = fs.MkdirAll("big", 0755)
+	populate(t, b, "big", 1050)
+
+	if err := fs.RemoveAll("big"); err != nil {
+		t.Fatalf("RemoveAll: %v", err)
+	}
+	var left int
+	_ = b.db.View(func(tx *bbolt.Tx) error {
+		left = tx.Bucket([]byte(bucketFiles)).Stats().KeyN
+		return nil
+	})
+	if left != 0 {
+		t.Errorf("RemoveAll left %d keys", left)
+	}
+	if _, err := fs.Stat("big"); err == nil {
+		t.Errorf("dir should be deleted")
+	}
+}
+
+func TestBBoltFs_RemoveAll_Siblings(t *testing.T) {
+	fs := newTestFs(t)
+	_ = fs.MkdirAll("d1/sub", 0755)
+	_ = fs.Mkdir("d10", 0755)
+	for _, name := range []string{"d1/a.txt", "d1/sub/c.txt", "d10/b.txt", "d1x.txt"} {
+		f, _ := fs.CreateWith(name, []byte(name), 0644)
+		f.Close()
+	}
+
+	if err := fs.RemoveAll("d1"); err != nil {
+		t.Fatalf("RemoveAll: %v", err)
+	}
+	for _, name := range []string{"d1", "d1/a.txt", "d1/sub", "d1/sub/c.txt"} {
+		if _, err := fs.Stat(name); !errors.Is(err, ErrFileNotFound) {
+			t.Errorf("Stat(%s) = %v, want ErrFileNotFound", name, err)
+		}
+	}
+	for _, name := range []string{"d10", "d10/b.txt", "d1x.txt"} {
+		if _, err := fs.Stat(name); err != nil {
+			t.Errorf("%s should survive: %v", name, err)
+		}
+	}
+
+	// 参数是文件时只删除它自己
+	if err := fs.RemoveAll("d1x.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("d1x.txt"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Stat(d1x.txt) = %v, want ErrFileNotFound", err)
+	}
+}
+
+func TestBBoltFs_RemoveDir(t *testing.T) {
+	fs := newTestFs(t)
+	_ = fs.Mkdir("empty", 0755)
+	_ = fs.Mkdir("full", 0755)
+	f, _ := fs.CreateWith("full/a.txt", []byte("a"), 0644)
+	f.Close()
+
+	if err := fs.Remove("empty"); err != nil {
+		t.Fatalf("Remove(empty dir): %v", err)
+	}
+	if _, err := fs.Stat("empty"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Stat(empty) = %v, want ErrFileNotFound", err)
+	}
+	if err := fs.Remove("full"); !errors.Is(err, ErrDirNotEmpty) {
+		t.Errorf("Remove(non-empty dir) = %v, want ErrDirNotEmpty", err)
+	}
+	if _, err := fs.Stat("full/a.txt"); err != nil {
+		t.Errorf("child removed: %v", err)
+	}
+	if err := fs.Remove("full/a.txt"); err != nil {
+		t.Fatalf("Remove(file): %v", err)
+	}
+	if _, err := fs.Stat("full/a.txt"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Stat(file) = %v, want ErrFileNotFound", err)
+	}
+	if err := fs.Remove("full"); err != nil {
+		t.Errorf("Remove(emptied dir): %v", err)
+	}
+}
+
+func BenchmarkBBoltFs_RemoveAll(b *testing.B) {
+	dbfile := mustTmpFile(b)
+	fs, err := New(dbfile)
+	if err != nil {
+		b.Fatalf("New: %v", err)
+	}
+	defer fs.Close()
+
+	bf := fs.(*BBolt)
+	bf.batchSize = 1000
+	maxTx := 0
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		populate(b, bf, "big", 5000)
+		b.StartTimer()
+		for {
+			n, err := bf.removeBatch(bucketFiles, []byte("big"), bf.batchSize)
+			if err != nil {
+				b.Fatalf("removeBatch: %v", err)
+			}
+			if n > maxTx {
+				maxTx = n
+			}
+			if n < bf.batchSize {
+				break
+			}
+		}
+	}
+	if maxTx > bf.batchSize {
+		b.Fatalf("transaction deleted %d keys, limit %d", maxTx, bf.batchSize)
+	}
+	b.ReportMetric(float64(maxTx), "keys/tx")
+}
+
+// newTestFs 在临时目录中创建一个文件系统, 测试结束时自动关闭
+func newTestFs(t testing.TB, opts ...Option) *BBolt {
+	t.Helper()
+	fs, err := New(mustTmpFile(t), opts...)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { fs.Close() })
+	return fs.(*BBolt)
+}
+
+// readAll 读取文件的全部内容
+func readAll(t testing.TB, fs Fs, name string) string {
+	t.Helper()
+	f, err := fs.Open(name)
+	if err != nil {
+		t.Fatalf("Open %s: %v", name, err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("ReadAll %s: %v", name, err)
+	}
+	return string(data)
+}
+
+func TestBBoltFs_SeekThenRead(t *testing.T) {
+	fs := newTestFs(t)
+	f, _ := fs.CreateWith("seek.txt", []byte("0123456789"), 0644)
+	f.Close()
+
+	f, err := fs.Open("seek.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	buf := make([]byte, 3)
+	if n, err := f.Read(buf); err != nil || string(buf[:n]) != "012" {
+		t.Fatalf("Read = %q, %v", buf[:n], err)
+	}
+	if _, err := f.Seek(5, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := f.Read(buf); err != nil || string(buf[:n]) != "567" {
+		t.Errorf("Read after Seek = %q, %v; want 567", buf[:n], err)
+	}
+	// Read 不影响 ReadAt 看到的内容
+	if n, err := f.ReadAt(buf, 0); err != nil || string(buf[:n]) != "012" {
+		t.Errorf("ReadAt after Read = %q, %v", buf[:n], err)
+	}
+	if _, err := f.Seek(1, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if rest, err := io.ReadAll(f); err != nil || string(rest) != "123456789" {
+		t.Errorf("ReadAll after Seek = %q, %v", rest, err)
+	}
+	if n, err := f.Read(buf); n != 0 || err != io.EOF {
+		t.Errorf("Read at end = %d, %v; want EOF", n, err)
+	}
+}
+
+func TestBBoltFs_SeekWhence(t *testing.T) {
+	fs := newTestFs(t)
+	f, _ := fs.CreateWith("whence.txt", []byte("0123456789"), 0644)
+	f.Close()
+
+	f, err := fs.Open("whence.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	buf := make([]byte, 4)
+	if _, err := f.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	if pos, err := f.Seek(0, io.SeekCurrent); err != nil || pos != 4 {
+		t.Errorf("Seek(0, SeekCurrent) = %d, %v; want 4", pos, err)
+	}
+	if pos, err := f.Seek(2, io.SeekCurrent); err != nil || pos != 6 {
+		t.Errorf("Seek(2, SeekCurrent) = %d, %v; want 6", pos, err)
+	}
+	if pos, err := f.Seek(0, io.SeekEnd); err != nil || pos != 10 {
+		t.Errorf("Seek(0, SeekEnd) = %d, %v; want 10", pos, err)
+	}
+	if pos, err := f.Seek(-3, io.SeekEnd); err != nil || pos != 7 {
+		t.Errorf("Seek(-3, SeekEnd) = %d, %v; want 7", pos, err)
+	}
+	if n, err := f.Read(buf); err != nil || string(buf[:n]) != "789" {
+		t.Errorf("Read after SeekEnd = %q, %v; want 789", buf[:n], err)
+	}
+	if _, err := f.Seek(-11, io.SeekEnd); err == nil {
+		t.Error("Seek before start succeeded")
+	}
+}
+
+func TestBBoltFs_CreateWith(t *testing.T) {
+	fs := newTestFs(t)
+
+	want := "template body"
+	f, err := fs.CreateWith("tpl.txt", []byte(want), 0640)
+	if err != nil {
+		t.Fatalf("CreateWith: %v", err)
+	}
+	defer f.Close()
+	if pos, _ := f.Seek(0, io.SeekCurrent); pos != int64(len(want)) {
+		t.Errorf("position = %d, want %d", pos, len(want))
+	}
+	buf := make([]byte, 100)
+	n, err := f.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		t.Fatalf("ReadAt: %v", err)
+	}
+	if got := string(buf[:n]); got != want {
+		t.Errorf("ReadAt = %q, want %q", got, want)
+	}
+	if got := readAll(t, fs, "tpl.txt"); got != want {
+		t.Errorf("content = %q, want %q", got, want)
+	}
+	info, err := fs.Stat("tpl.txt")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Mode().Perm() != 0640 || info.Size() != int64(len(want)) {
+		t.Errorf("Stat = %v/%d, want %v/%d", info.Mode(), info.Size(), os.FileMode(0640), len(want))
+	}
+
+	// CreateAtStart 时位置在开头, Read 直接读出内容, Write 从头覆盖
+	g, err := fs.CreateWith("start.txt", []byte(want), 0644, CreateAtStart)
+	if err != nil {
+		t.Fatalf("CreateWith(CreateAtStart): %v", err)
+	}
+	defer g.Close()
+	if pos, _ := g.Seek(0, io.SeekCurrent); pos != 0 {
+		t.Errorf("position = %d, want 0", pos)
+	}
+	if n, err = g.Read(buf[:8]); err != nil || string(buf[:n]) != "template" {
+		t.Errorf("Read = %q, %v", buf[:n], err)
+	}
+	if _, err = g.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = g.Write([]byte("TEMPLATE")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, fs, "start.txt"); got != "TEMPLATE body" {
+		t.Errorf("content = %q, want %q", got, "TEMPLATE body")
+	}
+}
+
+func TestBBoltFs_ReadOnlyMedium(t *testing.T) {
+	dbfile := mustTmpFile(t)
+	fs, err := New(dbfile)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	f, _ := fs.Create("ro.txt")
+	f.WriteString("data")
+	f.Close()
+	fs.Close()
+
+	ro, err := New(dbfile, WithReadOnly())
+	if err != nil {
+		t.Fatalf("New(WithReadOnly): %v", err)
+	}
+	if !ro.(*BBolt).ReadOnly() {
+		t.Errorf("ReadOnly() = false, want true")
+	}
+	if got := readAll(t, ro, "ro.txt"); got != "data" {
+		t.Errorf("content = %q, want %q", got, "data")
+	}
+	if _, err := ro.Create("new.txt"); err == nil {
+		t.Errorf("Create on read-only fs should fail")
+	}
+	ro.Close()
+
+	// 模拟只读挂载: 以读写方式打开时返回 EROFS
+	orig := boltOpen
+	t.Cleanup(func() { boltOpen = orig })
+	boltOpen = func(path string, mode os.FileMode, options *bbolt.Options) (*bbolt.DB, error) {
+		if !options.ReadOnly {
+			return nil, &os.PathError{Op: "open", Path: path, Err: syscall.EROFS}
+		}
+		return orig(path, mode, options)
+	}
+	fallback, err := New(dbfile)
+	if err != nil {
+		t.Fatalf("New on read-only medium: %v", err)
+	}
+	if !fallback.(*BBolt).ReadOnly() {
+		t.Errorf("ReadOnly() = false after fallback, want true")
+	}
+	if got := readAll(t, fallback, "ro.txt"); got != "data" {
+		t.Errorf("content = %q, want %q", got, "data")
+	}
+	fallback.Close()
+
+	if _, err := New(filepath.Join(t.TempDir(), "missing.db")); !errors.Is(err, ErrReadOnlyMedium) {
+		t.Errorf("New of missing db on read-only medium = %v, want ErrReadOnlyMedium", err)
+	}
+}
+
+func TestBBoltFs_BackslashSeparator(t *testing.T) {
+	fs := newTestFs(t, WithBackslashSeparator())
+
+	if err := fs.MkdirAll(`dir\sub`, 0755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	f, err := fs.Create(`dir\sub\file.txt`)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	f.WriteString("win")
+	f.Close()
+
+	if got := readAll(t, fs, "dir/sub/file.txt"); got != "win" {
+		t.Errorf("content = %q, want %q", got, "win")
+	}
+	if info, err := fs.Stat("dir/sub"); err != nil || !info.IsDir() {
+		t.Errorf("Stat(dir/sub) = %v, %v", info, err)
+	}
+	d, err := fs.Open(`dir\sub`)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	names, _ := d.Readdirnames(0)
+	if len(names) != 1 || names[0] != "file.txt" {
+		t.Errorf("Readdirnames = %v, want [file.txt]", names)
+	}
+
+	// 未开启选项时 '\' 是普通的文件名字符
+	plain := newTestFs(t)
+	f, _ = plain.Create(`a\b.txt`)
+	f.Close()
+	if _, err := plain.Stat("a/b.txt"); err == nil {
+		t.Errorf(`a\b.txt should not resolve to a/b.txt without the option`)
+	}
+}
+
+func TestBBoltFs_Interfaces(t *testing.T) {
+	var fs Fs = newTestFs(t)
+
+	if fs.Name() == "" {
+		t.Errorf("Name() is empty")
+	}
+	if err := fs.Mkdir("d", 0755); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	if err := fs.MkdirAll("d/e/f", 0755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+
+	var f File
+	f, err := fs.Create("d/file.txt")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if f.Name() != "d/file.txt" {
+		t.Errorf("File.Name() = %q", f.Name())
+	}
+	if _, err := f.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if _, err := f.WriteString(" world"); err != nil {
+		t.Fatalf("WriteString: %v", err)
+	}
+	if _, err := f.WriteAt([]byte("H"), 0); err != nil {
+		t.Fatalf("WriteAt: %v", err)
+	}
+	buf := make([]byte, 5)
+	if n, err := f.ReadAt(buf, 6); err != nil || string(buf[:n]) != "world" {
+		t.Errorf("ReadAt = %q, %v", buf[:n], err)
+	}
+	if info, err := f.Stat(); err != nil || info.Size() != 11 {
+		t.Errorf("File.Stat = %v, %v", info, err)
+	}
+	if err := f.Sync(); err != nil {
+		t.Errorf("Sync: %v", err)
+	}
+	if err := f.Truncate(5); err != nil {
+		t.Errorf("File.Truncate: %v", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Errorf("Seek: %v", err)
+	}
+	if n, err := f.Read(buf); err != nil || string(buf[:n]) != "Hello" {
+		t.Errorf("Read = %q, %v", buf[:n], err)
+	}
+	if err := f.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+
+	if err := fs.Truncate("d/file.txt", 2); err != nil {
+		t.Fatalf("Fs.Truncate: %v", err)
+	}
+	if got := readAll(t, fs, "d/file.txt"); got != "He" {
+		t.Errorf("content after Truncate = %q, want %q", got, "He")
+	}
+	if err := fs.Chmod("d/file.txt", 0600); err != nil {
+		t.Errorf("Chmod: %v", err)
+	}
+	if err := fs.Chown("d/file.txt", 1, 1); err != nil {
+		t.Errorf("Chown: %v", err)
+	}
+	now := time.Now()
+	if err := fs.Chtimes("d/file.txt", now, now); err != nil {
+		t.Errorf("Chtimes: %v", err)
+	}
+	if info, err := fs.Stat("d/file.txt"); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Stat = %v, %v", info, err)
+	}
+
+	entries, err := fs.ReadDir("d")
+	if err != nil {
+		t.Fatalf("Fs.ReadDir: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Name() != "e" || !entries[0].IsDir() ||
+		entries[1].Name() != "file.txt" || entries[1].IsDir() {
+		t.Errorf("Fs.ReadDir = %v", entries)
+	}
+	if _, err := fs.ReadDir("missing"); err == nil {
+		t.Errorf("ReadDir of missing dir should fail")
+	}
+	var pe *os.PathError
+	if entries, err := fs.ReadDir("d/file.txt"); !errors.As(err, &pe) || !errors.Is(err, ErrNotDirectory) {
+		t.Errorf("ReadDir of file = %v, %v, want PathError with ErrNotDirectory", entries, err)
+	}
+
+	var d File
+	d, err = fs.OpenFile("d", os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("OpenFile dir: %v", err)
+	}
+	if entries, err := d.ReadDir(0); err != nil || len(entries) != 2 {
+		t.Errorf("File.ReadDir = %v, %v", entries, err)
+	}
+	if names, err := d.Readdirnames(0); err != nil || len(names) != 2 {
+		t.Errorf("Readdirnames = %v, %v", names, err)
+	}
+	if infos, err := d.Readdir(0); err != nil || len(infos) != 2 {
+		t.Errorf("Readdir = %v, %v", infos, err)
+	}
+	if info, err := d.Stat(); err != nil || !info.IsDir() {
+		t.Errorf("dir Stat = %v, %v", info, err)
+	}
+	if _, err := d.Write([]byte("x")); err == nil {
+		t.Errorf("Write on dir should fail")
+	}
+	d.Close()
+
+	if err := fs.Rename("d/file.txt", "d/renamed.txt"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if err := fs.Remove("d/renamed.txt"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := fs.RemoveAll("d"); err != nil {
+		t.Fatalf("RemoveAll: %v", err)
+	}
+	if _, err := fs.Stat("d"); err == nil {
+		t.Errorf("d should be removed")
+	}
+	if err := fs.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
+
+func TestBBoltFs_SyncOnClose(t *testing.T) {
+	dbfile := mustTmpFile(t)
+	fs, err := New(dbfile, WithSyncOnClose())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	f, err := fs.Create("durable.txt")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	f.WriteString("persisted")
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := fs.Close(); err != nil {
+		t.Fatalf("fs.Close: %v", err)
+	}
+
+	fs, err = New(dbfile)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer fs.Close()
+	if got := readAll(t, fs, "durable.txt"); got != "persisted" {
+		t.Errorf("content = %q, want %q", got, "persisted")
+	}
+}
+
+func TestBBoltFs_SyncOnCreate(t *testing.T) {
+	dbfile := mustTmpFile(t)
+	fs, err := New(dbfile, WithSyncOnCreate())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := fs.Mkdir("dir", 0755); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	fi, _ := fs.Stat("dir")
+	old := fi.ModTime()
+	time.Sleep(time.Millisecond)
+	if _, err := fs.Create("dir/new.txt"); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	fi, _ = fs.Stat("dir")
+	mtime := fi.ModTime()
+	if !mtime.After(old) {
+		t.Fatalf("parent mtime not updated: %v", mtime)
+	}
+	// 不关闭文件句柄, 直接关闭数据库
+	if err := fs.(*BBolt).db.Close(); err != nil {
+		t.Fatalf("db.Close: %v", err)
+	}
+
+	fs, err = New(dbfile)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer fs.Close()
+	if _, err := fs.Stat("dir/new.txt"); err != nil {
+		t.Fatalf("Stat after reopen: %v", err)
+	}
+	entries, err := fs.ReadDir("dir")
+	if err != nil || len(entries) != 1 || entries[0].Name() != "new.txt" {
+		t.Fatalf("ReadDir = %v, %v; want [new.txt]", entries, err)
+	}
+	if fi, _ := fs.Stat("dir"); !fi.ModTime().Equal(mtime) {
+		t.Errorf("parent mtime = %v, want %v", fi.ModTime(), mtime)
+	}
+}
+
+func TestBBoltFs_Append(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"inline", nil},
+		{"chunked", []Option{WithInlineThreshold(64)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := newTestFs(t, tc.opts...)
+			const writers, lines = 8, 50
+			var wg sync.WaitGroup
+			for w := 0; w < writers; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					for i := 0; i < lines; i++ {
+						line := fmt.Sprintf("w%d-%02d\n", w, i)
+						if n, err := fs.Append("app.log", []byte(line)); err != nil || n != len(line) {
+							t.Errorf("Append = %d, %v", n, err)
+							return
+						}
+					}
+				}(w)
+			}
+			wg.Wait()
+
+			got := strings.Split(strings.TrimSuffix(readAll(t, fs, "app.log"), "\n"), "\n")
+			if len(got) != writers*lines {
+				t.Fatalf("got %d lines, want %d", len(got), writers*lines)
+			}
+			seen := make(map[string]bool)
+			for _, line := range got {
+				seen[line] = true
+			}
+			for w := 0; w < writers; w++ {
+				for i := 0; i < lines; i++ {
+					if line := fmt.Sprintf("w%d-%02d", w, i); !seen[line] {
+						t.Errorf("line %q lost", line)
+					}
+				}
+			}
+		})
+	}
+
+	fs := newTestFs(t)
+	_ = fs.Mkdir("dir", 0755)
+	if _, err := fs.Append("dir", []byte("x")); !errors.Is(err, ErrIsDirectory) {
+		t.Errorf("Append(dir) = %v, want ErrIsDirectory", err)
+	}
+}
+
+func TestBBoltFs_OpenFileAppend(t *testing.T) {
+	fs := newTestFs(t)
+	const flag = os.O_APPEND | os.O_WRONLY | os.O_CREATE
+	for _, line := range []string{"first\n", "second\n"} {
+		f, err := fs.OpenFile("append.log", flag, 0644)
+		if err != nil {
+			t.Fatalf("OpenFile: %v", err)
+		}
+		if _, err = f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+	if got := readAll(t, fs, "append.log"); got != "first\nsecond\n" {
+		t.Errorf("content = %q", got)
+	}
+
+	// 同时打开的两个句柄互不覆盖
+	a, _ := fs.OpenFile("append.log", flag, 0644)
+	b, _ := fs.OpenFile("append.log", flag, 0644)
+	_, _ = a.Write([]byte("a\n"))
+	_, _ = b.Write([]byte("b\n"))
+	_ = a.Close()
+	_ = b.Close()
+	if got := readAll(t, fs, "append.log"); got != "first\nsecond\na\nb\n" {
+		t.Errorf("content = %q", got)
+	}
+
+	if _, err := fs.OpenFile("missing.log", os.O_APPEND|os.O_WRONLY, 0644); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("OpenFile(missing) = %v, want ErrFileNotFound", err)
+	}
+}
+
+func TestBBoltFs_OpenFileExcl(t *testing.T) {
+	fs := newTestFs(t)
+	const flag = os.O_CREATE | os.O_EXCL | os.O_WRONLY
+	f, err := fs.OpenFile("lock", flag, 0600)
+	if err != nil {
+		t.Fatalf("first OpenFile: %v", err)
+	}
+	_, _ = f.Write([]byte("owner"))
+	_ = f.Close()
+	if _, err = fs.OpenFile("lock", flag, 0600); !errors.Is(err, os.ErrExist) {
+		t.Fatalf("second OpenFile = %v, want ErrExist", err)
+	}
+	if got := readAll(t, fs, "lock"); got != "owner" {
+		t.Errorf("content = %q, want owner", got)
+	}
+	_ = fs.Mkdir("dir", 0755)
+	if _, err = fs.OpenFile("dir", flag, 0600); !errors.Is(err, os.ErrExist) {
+		t.Errorf("OpenFile(dir) = %v, want ErrExist", err)
+	}
+
+	// 并发创建同一路径时只有一个成功
+	var wg sync.WaitGroup
+	var won atomic.Int32
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if f, err := fs.OpenFile("race", flag, 0600); err == nil {
+				won.Add(1)
+				_ = f.Close()
+			} else if !errors.Is(err, os.ErrExist) {
+				t.Errorf("OpenFile(race) = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := won.Load(); n != 1 {
+		t.Errorf("%d goroutines created the file, want 1", n)
+	}
+}
+
+func TestBBoltFs_ReadWriteString(t *testing.T) {
+	fs := newTestFs(t, WithInlineThreshold(8))
+	_ = fs.Mkdir("conf", 0755)
+	for _, content := range []string{"", "名称 = 测试\nlang = 中文 ✓\n", "short"} {
+		if err := fs.WriteString("conf/app.ini", content, 0644); err != nil {
+			t.Fatalf("WriteString(%q): %v", content, err)
+		}
+		got, err := fs.ReadString("conf/app.ini")
+		if err != nil {
+			t.Fatalf("ReadString: %v", err)
+		}
+		if got != content {
+			t.Errorf("ReadString = %q, want %q", got, content)
+		}
+	}
+	if fi, _ := fs.Stat("conf/app.ini"); fi.Mode().Perm() != 0644 {
+		t.Errorf("mode = %v, want 0644", fi.Mode())
+	}
+	if _, err := fs.ReadString("missing"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("ReadString(missing) = %v, want ErrFileNotFound", err)
+	}
+	if _, err := fs.ReadString("conf"); !errors.Is(err, ErrIsDirectory) {
+		t.Errorf("ReadString(dir) = %v, want ErrIsDirectory", err)
+	}
+}
+
+func TestBBoltFs_OpenFileTrunc(t *testing.T) {
+	fs := newTestFs(t)
+	f, _ := fs.CreateWith("data.db", []byte("0123456789"), 0644)
+	f.Close()
+
+	// O_RDWR 保留原有内容, 可以原地改写
+	f, err := fs.OpenFile("data.db", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := io.ReadAll(f); string(data) != "0123456789" {
+		t.Errorf("read after O_RDWR = %q", data)
+	}
+	if _, err = f.WriteAt([]byte("AB"), 2); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	if got := readAll(t, fs, "data.db"); got != "01AB456789" {
+		t.Errorf("content after in-place write = %q", got)
+	}
+
+	// O_CREATE 打开已有文件同样不清空
+	f, _ = fs.OpenFile("data.db", os.O_CREATE|os.O_WRONLY, 0644)
+	_ = f.Close()
+	if got := readAll(t, fs, "data.db"); got != "01AB456789" {
+		t.Errorf("content after O_CREATE = %q", got)
+	}
+
+	f, err = fs.OpenFile("data.db", os.O_RDWR|os.O_TRUNC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	if fi, _ := fs.Stat("data.db"); fi.Size() != 0 || fi.Mode().Perm() != 0644 {
+		t.Errorf("after O_TRUNC size = %d, mode = %v", fi.Size(), fi.Mode())
+	}
+
+	if _, err = fs.OpenFile("missing.db", os.O_RDWR, 0); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("OpenFile(missing, O_RDWR) = %v, want ErrFileNotFound", err)
+	}
+	_ = fs.Mkdir("dir", 0755)
+	if _, err = fs.OpenFile("dir", os.O_RDWR, 0); !errors.Is(err, ErrIsDirectory) {
+		t.Errorf("OpenFile(dir, O_RDWR) = %v, want ErrIsDirectory", err)
+	}
+}
+
+func TestBBoltFs_LazyRead(t *testing.T) {
+	fs := newTestFs(t, WithLazyRead(), WithInlineThreshold(64<<10))
+	body := bytes.Repeat([]byte("0123456789abcdef"), 1<<20)
+	f, _ := fs.CreateWith("huge.bin", body, 0644)
+	f.Close()
+
+	// 打开后只调用 Stat 不应读取文件内容
+	f, err := fs.Open("huge.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != int64(len(body)) {
+		t.Errorf("Stat size = %d, want %d", fi.Size(), len(body))
+	}
+	if bf := f.(*bboltFile); bf.buffer.Len() != 0 || bf.base != int64(len(body)) {
+		t.Errorf("Open+Stat loaded %d bytes, base = %d", bf.buffer.Len(), bf.base)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, body) {
+		t.Errorf("lazy read returned %d bytes, want %d", len(data), len(body))
+	}
+	_ = f.Close()
+
+	// 未读取内容的句柄定位到末尾后追加, 不需要读入已有内容
+	f, _ = fs.OpenFile("huge.bin", os.O_WRONLY, 0)
+	if _, err = f.Seek(0, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.Write([]byte("tail")); err != nil {
+		t.Fatal(err)
+	}
+	if bf := f.(*bboltFile); bf.buffer.Len() > len("tail") {
+		t.Errorf("append after Seek loaded %d bytes", bf.buffer.Len())
+	}
+	_ = f.Close()
+	if got := readAll(t, fs, "huge.bin"); got != string(body)+"tail" {
+		t.Errorf("content size after write = %d, want %d", len(got), len(body)+4)
+	}
+
+	// 默认仍在 Open 时读取全部内容
+	eager := newTestFs(t)
+	f, _ = eager.CreateWith("small.txt", []byte("hello"), 0644)
+	f.Close()
+	f, _ = eager.Open("small.txt")
+	if bf := f.(*bboltFile); bf.buffer.Len() != 5 || bf.base != 0 {
+		t.Errorf("eager Open loaded %d bytes, base = %d", bf.buffer.Len(), bf.base)
+	}
+	_ = f.Close()
+}
+
+func TestBBoltFile_WriteAtOffset(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithWriteBuffer(1 << 20)}, {WithLazyRead()}} {
+		fs := newTestFs(t, opts...)
+		f, _ := fs.CreateWith("msg", []byte("hello world"), 0644)
+		f.Close()
+
+		// Write 从当前位置覆盖写入并移动位置
+		f, err := fs.OpenFile("msg", os.O_RDWR, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = f.Write([]byte("HE")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = f.Seek(6, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = f.Write([]byte("W")); err != nil {
+			t.Fatal(err)
+		}
+		rest, _ := io.ReadAll(f)
+		if string(rest) != "orld" {
+			t.Errorf("read after Seek+Write = %q, want %q", rest, "orld")
+		}
+		_ = f.Close()
+		if got := readAll(t, fs, "msg"); got != "HEllo World" {
+			t.Errorf("content = %q, want %q", got, "HEllo World")
+		}
+
+		// Write 之后位置在写入的末尾
+		f, _ = fs.Create("new")
+		if _, err = f.Write([]byte("abc")); err != nil {
+			t.Fatal(err)
+		}
+		if n, err := f.Read(make([]byte, 8)); n != 0 || err != io.EOF {
+			t.Errorf("Read after Write = %d, %v, want 0, EOF", n, err)
+		}
+		if pos, _ := f.Seek(0, io.SeekCurrent); pos != 3 {
+			t.Errorf("position after Write = %d, want 3", pos)
+		}
+		_, _ = f.Seek(0, io.SeekStart)
+		if data, _ := io.ReadAll(f); string(data) != "abc" {
+			t.Errorf("read from start = %q", data)
+		}
+		_ = f.Close()
+	}
+}
+
+func TestBBoltFs_ExclusiveCreate(t *testing.T) {
+	fs := newTestFs(t, WithExclusiveCreate())
+	f, err := fs.CreateWith("only.txt", []byte("first"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	if _, err = fs.OpenFile("only.txt", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644); !errors.Is(err, os.ErrExist) {
+		t.Errorf("OpenFile(O_EXCL) = %v, want ErrExist", err)
+	}
+	if _, err = fs.CreateWith("only.txt", []byte("second"), 0644); !errors.Is(err, os.ErrExist) {
+		t.Errorf("CreateWith = %v, want ErrExist", err)
+	}
+	if _, err = fs.Create("only.txt"); !errors.Is(err, os.ErrExist) {
+		t.Errorf("Create = %v, want ErrExist", err)
+	}
+	if err = fs.WriteString("only.txt", "third", 0644); !errors.Is(err, os.ErrExist) {
+		t.Errorf("WriteString = %v, want ErrExist", err)
+	}
+	err = fs.Do(func(tx *TxFs) error {
+		_, err := tx.Create("only.txt")
+		return err
+	})
+	if !errors.Is(err, os.ErrExist) {
+		t.Errorf("TxFs.Create = %v, want ErrExist", err)
+	}
+	if got := readAll(t, fs, "only.txt"); got != "first" {
+		t.Errorf("content = %q, want first", got)
+	}
+
+	// 打开已有文件不受影响
+	if f, err = fs.OpenFile("only.txt", os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+		t.Errorf("OpenFile(O_CREATE) on existing file: %v", err)
+	} else {
+		_ = f.Close()
+	}
+	if err = fs.WriteString("other.txt", "new", 0644); err != nil {
+		t.Errorf("WriteString(new file): %v", err)
+	}
+}
+
+func TestBBoltFs_NewSectionReader(t *testing.T) {
+	fs := newTestFs(t)
+	f, _ := fs.CreateWith("section.bin", []byte("0123456789abcdef"), 0644)
+	f.Close()
+
+	sr, err := fs.NewSectionReader("section.bin", 4, 6)
+	if err != nil {
+		t.Fatalf("NewSectionReader: %v", err)
+	}
+	if sr.Size() != 6 {
+		t.Errorf("Size = %d, want 6", sr.Size())
+	}
+	data, err := io.ReadAll(sr)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(data) != "456789" {
+		t.Errorf("section = %q, want %q", data, "456789")
+	}
+	buf := make([]byte, 4)
+	n, err := sr.ReadAt(buf, 4)
+	if string(buf[:n]) != "89" || err != io.EOF {
+		t.Errorf("ReadAt past section = %q, %v, want %q, EOF", buf[:n], err, "89")
+	}
+
+	// 超出文件末尾的区间读取到文件结尾为止
+	sr, _ = fs.NewSectionReader("section.bin", 12, 10)
+	if data, _ := io.ReadAll(sr); string(data) != "cdef" {
+		t.Errorf("tail section = %q, want %q", data, "cdef")
+	}
+
+	_ = fs.Mkdir("dir", 0755)
+	if _, err := fs.NewSectionReader("dir", 0, 1); !errors.Is(err, ErrIsDirectory) {
+		t.Errorf("NewSectionReader(dir) = %v, want ErrIsDirectory", err)
+	}
+}
+
+func TestBBoltFs_OpenBuffered(t *testing.T) {
+	fs := newTestFs(t)
+
+	f, err := fs.OpenBuffered("app.log", 64)
+	if err != nil {
+		t.Fatalf("OpenBuffered: %v", err)
+	}
+	want := ""
+	before := fs.saves.Load()
+	for i := 0; i < 100; i++ {
+		line := fmt.Sprintf("line %02d\n", i)
+		if _, err := f.WriteString(line); err != nil {
+			t.Fatalf("WriteString: %v", err)
+		}
+		want += line
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if saves := fs.saves.Load() - before; saves > int64(len(want)/64+1) {
+		t.Errorf("buffered writes caused %d saves, want at most %d", saves, len(want)/64+1)
+	}
+	if got := readAll(t, fs, "app.log"); got != want {
+		t.Errorf("content = %q, want %q", got, want)
+	}
+
+	// 重新打开已存在的文件继续追加, Sync 会立即写入
+	f, err = fs.OpenBuffered("app.log", 1<<20)
+	if err != nil {
+		t.Fatalf("OpenBuffered existing: %v", err)
+	}
+	f.WriteString("tail\n")
+	if err := f.Sync(); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if got := readAll(t, fs, "app.log"); got != want+"tail\n" {
+		t.Errorf("content after Sync = %q", got)
+	}
+	f.Close()
+}
+
+func BenchmarkBBoltFs_SmallAppends(b *testing.B) {
+	for _, bufSize := range []int{0, 4096} {
+		b.Run(fmt.Sprintf("buf=%d", bufSize), func(b *testing.B) {
+			fs := newTestFs(b)
+			f, err := fs.OpenBuffered("bench.log", bufSize)
+			if err != nil {
+				b.Fatalf("OpenBuffered: %v", err)
+			}
+			before := fs.saves.Load()
+			for i := 0; i < b.N; i++ {
+				f.WriteString("a small log line\n")
+			}
+			f.Close()
+			b.ReportMetric(float64(fs.saves.Load()-before)/float64(b.N), "saves/op")
+		})
+	}
+}
+
+func TestBBoltFs_WriteBuffer(t *testing.T) {
+	fs := newTestFs(t, WithWriteBuffer(1<<20))
+	f, err := fs.Create("big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunk := bytes.Repeat([]byte("x"), 4096)
+	before := fs.saves.Load()
+	for i := 0; i < 64; i++ {
+		if _, err = f.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if saves := fs.saves.Load() - before; saves != 0 {
+		t.Errorf("buffered writes caused %d saves before Sync", saves)
+	}
+	if fi, _ := fs.Stat("big.bin"); fi.Size() != 0 {
+		t.Errorf("size before Sync = %d, want 0", fi.Size())
+	}
+	if err = f.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := fs.Stat("big.bin"); fi.Size() != 64*4096 {
+		t.Errorf("size after Sync = %d, want %d", fi.Size(), 64*4096)
+	}
+	if _, err = f.WriteAt([]byte("end"), 64*4096); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	if saves := fs.saves.Load() - before; saves != 2 {
+		t.Errorf("Sync + Close caused %d saves, want 2", saves)
+	}
+	if got := readAll(t, fs, "big.bin"); len(got) != 64*4096+3 || !strings.HasSuffix(got, "end") {
+		t.Errorf("content size = %d", len(got))
+	}
+
+	// 超过阈值时不等 Sync 也会写入
+	f, _ = fs.OpenFile("big.bin", os.O_WRONLY|os.O_TRUNC, 0)
+	before = fs.saves.Load()
+	for i := 0; i < 512; i++ {
+		_, _ = f.Write(chunk)
+	}
+	if saves := fs.saves.Load() - before; saves != 2 {
+		t.Errorf("2 MiB through a 1 MiB buffer caused %d saves, want 2", saves)
+	}
+	_ = f.Close()
+	if fi, _ := fs.Stat("big.bin"); fi.Size() != 512*4096 {
+		t.Errorf("size after Close = %d, want %d", fi.Size(), 512*4096)
+	}
+}
+
+// BenchmarkBBoltFs_SequentialWrite 以 4 KiB 为单位顺序写入 1 MiB 的文件, puts/op 为每个文件写入数据库的次数
+func BenchmarkBBoltFs_SequentialWrite(b *testing.B) {
+	chunk := make([]byte, 4096)
+	for _, buf := range []int{0, 4 << 20} {
+		b.Run(fmt.Sprintf("buf=%d", buf), func(b *testing.B) {
+			fs := newTestFs(b, WithWriteBuffer(buf))
+			b.SetBytes(1 << 20)
+			before := fs.saves.Load()
+			for i := 0; i < b.N; i++ {
+				f, err := fs.Create("seq.bin")
+				if err != nil {
+					b.Fatal(err)
+				}
+				for n := 0; n < 1<<20; n += len(chunk) {
+					_, _ = f.Write(chunk)
+				}
+				f.Close()
+			}
+			b.ReportMetric(float64(fs.saves.Load()-before)/float64(b.N), "puts/op")
+		})
+	}
+}
+
+func TestBBoltFs_OpTimeout(t *testing.T) {
+	fs := newTestFs(t, WithOpTimeout(20*time.Millisecond))
+
+	if err := fs.Mkdir("fast", 0755); err != nil {
+		t.Fatalf("Mkdir without delay: %v", err)
+	}
+
+	release := make(chan struct{})
+	fs.updateHook = func() { <-release }
+	err := fs.Mkdir("slow", 0755)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Mkdir on slow disk = %v, want DeadlineExceeded", err)
+	}
+	// 超时的事务在后台继续执行并最终提交
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := fs.Stat("slow"); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("background transaction never committed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFileInfo_DirEntry(t *testing.T) {
+	fs := newTestFs(t)
+	_ = fs.Mkdir("dir", 0750)
+	f, _ := fs.CreateWith("dir/file.txt", []byte("abc"), 0640)
+	f.Close()
+
+	entries, err := fs.ReadDir("dir")
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("ReadDir = %v", entries)
+	}
+	if _, ok := entries[0].(*fileInfo); !ok {
+		t.Errorf("entry type = %T, want *fileInfo", entries[0])
+	}
+
+	for _, name := range []string{"dir", "dir/file.txt"} {
+		info, err := fs.Stat(name)
+		if err != nil {
+			t.Fatalf("Stat %s: %v", name, err)
+		}
+		var de os.DirEntry = info.(*fileInfo)
+		if de.Name() != info.Name() || de.IsDir() != info.IsDir() {
+			t.Errorf("%s: DirEntry name/isDir = %s/%v, FileInfo = %s/%v", name, de.Name(), de.IsDir(), info.Name(), info.IsDir())
+		}
+		if de.Type() != info.Mode().Type() || de.Type()&os.ModePerm != 0 {
+			t.Errorf("%s: Type() = %v, want only type bits of %v", name, de.Type(), info.Mode())
+		}
+		fi, err := de.Info()
+		if err != nil || fi.Size() != info.Size() || fi.Mode() != info.Mode() || !fi.ModTime().Equal(info.ModTime()) {
+			t.Errorf("%s: Info() = %v, %v", name, fi, err)
+		}
+	}
+}
+
+func TestBBoltFs_OpenHandles(t *testing.T) {
+	fs := newTestFs(t)
+	_ = fs.Mkdir("dir", 0755)
+
+	a, _ := fs.Create("a.txt")
+	b, _ := fs.Create("b.txt")
+	b2, _ := fs.Open("b.txt")
+	d, _ := fs.Open("dir")
+	if got, want := fs.OpenHandles(), []string{"a.txt", "b.txt", "b.txt", "dir"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("OpenHandles = %v, want %v", got, want)
+	}
+
+	a.Close()
+	b.Close()
+	b.Close() // 重复关闭不应出错
+	if got, want := fs.OpenHandles(), []string{"b.txt", "dir"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("OpenHandles after close = %v, want %v", got, want)
+	}
+	b2.Close()
+	d.Close()
+	if got := fs.OpenHandles(); len(got) != 0 {
+		t.Errorf("OpenHandles after closing all = %v", got)
+	}
+}
+
+func TestBBoltFile_Deadlines(t *testing.T) {
+	fs := newTestFs(t)
+	f, _ := fs.CreateWith("deadline.txt", []byte("data"), 0644)
+	defer f.Close()
+	bf := f.(*bboltFile)
+
+	buf := make([]byte, 4)
+	if _, err := bf.ReadAt(buf, 0); err != nil {
+		t.Fatalf("ReadAt without deadline: %v", err)
+	}
+	past := time.Now().Add(-time.Second)
+	bf.SetReadDeadline(past)
+	if _, err := bf.Read(buf); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Read after deadline = %v, want ErrDeadlineExceeded", err)
+	}
+	if _, err := bf.ReadAt(buf, 0); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("ReadAt after deadline = %v, want ErrDeadlineExceeded", err)
+	}
+	if _, err := bf.Write([]byte("x")); err != nil {
+		t.Errorf("Write with only a read deadline = %v", err)
+	}
+
+	bf.SetWriteDeadline(past)
+	if _, err := bf.WriteString("x"); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Write after deadline = %v, want ErrDeadlineExceeded", err)
+	}
+
+	bf.SetDeadline(time.Time{})
+	if _, err := bf.ReadAt(buf, 0); err != nil {
+		t.Errorf("ReadAt after clearing deadline = %v", err)
+	}
+	bf.SetDeadline(time.Now().Add(time.Hour))
+	if _, err := bf.WriteAt([]byte("D"), 0); err != nil {
+		t.Errorf("WriteAt before deadline = %v", err)
+	}
+}
+
+func TestBBoltFs_CompareAndSwap(t *testing.T) {
+	fs := newTestFs(t, WithInlineThreshold(8))
+	for _, name := range []string{"/small", "/big"} {
+		content := "v0"
+		if name == "/big" {
+			content = strings.Repeat("v0", 10)
+		}
+		if _, err := fs.CreateWith(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := fs.CompareAndSwap(name, []byte("other"), []byte("x")); err != nil || ok {
+			t.Fatalf("%s: mismatched swap = %v, %v", name, ok, err)
+		}
+		if ok, err := fs.CompareAndSwap(name, []byte(content), []byte("v1")); err != nil || !ok {
+			t.Fatalf("%s: swap = %v, %v", name, ok, err)
+		}
+		if got := readAll(t, fs, name); got != "v1" {
+			t.Fatalf("%s: content = %q, want v1", name, got)
+		}
+	}
+	if _, err := fs.CompareAndSwap("/missing", nil, nil); !errors.Is(err, ErrFileNotFound) {
+		t.Fatalf("missing file: err = %v", err)
+	}
+
+	// 两个写入方基于同一个旧值竞争, 只能有一个成功
+	const writers = 8
+	var wg sync.WaitGroup
+	var wins atomic.Int32
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ok, err := fs.CompareAndSwap("/small", []byte("v1"), []byte(fmt.Sprintf("w%d", i)))
+			if err != nil {
+				t.Error(err)
+			}
+			if ok {
+				wins.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := wins.Load(); n != 1 {
+		t.Fatalf("successful swaps = %d, want 1", n)
+	}
+}
+
+func TestBBoltFs_ETag(t *testing.T) {
+	fs := newTestFs(t, WithInlineThreshold(8))
+	if _, err := fs.CreateWith("/a", []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	etag := func() string {
+		t.Helper()
+		tag, err := fs.ETag("/a")
+		if err != nil {
+			t.Fatalf("ETag: %v", err)
+		}
+		return tag
+	}
+	tag := etag()
+	if etag() != tag {
+		t.Fatal("etag changed without a write")
+	}
+	// 只修改元数据时 etag 不变
+	if err := fs.Chmod("/a", 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Chtimes("/a", time.Now(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if etag() != tag {
+		t.Fatal("etag changed after Chmod/Chtimes")
+	}
+
+	seen := map[string]bool{tag: true}
+	writes := map[string]func() error{
+		"Write": func() error {
+			f, err := fs.OpenFile("/a", os.O_RDWR, 0)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = f.WriteAt([]byte("J"), 0)
+			return err
+		},
+		"Truncate":  func() error { return fs.Truncate("/a", 20) },
+		"CopyRange": func() error { return fs.CopyRange("/a", 0, 10, 5) },
+		"Recreate": func() error {
+			if err := fs.Remove("/a"); err != nil {
+				return err
+			}
+			_, err := fs.CreateWith("/a", []byte("hello"), 0644)
+			return err
+		},
+	}
+	for _, op := range []string{"Write", "Truncate", "CopyRange", "Recreate"} {
+		if err := writes[op](); err != nil {
+			t.Fatalf("%s: %v", op, err)
+		}
+		tag := etag()
+		if seen[tag] {
+			t.Fatalf("etag %s reused after %s", tag, op)
+		}
+		seen[tag] = true
+	}
+
+	if err := fs.Mkdir("/d", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.ETag("/d"); !errors.Is(err, ErrIsDirectory) {
+		t.Fatalf("ETag on dir: %v", err)
+	}
+	if _, err := fs.ETag("/missing"); !errors.Is(err, ErrFileNotFound) {
+		t.Fatalf("ETag on missing file: %v", err)
+	}
+}
+
+func TestBBoltFs_MoveInto(t *testing.T) {
+	fs := newTestFs(t)
+	if err := fs.MkdirAll("dst", 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "b.txt", "dst/b.txt"} {
+		if _, err := fs.CreateWith(name, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := fs.MoveInto("a.txt", "dst/"); err != nil {
+		t.Fatalf("MoveInto: %v", err)
+	}
+	if got := readAll(t, fs, "dst/a.txt"); got != "a.txt" {
+		t.Fatalf("moved content = %q", got)
+	}
+	if _, err := fs.Stat("a.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("source still exists: %v", err)
+	}
+
+	// 同名文件不会被覆盖
+	if err := fs.MoveInto("b.txt", "dst"); !errors.Is(err, ErrFileExists) {
+		t.Fatalf("collision: err = %v", err)
+	}
+	if got := readAll(t, fs, "dst/b.txt"); got != "dst/b.txt" {
+		t.Fatalf("destination overwritten: %q", got)
+	}
+
+	if err := fs.MoveInto("b.txt", "dst/a.txt"); !errors.Is(err, ErrNotDirectory) {
+		t.Fatalf("into file: err = %v", err)
+	}
+	if err := fs.MoveInto("b.txt", "nodir"); !errors.Is(err, ErrFileNotFound) {
+		t.Fatalf("into missing dir: err = %v", err)
+	}
+	if got := readAll(t, fs, "b.txt"); got != "b.txt" {
+		t.Fatalf("source changed after failed moves: %q", got)
+	}
+}
+
+func TestBBoltFs_StrictDirRead(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		var opts []Option
+		want := io.EOF
+		if strict {
+			opts = append(opts, WithStrictDirRead())
+			want = ErrIsDirectory
+		}
+		fs := newTestFs(t, opts...)
+		_ = fs.Mkdir("dir", 0755)
+		d, err := fs.Open("dir")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.Read(make([]byte, 1)); err != want {
+			t.Errorf("strict=%v: Read err = %v, want %v", strict, err, want)
+		}
+		if _, err := d.ReadAt(make([]byte, 1), 0); err != want {
+			t.Errorf("strict=%v: ReadAt err = %v, want %v", strict, err, want)
+		}
+		_ = d.Close()
+	}
+}
+
+func TestBBoltFs_MaxPathDepth(t *testing.T) {
+	fs := newTestFs(t, WithMaxPathDepth(3))
+	if err := fs.MkdirAll("a/b", 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.CreateWith("a/b/c", nil, 0644)
+	if err != nil {
+		t.Fatalf("create at limit: %v", err)
+	}
+	_ = f.Close()
+
+	if _, err := fs.CreateWith("a/b/c/d", nil, 0644); !errors.Is(err, ErrPathTooDeep) {
+		t.Errorf("create too deep: err = %v", err)
+	}
+	if err := fs.Mkdir("a/b/d", 0755); err != nil {
+		t.Fatalf("mkdir at limit: %v", err)
+	}
+	if err := fs.MkdirAll("a/b/d/e", 0755); !errors.Is(err, ErrPathTooDeep) {
+		t.Errorf("mkdir too deep: err = %v", err)
+	}
+	if err := fs.Rename("a/b/c", "a/b/d/c"); !errors.Is(err, ErrPathTooDeep) {
+		t.Errorf("rename too deep: err = %v", err)
+	}
+	if _, err := fs.Stat("a/b/c"); err != nil {
+		t.Errorf("source lost after rejected rename: %v", err)
+	}
+}
+
+func TestFileInfo_SysKey(t *testing.T) {
+	fs := newTestFs(t, WithBackslashSeparator())
+	_ = fs.MkdirAll(`dir\sub`, 0755)
+	f, err := fs.CreateWith(`dir\a.txt`, nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := func(fi os.FileInfo) string {
+		t.Helper()
+		sys, ok := fi.Sys().(*SysInfo)
+		if !ok {
+			t.Fatalf("Sys() = %T", fi.Sys())
+		}
+		return sys.Key
+	}
+	fi, _ := f.Stat()
+	_ = f.Close()
+	if k := key(fi); k != "dir/a.txt" {
+		t.Errorf("handle Stat key = %q", k)
+	}
+	fi, err = fs.Stat(`dir\a.txt`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k := key(fi); k != "dir/a.txt" {
+		t.Errorf("Stat key = %q", k)
+	}
+	entries, err := fs.ReadDir(`dir`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		info, _ := e.Info()
+		if want := "dir/" + e.Name(); key(info) != want {
+			t.Errorf("entry key = %q, want %q", key(info), want)
+		}
+	}
+}
+
+func TestBBoltFs_ReadFileInto(t *testing.T) {
+	fs := newTestFs(t)
+	f, err := fs.CreateWith("a", []byte("hello"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	exact := make([]byte, 5)
+	if n, err := fs.ReadFileInto("a", exact); err != nil || n != 5 || string(exact) != "hello" {
+		t.Errorf("exact: %d, %q, %v", n, exact, err)
+	}
+	small := []byte("xyz")
+	if n, err := fs.ReadFileInto("a", small); !errors.Is(err, io.ErrShortBuffer) || n != 5 || string(small) != "xyz" {
+		t.Errorf("too small: %d, %q, %v", n, small, err)
+	}
+	large := make([]byte, 16)
+	if n, err := fs.ReadFileInto("a", large); err != nil || n != 5 || string(large[:n]) != "hello" {
+		t.Errorf("large: %d, %q, %v", n, large[:n], err)
+	}
+
+	_ = fs.Mkdir("d", 0755)
+	if _, err := fs.ReadFileInto("d", large); !errors.Is(err, ErrIsDirectory) {
+		t.Errorf("dir: err = %v", err)
+	}
+	if _, err := fs.ReadFileInto("missing", large); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("missing: err = %v", err)
+	}
+}
+
+func TestBBoltFs_MkdirIfNotExist(t *testing.T) {
+	fs := newTestFs(t)
+	if created, err := fs.MkdirIfNotExist("d", 0750); err != nil || !created {
+		t.Fatalf("new dir: %v, %v", created, err)
+	}
+	if fi, err := fs.Stat("d"); err != nil || !fi.IsDir() || fi.Mode().Perm() != 0750 {
+		t.Fatalf("Stat = %v, %v", fi, err)
+	}
+	if created, err := fs.MkdirIfNotExist("d", 0700); err != nil || created {
+		t.Errorf("existing dir: %v, %v", created, err)
+	}
+	if fi, _ := fs.Stat("d"); fi.Mode().Perm() != 0750 {
+		t.Errorf("existing dir mode changed to %v", fi.Mode())
+	}
+
+	f, err := fs.CreateWith("f", nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	if created, err := fs.MkdirIfNotExist("f", 0755); !errors.Is(err, ErrFileExists) || created {
+		t.Errorf("file in the way: %v, %v", created, err)
+	}
+}
+
+func TestBBoltFs_RemoveIfExists(t *testing.T) {
+	fs := newTestFs(t)
+	_ = fs.MkdirAll("d/sub", 0755)
+	f, err := fs.CreateWith("d/a", nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	if removed, err := fs.RemoveIfExists("d/a"); err != nil || !removed {
+		t.Fatalf("present file: %v, %v", removed, err)
+	}
+	if _, err := fs.Stat("d/a"); err == nil {
+		t.Fatal("file still exists")
+	}
+	if removed, err := fs.RemoveIfExists("d/a"); err != nil || removed {
+		t.Errorf("absent file: %v, %v", removed, err)
+	}
+	if removed, err := fs.RemoveIfExists("d"); !errors.Is(err, ErrDirNotEmpty) || removed {
+		t.Errorf("non-empty dir: %v, %v", removed, err)
+	}
+	if removed, err := fs.RemoveIfExists("d/sub"); err != nil || !removed {
+		t.Errorf("empty dir: %v, %v", removed, err)
+	}
+	if removed, err := fs.RemoveIfExists("d"); err != nil || !removed {
+		t.Errorf("dir emptied: %v, %v", removed, err)
+	}
+}
+
+func TestBBoltFs_Swap(t *testing.T) {
+	fs := newTestFs(t, WithInlineThreshold(8))
+	prev, err := fs.Swap("a", []byte("first"))
+	if err != nil || prev != nil {
+		t.Fatalf("Swap on missing file = %q, %v", prev, err)
+	}
+	prev, err = fs.Swap("a", []byte("second, long enough to be chunked"))
+	if err != nil || string(prev) != "first" {
+		t.Fatalf("Swap = %q, %v", prev, err)
+	}
+	prev, err = fs.Swap("a", []byte("third"))
+	if err != nil || string(prev) != "second, long enough to be chunked" {
+		t.Fatalf("Swap chunked = %q, %v", prev, err)
+	}
+	if got := readAll(t, fs, "a"); got != "third" {
+		t.Errorf("content = %q", got)
+	}
+	_ = fs.Mkdir("d", 0755)
+	if _, err := fs.Swap("d", nil); !errors.Is(err, ErrFileExists) {
+		t.Errorf("Swap on dir: err = %v", err)
+	}
+}
+
+func TestBBoltFs_TranslatedErrors(t *testing.T) {
+	path := mustTmpFile(t)
+	fs, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 同一文件已被打开, 再次打开时等待文件锁超时
+	if _, err := New(path, WithLockTimeout(50*time.Millisecond)); !errors.Is(err, ErrLocked) {
+		t.Errorf("double open: err = %v, want ErrLocked", err)
+	}
+	if _, err := fs.Create("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("a"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Stat after Close: err = %v, want ErrClosed", err)
+	}
+	if err := fs.Mkdir("d", 0755); !errors.Is(err, ErrClosed) {
+		t.Errorf("Mkdir after Close: err = %v, want ErrClosed", err)
+	}
+
+	ro, err := New(path, WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Close()
+	if err := ro.Mkdir("d", 0755); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Mkdir on read-only fs: err = %v, want ErrReadOnly", err)
+	}
+}
+
+func TestBBoltFs_OpenFile_Directory(t *testing.T) {
+	fs := newTestFs(t)
+	if err := fs.Mkdir("dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+	fh, err := fs.CreateWith("file.txt", []byte("x"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = fh.Close()
+
+	if _, err := fs.OpenFile("file.txt", os.O_RDONLY|O_DIRECTORY, 0); !errors.Is(err, ErrNotDirectory) {
+		t.Errorf("open file with O_DIRECTORY: err = %v, want ErrNotDirectory", err)
+	}
+	if _, err := fs.OpenFile("missing", os.O_RDONLY|O_DIRECTORY, 0); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("open missing with O_DIRECTORY: err = %v, want ErrFileNotFound", err)
+	}
+	f, err := fs.OpenFile("dir", os.O_RDONLY|O_DIRECTORY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if fi, err := f.Stat(); err != nil || !fi.IsDir() {
+		t.Errorf("Stat = %v, %v; want directory", fi, err)
+	}
+}
+
+func TestBBoltFs_RenameDir(t *testing.T) {
+	fs := newTestFs(t)
+	_ = fs.MkdirAll("a/b", 0755)
+	f, _ := fs.CreateWith("a/b/c.txt", []byte("c"), 0644)
+	f.Close()
+
+	if err := fs.Rename("a", "z"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if got := readAll(t, fs, "z/b/c.txt"); got != "c" {
+		t.Errorf("z/b/c.txt = %q, want c", got)
+	}
+	for _, name := range []string{"a", "a/b", "a/b/c.txt"} {
+		if _, err := fs.Stat(name); !errors.Is(err, ErrFileNotFound) {
+			t.Errorf("Stat(%s) = %v, want ErrFileNotFound", name, err)
+		}
+	}
+	if fi, err := fs.Stat("z/b"); err != nil || !fi.IsDir() {
+		t.Errorf("Stat(z/b) = %v, %v", fi, err)
+	}
+
+	// 目标已存在
+	_ = fs.MkdirAll("full/x", 0755)
+	f, _ = fs.CreateWith("file.txt", []byte("f"), 0644)
+	f.Close()
+	for _, dst := range []string{"full", "file.txt"} {
+		if err := fs.Rename("z", dst); !errors.Is(err, ErrDestinationExists) {
+			t.Errorf("Rename(z, %s) = %v, want ErrDestinationExists", dst, err)
+		}
+	}
+	// 不能移动到自身之下
+	if err := fs.Rename("z", "z/b/inner"); err == nil {
+		t.Error("Rename into descendant succeeded")
+	}
+	if got := readAll(t, fs, "z/b/c.txt"); got != "c" {
+		t.Errorf("z/b/c.txt after failed renames = %q", got)
+	}
+}
+
+func TestBBoltFs_Rename_OntoDir(t *testing.T) {
+	fs := newTestFs(t)
+	for _, dir := range []string{"empty", "full", "src", "src/sub"} {
+		if err := fs.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, content := range map[string]string{"full/keep": "k", "a.txt": "a", "src/sub/deep.txt": "deep"} {
+		f, err := fs.CreateWith(name, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+
+	// 文件覆盖空目录
+	if err := fs.Rename("a.txt", "empty"); err != nil {
+		t.Fatalf("Rename file onto empty dir: %v", err)
+	}
+	if fi, err := fs.Stat("empty"); err != nil || fi.IsDir() {
+		t.Errorf("Stat(empty) = %v, %v; want file", fi, err)
+	}
+	if got := readAll(t, fs, "empty"); got != "a" {
+		t.Errorf("content = %q, want %q", got, "a")
+	}
+
+	// 非空目录不能被覆盖
+	if err := fs.Rename("empty", "full"); !errors.Is(err, ErrNotEmpty) {
+		t.Errorf("Rename file onto non-empty dir: err = %v, want ErrNotEmpty", err)
+	}
+	if err := fs.Rename("src", "full"); !errors.Is(err, ErrNotEmpty) {
+		t.Errorf("Rename dir onto non-empty dir: err = %v, want ErrNotEmpty", err)
+	}
+	if got := readAll(t, fs, "full/keep"); got != "k" {
+		t.Errorf("full/keep = %q", got)
+	}
+
+	// 目录覆盖空目录, 子项一起移动
+	if err := fs.Mkdir("target", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Rename("src", "target"); err != nil {
+		t.Fatalf("Rename dir onto empty dir: %v", err)
+	}
+	if got := readAll(t, fs, "target/sub/deep.txt"); got != "deep" {
+		t.Errorf("target/sub/deep.txt = %q", got)
+	}
+	if _, err := fs.Stat("src"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("src still exists: %v", err)
+	}
+	if names := readDirNames(t, fs, "target"); len(names) != 1 || names[0] != "sub" {
+		t.Errorf("ReadDir(target) = %v", names)
+	}
+	if err := fs.Rename("target", "empty"); !errors.Is(err, ErrNotDirectory) {
+		t.Errorf("Rename dir onto file: err = %v, want ErrNotDirectory", err)
+	}
+	if err := fs.Rename("target", "target/sub/x"); !errors.Is(err, os.ErrInvalid) {
+		t.Errorf("Rename dir into itself: err = %v, want ErrInvalid", err)
+	}
+}
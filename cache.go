@@ -0,0 +1,111 @@
+package bboltfs
+
+import (
+	"container/list"
+	"sync"
+)
+
+// statCache 是 Stat 结果的 LRU 缓存. nil 表示未开启缓存, 所有方法都可以在 nil 上调用.
+//
+// 每次写事务提交后整个缓存失效并增加 gen; 读取方在查询数据库前记下 gen,
+// 写入缓存时若 gen 已变化则放弃, 避免把提交前读到的旧值放入缓存
+type statCache struct {
+	mu    sync.Mutex
+	size  int
+	gen   uint64
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type statEntry struct {
+	name string
+	fi   *fileInfo
+}
+
+func newStatCache(size int) *statCache {
+	return &statCache{size: size, ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *statCache) generation() uint64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+func (c *statCache) get(name string) (*fileInfo, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[name]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	return e.Value.(*statEntry).fi, true
+}
+
+func (c *statCache) add(gen uint64, name string, fi *fileInfo) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen {
+		return
+	}
+	if e, ok := c.items[name]; ok {
+		e.Value.(*statEntry).fi = fi
+		c.ll.MoveToFront(e)
+		return
+	}
+	c.items[name] = c.ll.PushFront(&statEntry{name: name, fi: fi})
+	if c.ll.Len() > c.size {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.items, e.Value.(*statEntry).name)
+	}
+}
+
+func (c *statCache) remove(name string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	if e, ok := c.items[name]; ok {
+		c.ll.Remove(e)
+		delete(c.items, name)
+	}
+}
+
+func (c *statCache) clear() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.ll.Init()
+	clear(c.items)
+}
+
+// InvalidateCache 使 path 的缓存失效. 通过 DB 直接修改数据后需要调用
+func (fs *BBolt) InvalidateCache(path string) {
+	fs.statCache.remove(fs.normalize(path))
+}
+
+// InvalidateAll 清空所有缓存, 包括 WithTxPool 缓存的只读事务
+func (fs *BBolt) InvalidateAll() {
+	fs.statCache.clear()
+	fs.dbMu.RLock()
+	defer fs.dbMu.RUnlock()
+	if fs.txPool != nil {
+		fs.txPool.drain()
+	}
+}
@@ -0,0 +1,66 @@
+package bboltfs
+
+import (
+	"os"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestBBoltFs_StatCacheInvalidate(t *testing.T) {
+	fs := newTestFs(t, WithStatCache(16))
+	if _, err := fs.CreateWith("/a", []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.CreateWith("/b", []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stat := func(name string) os.FileInfo {
+		t.Helper()
+		fi, err := fs.Stat(name)
+		if err != nil {
+			t.Fatalf("Stat %s: %v", name, err)
+		}
+		return fi
+	}
+	if fi := stat("/a"); fi.Size() != 1 {
+		t.Fatalf("size = %d, want 1", fi.Size())
+	}
+	stat("/b")
+
+	// 绕过 fs 直接修改数据库: 用 /b 的内容覆盖 /a, 再删除 /b
+	err := fs.DB().Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucketFiles))
+		return b.Put([]byte("/a"), append([]byte(nil), b.Get([]byte("/b"))...))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi := stat("/a"); fi.Size() != 1 {
+		t.Fatalf("cached size = %d, want stale 1", fi.Size())
+	}
+	fs.InvalidateCache("/a")
+	if fi := stat("/a"); fi.Size() != 5 {
+		t.Fatalf("size after InvalidateCache = %d, want 5", fi.Size())
+	}
+
+	err = fs.DB().Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(bucketFiles)).Delete([]byte("/b"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat("/b")
+	fs.InvalidateAll()
+	if _, err := fs.Stat("/b"); err == nil {
+		t.Fatal("Stat /b after InvalidateAll should fail")
+	}
+
+	// 通过 fs 的修改自动使缓存失效
+	if err := fs.Truncate("/a", 2); err != nil {
+		t.Fatal(err)
+	}
+	if fi := stat("/a"); fi.Size() != 2 {
+		t.Fatalf("size after Truncate = %d, want 2", fi.Size())
+	}
+}
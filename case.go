@@ -0,0 +1,76 @@
+package bboltfs
+
+import (
+	"path"
+	"strings"
+
+	"go.etcd.io/bbolt"
+)
+
+// xattrName 保存 WithCaseInsensitive 模式下与 key 大小写不同的显示名称 (只保存 base name),
+// 与其他扩展属性一样随文件重命名和删除
+const xattrName = "bboltfs.name"
+
+// separators 只转换路径分隔符, 不改变大小写
+func (fs *BBolt) separators(name string) string {
+	if fs.backslash {
+		// 兼容 Windows 风格的路径分隔符
+		name = strings.ReplaceAll(name, "\\", "/")
+	}
+	return name
+}
+
+// keepCaseTx 在事务 tx 中新建文件或目录后记录 raw 的原始大小写. 已有显示名称时保持不变, 与大小写不敏感的文件系统一样
+// 以首次创建时的名称为准
+func (fs *BBolt) keepCaseTx(tx *bbolt.Tx, key, raw string) error {
+	if !fs.caseInsensitive {
+		return nil
+	}
+	if b := tx.Bucket([]byte(bucketXattrs)); b != nil && b.Get(xattrKey(key, xattrName)) != nil {
+		return nil
+	}
+	return fs.setDisplayName(tx, key, raw)
+}
+
+// setDisplayName 在事务 tx 中将 key 的显示名称设置为 raw 的 base name, 与 key 相同时删除记录
+func (fs *BBolt) setDisplayName(tx *bbolt.Tx, key, raw string) error {
+	if !fs.caseInsensitive {
+		return nil
+	}
+	display := path.Base(fs.separators(raw))
+	if display == path.Base(key) {
+		if b := tx.Bucket([]byte(bucketXattrs)); b != nil {
+			return b.Delete(xattrKey(key, xattrName))
+		}
+		return nil
+	}
+	b, err := tx.CreateBucketIfNotExists([]byte(bucketXattrs))
+	if err != nil {
+		return err
+	}
+	return b.Put(xattrKey(key, xattrName), []byte(display))
+}
+
+// displayName 返回 key 的显示名称, 没有记录时返回 base
+func (fs *BBolt) displayName(tx *bbolt.Tx, key, base string) string {
+	if !fs.caseInsensitive {
+		return base
+	}
+	if b := tx.Bucket([]byte(bucketXattrs)); b != nil {
+		if v := b.Get(xattrKey(key, xattrName)); v != nil {
+			return string(v)
+		}
+	}
+	return base
+}
+
+// renameCase 处理大小写不敏感模式下只改变大小写的重命名: key 不变, 只更新显示名称
+func (fs *BBolt) renameCase(tx *bbolt.Tx, key, raw string) error {
+	if !exists(tx, key) {
+		return ErrFileNotFound
+	}
+	if err := fs.touchParent(tx, key); err != nil {
+		return err
+	}
+	return fs.setDisplayName(tx, key, raw)
+}
@@ -0,0 +1,70 @@
+package bboltfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBBoltFs_CaseInsensitive(t *testing.T) {
+	fs := newTestFs(t, WithCaseInsensitive())
+	if err := fs.Mkdir("Docs", 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.CreateWith("docs/ReadMe.md", []byte("hello"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	if got := readAll(t, fs, "DOCS/README.MD"); got != "hello" {
+		t.Errorf("content = %q, want %q", got, "hello")
+	}
+	if fi, err := fs.Stat("docs"); err != nil || fi.Name() != "Docs" {
+		t.Errorf("Stat(docs) = %v, %v; want name Docs", fi, err)
+	}
+	if names := readDirNames(t, fs, "docs"); !reflect.DeepEqual(names, []string{"ReadMe.md"}) {
+		t.Errorf("ReadDir = %v", names)
+	}
+	// 已存在时保持首次创建的名称
+	f, err = fs.Create("DOCS/readme.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	if fi, err := fs.Stat("docs/readme.md"); err != nil || fi.Name() != "ReadMe.md" {
+		t.Errorf("Stat after re-create = %v, %v; want name ReadMe.md", fi, err)
+	}
+}
+
+func TestBBoltFs_Rename_CaseOnly(t *testing.T) {
+	fs := newTestFs(t, WithCaseInsensitive())
+	f, err := fs.CreateWith("foo.txt", []byte("survives"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	if err := fs.Rename("foo.txt", "Foo.txt"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if got := readAll(t, fs, "foo.txt"); got != "survives" {
+		t.Errorf("content = %q, want %q", got, "survives")
+	}
+	if fi, err := fs.Stat("FOO.TXT"); err != nil || fi.Name() != "Foo.txt" {
+		t.Errorf("Stat = %v, %v; want name Foo.txt", fi, err)
+	}
+	if names := readDirNames(t, fs, ""); !reflect.DeepEqual(names, []string{"Foo.txt"}) {
+		t.Errorf("ReadDir = %v, want [Foo.txt]", names)
+	}
+
+	// 普通重命名使用新名称的大小写
+	if err := fs.Rename("foo.txt", "Bar.TXT"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if names := readDirNames(t, fs, ""); !reflect.DeepEqual(names, []string{"Bar.TXT"}) {
+		t.Errorf("ReadDir after rename = %v, want [Bar.TXT]", names)
+	}
+	if err := fs.Rename("missing", "MISSING"); err == nil {
+		t.Error("case-only rename of missing file should fail")
+	}
+}
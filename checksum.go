@@ -0,0 +1,37 @@
+package bboltfs
+
+import "bytes"
+
+// Checksummer 由 OpenBuffered 返回的句柄实现, 写入时增量计算内容的 SHA-256, 关闭后无需再次读取文件即可得到校验和
+type Checksummer interface {
+	// Checksum 返回当前内容的 SHA-256. 句柄上出现过覆盖已有内容的写入 (WriteAt 写入文件中间、缩短的 Truncate、
+	// CopyRange) 时无法增量计算, 返回 false
+	Checksum() ([]byte, bool)
+}
+
+var _ Checksummer = (*bboltFile)(nil)
+
+func (f *bboltFile) Checksum() ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.hash == nil {
+		return nil, false
+	}
+	return f.hash.Sum(nil), true
+}
+
+// hashAt 在长度为 size 的内容的 off 处写入 p 之前更新增量校验和: 写入位置在末尾或之后时
+// 依次加入填充的 0 和 p, 否则覆盖了已计算的内容, 放弃增量计算
+func (f *bboltFile) hashAt(off, size int64, p []byte) {
+	if f.hash == nil {
+		return
+	}
+	if off < size {
+		f.hash = nil
+		return
+	}
+	if off > size {
+		f.hash.Write(bytes.Repeat([]byte{0}, int(off-size)))
+	}
+	f.hash.Write(p)
+}
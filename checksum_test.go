@@ -0,0 +1,63 @@
+package bboltfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestBBoltFile_Checksum(t *testing.T) {
+	fs := newTestFs(t, WithSpillThreshold(8))
+	f, err := fs.OpenBuffered("log.txt", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	for _, s := range []string{"first line\n", "second\n", "third line is longer\n"} {
+		if _, err := f.WriteString(s); err != nil {
+			t.Fatal(err)
+		}
+		want.WriteString(s)
+	}
+	// 在末尾之后写入, 中间填充的 0 也计入校验和
+	if _, err := f.WriteAt([]byte("tail"), int64(want.Len()+3)); err != nil {
+		t.Fatal(err)
+	}
+	want.Write([]byte{0, 0, 0})
+	want.WriteString("tail")
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	sum, ok := f.(Checksummer).Checksum()
+	if !ok {
+		t.Fatal("Checksum not available after sequential writes")
+	}
+	if expect := sha256.Sum256(want.Bytes()); !bytes.Equal(sum, expect[:]) {
+		t.Errorf("Checksum = %x, want %x", sum, expect)
+	}
+	if stored := sha256.Sum256([]byte(readAll(t, fs, "log.txt"))); !bytes.Equal(sum, stored[:]) {
+		t.Errorf("Checksum = %x, stored content hashes to %x", sum, stored)
+	}
+
+	// 追加到已有文件时包含原有内容, 覆盖写入后不再可用
+	f, err = fs.OpenBuffered("log.txt", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString("more"); err != nil {
+		t.Fatal(err)
+	}
+	want.WriteString("more")
+	expect := sha256.Sum256(want.Bytes())
+	if sum, ok := f.(Checksummer).Checksum(); !ok || !bytes.Equal(sum, expect[:]) {
+		t.Errorf("Checksum after append = %x, %v; want %x", sum, ok, expect)
+	}
+	if _, err := f.WriteAt([]byte("X"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.(Checksummer).Checksum(); ok {
+		t.Error("Checksum should be unavailable after overwriting")
+	}
+}
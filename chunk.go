@@ -0,0 +1,313 @@
+package bboltfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+
+	"go.etcd.io/bbolt"
+)
+
+// 文件内容的存储方式
+const (
+	storageInline  uint8 = iota // 内容紧跟在 files bucket 的元数据之后
+	storageChunked              // 内容按固定大小分块存放在 chunks bucket 中
+)
+
+const defaultChunkSize = 64 << 10 // 默认分块大小
+
+// Storage 是 SysInfo 中报告的文件内容存储方式
+type Storage uint8
+
+const (
+	StorageNone    Storage = iota // 目录, 没有内容
+	StorageInline                 // 内容与元数据存放在 files bucket 的同一个 value 中
+	StorageChunked                // 内容按固定大小分块存放在 chunks bucket 中
+)
+
+func (s Storage) String() string {
+	switch s {
+	case StorageInline:
+		return "inline"
+	case StorageChunked:
+		return "chunked"
+	default:
+		return "none"
+	}
+}
+
+// storageOf 返回 meta 对应的 Storage
+func storageOf(meta fileMeta) Storage {
+	switch {
+	case meta.IsDir:
+		return StorageNone
+	case meta.Storage == storageChunked:
+		return StorageChunked
+	default:
+		return StorageInline
+	}
+}
+
+// chunkKey 返回 inode 第 idx 块的 key, 使用大端序保证同一 inode 的分块连续且有序
+func chunkKey(ino uint64, idx int64) []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key[:8], ino)
+	binary.BigEndian.PutUint64(key[8:], uint64(idx))
+	return key
+}
+
+// encodeFile 根据内联阈值决定内容的存储方式, 写入需要的分块并返回 files bucket 中的 value.
+// old 为文件原有的元数据, 新建文件时为 nil. 符号链接的目标总是内联存储, 以便 linkTarget 直接读出
+func (fs *BBolt) encodeFile(tx *bbolt.Tx, old *fileMeta, meta fileMeta, data []byte) ([]byte, error) {
+	if fs.inlineThreshold <= 0 || len(data) < fs.inlineThreshold || meta.Mode&os.ModeSymlink != 0 {
+		if old != nil {
+			if err := fs.deleteChunks(tx, *old, 0); err != nil {
+				return nil, err
+			}
+		}
+		meta.Storage, meta.Ino, meta.ChunkSize = storageInline, 0, 0
+		return append(fs.encodeMeta(meta), data...), nil
+	}
+
+	chunks := tx.Bucket([]byte(bucketChunks))
+	meta.Storage, meta.ChunkSize = storageChunked, uint32(fs.chunkSize)
+	if old != nil && old.Storage == storageChunked && old.ChunkSize == meta.ChunkSize {
+		meta.Ino = old.Ino
+	} else {
+		if old != nil {
+			if err := fs.deleteChunks(tx, *old, 0); err != nil {
+				return nil, err
+			}
+		}
+		ino, err := chunks.NextSequence()
+		if err != nil {
+			return nil, err
+		}
+		meta.Ino = ino
+	}
+	idx, err := putChunks(chunks, meta, data)
+	if err != nil {
+		return nil, err
+	}
+	// 删除文件缩小后多余的分块
+	if err := fs.deleteChunks(tx, meta, idx); err != nil {
+		return nil, err
+	}
+	return fs.encodeMeta(meta), nil
+}
+
+// putChunks 将 data 按分块写入 meta 对应的 inode, 返回写入的分块数. 全为 0 的分块作为空洞不存储
+func putChunks(chunks *bbolt.Bucket, meta fileMeta, data []byte) (int64, error) {
+	cs := int64(meta.ChunkSize)
+	var idx int64
+	for off := int64(0); off < int64(len(data)); off += cs {
+		end := off + cs
+		if end > int64(len(data)) {
+			end = int64(len(data))
+		}
+		key := chunkKey(meta.Ino, idx)
+		var err error
+		if isZero(data[off:end]) {
+			err = chunks.Delete(key)
+		} else {
+			err = chunks.Put(key, data[off:end])
+		}
+		if err != nil {
+			return 0, err
+		}
+		idx++
+	}
+	return idx, nil
+}
+
+func isZero(p []byte) bool {
+	for _, b := range p {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// fileContent 解析 files bucket 中的 value, 返回元数据和完整的文件内容.
+// 返回的内容是副本, 在事务结束后依然有效
+func (fs *BBolt) fileContent(tx *bbolt.Tx, val []byte) (fileMeta, []byte, error) {
+	meta, inline := fs.splitMeta(val)
+	if meta.Storage != storageChunked {
+		return meta, append([]byte(nil), inline...), nil
+	}
+	data := make([]byte, meta.Size)
+	fs.readChunks(tx, meta, data, 0)
+	return meta, data, nil
+}
+
+// readAt 从文件的 off 位置读取内容到 p, 只访问涉及的分块, 返回读取的字节数
+func (fs *BBolt) readAt(tx *bbolt.Tx, meta fileMeta, inline []byte, p []byte, off int64) int {
+	if off >= meta.Size {
+		return 0
+	}
+	if int64(len(p)) > meta.Size-off {
+		p = p[:meta.Size-off]
+	}
+	if meta.Storage != storageChunked {
+		n := 0
+		if off < int64(len(inline)) {
+			n = copy(p, inline[off:])
+		}
+		clear(p[n:])
+		return len(p)
+	}
+	fs.readChunks(tx, meta, p, off)
+	return len(p)
+}
+
+// readChunks 将 [off, off+len(p)) 范围的分块内容读入 p, 缺失或不足的部分 (空洞) 读作 0
+func (fs *BBolt) readChunks(tx *bbolt.Tx, meta fileMeta, p []byte, off int64) {
+	chunks := tx.Bucket([]byte(bucketChunks))
+	cs := int64(meta.ChunkSize)
+	for done := 0; done < len(p); {
+		pos := off + int64(done)
+		idx, in := pos/cs, pos%cs
+		want := int(cs - in)
+		if want > len(p)-done {
+			want = len(p) - done
+		}
+		dst := p[done : done+want]
+		n := 0
+		if chunk := chunks.Get(chunkKey(meta.Ino, idx)); int64(len(chunk)) > in {
+			n = copy(dst, chunk[in:])
+		}
+		clear(dst[n:])
+		done += want
+	}
+}
+
+// writeAt 在一个事务中将 p 写入文件 name 的 off 位置并更新元数据, 返回新的元数据.
+// 分块存储的文件只读写涉及的分块, 内联文件则整体重写, 写入后达到内联阈值时改为分块存储
+func (fs *BBolt) writeAt(tx *bbolt.Tx, name string, val []byte, p []byte, off int64, modTime int64) (fileMeta, error) {
+	meta, inline := fs.splitMeta(val)
+	end := off + int64(len(p))
+	chunks := tx.Bucket([]byte(bucketChunks))
+	if meta.Storage != storageChunked && (fs.inlineThreshold <= 0 || end < int64(fs.inlineThreshold)) {
+		size := meta.Size
+		if end > size {
+			size = end
+		}
+		data := make([]byte, size)
+		copy(data, inline)
+		copy(data[off:], p)
+		old := meta
+		meta.Size, meta.ModTime = size, modTime
+		var err error
+		if meta.Version, err = tx.Bucket([]byte(bucketFiles)).NextSequence(); err != nil {
+			return meta, err
+		}
+		enc, err := fs.encodeFile(tx, &old, meta, data)
+		if err != nil {
+			return meta, err
+		}
+		if err = tx.Bucket([]byte(bucketFiles)).Put([]byte(name), enc); err != nil {
+			return meta, err
+		}
+		return fs.decodeMeta(enc), nil
+	}
+	if meta.Storage != storageChunked {
+		// 写入后超过内联阈值: 先将原有内容转为分块存储, 中间的部分留作空洞, 不分配整个文件
+		meta.Storage, meta.ChunkSize = storageChunked, uint32(fs.chunkSize)
+		var err error
+		if meta.Ino, err = chunks.NextSequence(); err != nil {
+			return meta, err
+		}
+		if _, err = putChunks(chunks, meta, append([]byte(nil), inline...)); err != nil {
+			return meta, err
+		}
+	}
+
+	cs := int64(meta.ChunkSize)
+	for done := int64(0); done < int64(len(p)); {
+		pos := off + done
+		idx, in := pos/cs, pos%cs
+		want := cs - in
+		if want > int64(len(p))-done {
+			want = int64(len(p)) - done
+		}
+		key := chunkKey(meta.Ino, idx)
+		old := chunks.Get(key)
+		n := int64(len(old))
+		if in+want > n {
+			n = in + want
+		}
+		chunk := make([]byte, n)
+		copy(chunk, old)
+		copy(chunk[in:], p[done:done+want])
+		if err := chunks.Put(key, chunk); err != nil {
+			return meta, err
+		}
+		done += want
+	}
+	if end > meta.Size {
+		meta.Size = end
+	}
+	meta.ModTime = modTime
+	b := tx.Bucket([]byte(bucketFiles))
+	var err error
+	if meta.Version, err = b.NextSequence(); err != nil {
+		return meta, err
+	}
+	return meta, b.Put([]byte(name), fs.encodeMeta(meta))
+}
+
+// diskSize 返回文件内容实际占用的字节数 (不含元数据头部). 分块存储的文件只统计存在的分块,
+// 因此带空洞的文件会小于逻辑大小
+func (fs *BBolt) diskSize(tx *bbolt.Tx, meta fileMeta, inline []byte) int64 {
+	if meta.Storage != storageChunked {
+		return int64(len(inline))
+	}
+	var n int64
+	c := tx.Bucket([]byte(bucketChunks)).Cursor()
+	prefix := chunkKey(meta.Ino, 0)[:8]
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		n += int64(len(v))
+	}
+	return n
+}
+
+// deleteChunks 删除 meta 对应 inode 中序号不小于 from 的分块, 内联文件不做任何事
+func (fs *BBolt) deleteChunks(tx *bbolt.Tx, meta fileMeta, from int64) error {
+	if meta.Storage != storageChunked {
+		return nil
+	}
+	c := tx.Bucket([]byte(bucketChunks)).Cursor()
+	prefix := chunkKey(meta.Ino, 0)[:8]
+	for k, _ := c.Seek(chunkKey(meta.Ino, from)); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Seek(chunkKey(meta.Ino, from)) {
+		if err := c.Delete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteFile 删除文件的元数据、分块和索引, 文件不存在时不做任何事
+func (fs *BBolt) deleteFile(tx *bbolt.Tx, name string) error {
+	b := tx.Bucket([]byte(bucketFiles))
+	val := b.Get([]byte(name))
+	if val == nil {
+		return nil
+	}
+	if err := fs.deleteChunks(tx, fs.decodeMeta(val), 0); err != nil {
+		return err
+	}
+	if err := b.Delete([]byte(name)); err != nil {
+		return err
+	}
+	if err := fs.addFiles(tx, -1); err != nil {
+		return err
+	}
+	if err := deleteXattrs(tx, name); err != nil {
+		return err
+	}
+	if err := fs.touchParent(tx, name); err != nil {
+		return err
+	}
+	return indexDelete(tx, name)
+}
@@ -0,0 +1,685 @@
+package bboltfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+func rawValue(t *testing.T, fs *BBolt, name string) []byte {
+	t.Helper()
+	var raw []byte
+	err := fs.db.View(func(tx *bbolt.Tx) error {
+		raw = append(raw, tx.Bucket([]byte(bucketFiles)).Get([]byte(name))...)
+		return nil
+	})
+	if err != nil || raw == nil {
+		t.Fatalf("rawValue %s: %v", name, err)
+	}
+	return raw
+}
+
+func rawMeta(t *testing.T, fs *BBolt, name string) fileMeta {
+	t.Helper()
+	var meta fileMeta
+	err := fs.db.View(func(tx *bbolt.Tx) error {
+		val := tx.Bucket([]byte(bucketFiles)).Get([]byte(name))
+		if val == nil {
+			return ErrFileNotFound
+		}
+		meta = fs.decodeMeta(val)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("rawMeta %s: %v", name, err)
+	}
+	return meta
+}
+
+func chunkCount(t *testing.T, fs *BBolt) int {
+	t.Helper()
+	var n int
+	_ = fs.db.View(func(tx *bbolt.Tx) error {
+		n = tx.Bucket([]byte(bucketChunks)).Stats().KeyN
+		return nil
+	})
+	return n
+}
+
+func TestBBoltFs_InlineThreshold(t *testing.T) {
+	fs := newTestFs(t, WithInlineThreshold(16))
+	fs.chunkSize = 8
+
+	cases := []struct {
+		name    string
+		size    int
+		storage uint8
+	}{
+		{"under.txt", 15, storageInline},
+		{"at.txt", 16, storageChunked},
+		{"over.txt", 17, storageChunked},
+		{"big.txt", 40, storageChunked},
+	}
+	for _, c := range cases {
+		content := strings.Repeat(string(rune('a'+c.size%26)), c.size)
+		f, err := fs.Create(c.name)
+		if err != nil {
+			t.Fatalf("Create %s: %v", c.name, err)
+		}
+		f.WriteString(content)
+		f.Close()
+
+		if got := readAll(t, fs, c.name); got != content {
+			t.Errorf("%s = %q, want %q", c.name, got, content)
+		}
+		if meta := rawMeta(t, fs, c.name); meta.Storage != c.storage || meta.Size != int64(c.size) {
+			t.Errorf("%s: storage/size = %d/%d, want %d/%d", c.name, meta.Storage, meta.Size, c.storage, c.size)
+		}
+	}
+	// at: 2 块, over: 3 块, big: 5 块
+	if n := chunkCount(t, fs); n != 10 {
+		t.Errorf("chunk count = %d, want 10", n)
+	}
+
+	snap, err := fs.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	if len(snap["big.txt"]) != 40 {
+		t.Errorf("snapshot big.txt has %d bytes, want 40", len(snap["big.txt"]))
+	}
+
+	// 缩小到阈值以下后转为内联存储并释放分块
+	if err := fs.Truncate("big.txt", 3); err != nil {
+		t.Fatalf("Truncate: %v", err)
+	}
+	if meta := rawMeta(t, fs, "big.txt"); meta.Storage != storageInline {
+		t.Errorf("big.txt storage after truncate = %d, want inline", meta.Storage)
+	}
+	if got := readAll(t, fs, "big.txt"); got != "ooo" {
+		t.Errorf("big.txt after truncate = %q", got)
+	}
+	if err := fs.Rename("over.txt", "moved.txt"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if got := readAll(t, fs, "moved.txt"); len(got) != 17 {
+		t.Errorf("moved.txt has %d bytes, want 17", len(got))
+	}
+	if err := fs.Remove("moved.txt"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := fs.RemoveAll("at.txt"); err != nil {
+		t.Fatalf("RemoveAll: %v", err)
+	}
+	if n := chunkCount(t, fs); n != 0 {
+		t.Errorf("chunk count after removal = %d, want 0", n)
+	}
+}
+
+func TestBBoltFs_LegacyMeta(t *testing.T) {
+	fs := newTestFs(t)
+
+	// 旧版本写入的 21 字节元数据
+	buf := new(bytes.Buffer)
+	_ = binary.Write(buf, binary.LittleEndian, os.FileMode(0644))
+	_ = binary.Write(buf, binary.LittleEndian, int64(6))
+	_ = binary.Write(buf, binary.LittleEndian, int64(42))
+	_ = binary.Write(buf, binary.LittleEndian, false)
+	buf.WriteString("legacy")
+	err := fs.db.Update(func(tx *bbolt.Tx) error {
+		if err := tx.Bucket([]byte(bucketFiles)).Put([]byte("old.txt"), buf.Bytes()); err != nil {
+			return err
+		}
+		return indexPut(tx, "old.txt", false)
+	})
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	info, err := fs.Stat("old.txt")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Size() != 6 || info.Mode() != 0644 || info.ModTime().UnixNano() != 42 {
+		t.Errorf("Stat = %d/%v/%d", info.Size(), info.Mode(), info.ModTime().UnixNano())
+	}
+	if got := readAll(t, fs, "old.txt"); got != "legacy" {
+		t.Errorf("content = %q, want %q", got, "legacy")
+	}
+}
+
+func TestBBoltFs_CopyRange(t *testing.T) {
+	cases := []struct {
+		name                   string
+		srcOff, dstOff, length int64
+		want                   string
+	}{
+		{"disjoint", 0, 10, 4, "01234567890123ef"},
+		{"overlap forward", 0, 2, 6, "0101234589abcdef"},
+		{"overlap backward", 4, 2, 6, "0145678989abcdef"},
+		{"grow", 12, 14, 4, "0123456789abcdcdef"},
+	}
+	const content = "0123456789abcdef"
+
+	t.Run("file", func(t *testing.T) {
+		fs := newTestFs(t)
+		for _, c := range cases {
+			f, _ := fs.CreateWith(c.name, []byte(content), 0644)
+			if err := f.(*bboltFile).CopyRange(c.srcOff, c.dstOff, c.length); err != nil {
+				t.Fatalf("%s: CopyRange: %v", c.name, err)
+			}
+			f.Close()
+			if got := readAll(t, fs, c.name); got != c.want {
+				t.Errorf("%s = %q, want %q", c.name, got, c.want)
+			}
+		}
+	})
+
+	t.Run("fs chunked", func(t *testing.T) {
+		fs := newTestFs(t, WithInlineThreshold(8))
+		fs.chunkSize = 4
+		for _, c := range cases {
+			f, _ := fs.CreateWith(c.name, []byte(content), 0644)
+			f.Close()
+			if err := fs.CopyRange(c.name, c.srcOff, c.dstOff, c.length); err != nil {
+				t.Fatalf("%s: CopyRange: %v", c.name, err)
+			}
+			if got := readAll(t, fs, c.name); got != c.want {
+				t.Errorf("%s = %q, want %q", c.name, got, c.want)
+			}
+			if info, _ := fs.Stat(c.name); info.Size() != int64(len(c.want)) {
+				t.Errorf("%s size = %d, want %d", c.name, info.Size(), len(c.want))
+			}
+		}
+		if err := fs.CopyRange("disjoint", 10, 0, 10); err == nil {
+			t.Errorf("CopyRange past end should fail")
+		}
+	})
+}
+
+func TestBBoltFs_DecodeMeta_ExtraFields(t *testing.T) {
+	fs := newTestFs(t)
+
+	// 模拟更新版本写入的记录: 已知字段之后还有 6 字节未知字段
+	extra := []byte{0xde, 0xad, 0xbe, 0xef, 0x01, 0x02}
+	head := fs.encodeMeta(fileMeta{Mode: 0640, Size: 5, ModTime: 99})
+	head = append(head, extra...)
+	head[1] = metaVersion + 1
+	binary.LittleEndian.PutUint16(head[2:4], uint16(len(head)))
+	val := append(head, "hello"...)
+	err := fs.db.Update(func(tx *bbolt.Tx) error {
+		if err := tx.Bucket([]byte(bucketFiles)).Put([]byte("future.txt"), val); err != nil {
+			return err
+		}
+		return indexPut(tx, "future.txt", false)
+	})
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	meta := rawMeta(t, fs, "future.txt")
+	if meta.Mode != 0640 || meta.Size != 5 || meta.ModTime != 99 || !bytes.Equal(meta.extra, extra) {
+		t.Errorf("decoded meta = %+v", meta)
+	}
+	if got := readAll(t, fs, "future.txt"); got != "hello" {
+		t.Errorf("content = %q, want %q", got, "hello")
+	}
+
+	// 改写元数据后未知字段和版本号依然保留
+	if err := fs.Chmod("future.txt", 0600); err != nil {
+		t.Fatalf("Chmod: %v", err)
+	}
+	meta = rawMeta(t, fs, "future.txt")
+	if meta.Mode != 0600 || !bytes.Equal(meta.extra, extra) || meta.version != metaVersion+1 {
+		t.Errorf("meta after rewrite = %+v", meta)
+	}
+	if got := readAll(t, fs, "future.txt"); got != "hello" {
+		t.Errorf("content after rewrite = %q, want %q", got, "hello")
+	}
+}
+
+func TestBBoltFs_ReadableMeta(t *testing.T) {
+	fs := newTestFs(t, WithReadableMeta(), WithInlineThreshold(16))
+	fs.chunkSize = 4
+
+	// 关闭选项写入一个二进制格式的文件, 开启后依然可以读取
+	fs.readableMeta = false
+	f, _ := fs.CreateWith("binary.txt", []byte("bin"), 0644)
+	f.Close()
+	fs.readableMeta = true
+
+	mtime := time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC)
+	for name, content := range map[string]string{"inline.txt": "line1\nline2", "chunked.txt": "0123456789abcdefXYZ"} {
+		f, err := fs.CreateWith(name, []byte(content), 0640)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		if err := fs.Chtimes(name, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		raw := rawValue(t, fs, name)
+		if !bytes.HasPrefix(raw, []byte(`{"`)) || !bytes.Contains(raw, []byte(`"mod_time":"2024-05-06T07:08:09.123456789Z"`)) {
+			t.Errorf("%s: stored meta = %q, want JSON with RFC3339 mod_time", name, raw)
+		}
+		info, err := fs.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() != int64(len(content)) || info.Mode() != 0640 || !info.ModTime().Equal(mtime) {
+			t.Errorf("%s: Stat = %d/%v/%v", name, info.Size(), info.Mode(), info.ModTime())
+		}
+		if got := readAll(t, fs, name); got != content {
+			t.Errorf("%s: content = %q, want %q", name, got, content)
+		}
+	}
+	if meta := rawMeta(t, fs, "chunked.txt"); meta.Storage != storageChunked || meta.ChunkSize != 4 || meta.Version == 0 {
+		t.Errorf("chunked meta = %+v", meta)
+	}
+
+	if got := readAll(t, fs, "binary.txt"); got != "bin" {
+		t.Errorf("binary.txt = %q", got)
+	}
+	if raw := rawValue(t, fs, "binary.txt"); raw[0] != metaMagic {
+		t.Errorf("binary.txt rewritten before any change: %q", raw)
+	}
+	// 改写元数据时转换为 JSON 格式
+	if err := fs.Chmod("binary.txt", 0600); err != nil {
+		t.Fatal(err)
+	}
+	if raw := rawValue(t, fs, "binary.txt"); !bytes.HasPrefix(raw, []byte(`{"`)) {
+		t.Errorf("binary.txt after Chmod = %q", raw)
+	}
+	if got := readAll(t, fs, "binary.txt"); got != "bin" {
+		t.Errorf("binary.txt after Chmod = %q", got)
+	}
+}
+
+func TestBBoltFs_StorageKind(t *testing.T) {
+	fs := newTestFs(t, WithInlineThreshold(16))
+	for name, size := range map[string]int{"small": 4, "large": 64} {
+		f, err := fs.CreateWith(name, bytes.Repeat([]byte("x"), size), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+	_ = fs.Mkdir("dir", 0755)
+
+	kind := func(fi os.FileInfo) Storage { return fi.Sys().(*SysInfo).Storage }
+	for name, want := range map[string]Storage{"small": StorageInline, "large": StorageChunked, "dir": StorageNone} {
+		fi, err := fs.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := kind(fi); got != want {
+			t.Errorf("Stat(%s) storage = %v, want %v", name, got, want)
+		}
+	}
+	// 目录列表中也报告存储方式
+	infos, err := fs.ReadDir("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 3 {
+		t.Fatalf("ReadDir = %d entries, want 3", len(infos))
+	}
+	for _, e := range infos {
+		fi, _ := e.Info()
+		if e.Name() == "large" && kind(fi) != StorageChunked || e.Name() == "small" && kind(fi) != StorageInline {
+			t.Errorf("ReadDir %s storage = %v", e.Name(), kind(fi))
+		}
+	}
+}
+
+func TestBBoltFs_DiskSize(t *testing.T) {
+	fs := newTestFs(t, WithInlineThreshold(16))
+	fs.chunkSize = 16
+
+	f, err := fs.CreateWith("small", []byte("hello"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	if n, err := fs.DiskSize("small"); err != nil || n != 5 {
+		t.Fatalf("DiskSize(small) = %d, %v", n, err)
+	}
+
+	// 分块文件中间的空洞不占用空间
+	f, err = fs.CreateWith("sparse", bytes.Repeat([]byte("a"), 16), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	if err := fs.CopyRange("sparse", 0, 160, 16); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := fs.Stat("sparse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	disk, err := fs.DiskSize("sparse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != 176 || disk != 32 {
+		t.Fatalf("logical size %d, disk size %d; want 176, 32", fi.Size(), disk)
+	}
+	if sys, ok := fi.Sys().(*SysInfo); !ok || sys.DiskSize != disk {
+		t.Errorf("Sys() = %+v", fi.Sys())
+	}
+
+	_ = fs.Mkdir("dir", 0755)
+	if _, err := fs.DiskSize("dir"); err != ErrIsDirectory {
+		t.Errorf("DiskSize(dir): err = %v", err)
+	}
+}
+
+func TestBBoltFile_WriteAt_TouchedChunksOnly(t *testing.T) {
+	fs := newTestFs(t, WithInlineThreshold(16))
+	fs.chunkSize = 16
+	f, err := fs.CreateWith("big", bytes.Repeat([]byte("."), 64), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	ino := rawMeta(t, fs, "big").Ino
+
+	// 直接改写第 3 块, 若 WriteAt 重写整个文件, 句柄中的旧内容会覆盖这一改动
+	marker := bytes.Repeat([]byte("M"), 16)
+	err = fs.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(bucketChunks)).Put(chunkKey(ino, 3), marker)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 跨越第 1、2 块的写入
+	if _, err := f.WriteAt([]byte("patch"), 30); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Repeat(".", 30) + "patch" + strings.Repeat(".", 13) + string(marker)
+	if got := readAll(t, fs, "big"); got != want {
+		t.Fatalf("content = %q, want %q", got, want)
+	}
+	if n := chunkCount(t, fs); n != 4 {
+		t.Errorf("chunk count = %d, want 4", n)
+	}
+
+	// 超出末尾的写入只追加新的分块并更新大小
+	if _, err := f.WriteAt([]byte("tail"), 80); err != nil {
+		t.Fatal(err)
+	}
+	if meta := rawMeta(t, fs, "big"); meta.Size != 84 {
+		t.Errorf("size = %d, want 84", meta.Size)
+	}
+	if got := readAll(t, fs, "big"); got[48:64] != string(marker) || got[80:] != "tail" {
+		t.Errorf("content after extend = %q", got)
+	}
+}
+
+func TestBBoltFs_ChunkSize(t *testing.T) {
+	path := mustTmpFile(t)
+	f1, err := New(path, WithInlineThreshold(1), WithChunkSize(4<<10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := f1.(*BBolt)
+	f, _ := fs.CreateWith("big", bytes.Repeat([]byte("."), 64<<10), 0644)
+	_ = f.Close()
+	if meta := rawMeta(t, fs, "big"); meta.ChunkSize != 4<<10 {
+		t.Fatalf("chunk size = %d, want %d", meta.ChunkSize, 4<<10)
+	}
+	if n := chunkCount(t, fs); n != 16 {
+		t.Errorf("chunk count = %d, want 16", n)
+	}
+
+	// 随机写入只改写涉及的分块, 其余分块的 value 不变
+	before := make(map[string]string)
+	_ = fs.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(bucketChunks)).ForEach(func(k, v []byte) error {
+			before[string(k)] = string(v)
+			return nil
+		})
+	})
+	f, _ = fs.OpenFile("big", os.O_RDWR, 0)
+	if _, err = f.WriteAt([]byte("XY"), 5<<10+100); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	ino := rawMeta(t, fs, "big").Ino
+	var changed [][]byte
+	_ = fs.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(bucketChunks)).ForEach(func(k, v []byte) error {
+			if before[string(k)] != string(v) {
+				changed = append(changed, append([]byte(nil), k...))
+			}
+			return nil
+		})
+	})
+	if len(changed) != 1 || !bytes.Equal(changed[0], chunkKey(ino, 1)) {
+		t.Errorf("changed chunks = %x, want only chunk 1", changed)
+	}
+	if got := readAll(t, fs, "big"); got[5<<10+100:5<<10+102] != "XY" || len(got) != 64<<10 {
+		t.Errorf("content after WriteAt: size %d", len(got))
+	}
+	_ = fs.Close()
+
+	// 以不同的分块大小重新打开, 已有文件仍可读写
+	f2, err := New(path, WithInlineThreshold(1), WithChunkSize(16<<10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs = f2.(*BBolt)
+	defer fs.Close()
+	f, _ = fs.OpenFile("big", os.O_RDWR, 0)
+	if _, err = f.WriteAt([]byte("Z"), 60<<10); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	if meta := rawMeta(t, fs, "big"); meta.ChunkSize != 4<<10 {
+		t.Errorf("chunk size after reopen = %d, want %d", meta.ChunkSize, 4<<10)
+	}
+	got := readAll(t, fs, "big")
+	if got[5<<10+100:5<<10+102] != "XY" || got[60<<10] != 'Z' {
+		t.Error("content lost after reopening with a different chunk size")
+	}
+	f, _ = fs.CreateWith("new", bytes.Repeat([]byte("n"), 64<<10), 0644)
+	_ = f.Close()
+	if meta := rawMeta(t, fs, "new"); meta.ChunkSize != 16<<10 {
+		t.Errorf("new file chunk size = %d, want %d", meta.ChunkSize, 16<<10)
+	}
+}
+
+func benchmarkPatch(b *testing.B, opts ...Option) {
+	fs := newTestFs(b, opts...)
+	f, err := fs.CreateWith("big", make([]byte, 4<<20), 0644)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+	patch := []byte("patch")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := f.WriteAt(patch, 2<<20); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// 分块文件只重写被修改的分块
+func BenchmarkBBoltFile_WriteAt_Chunked(b *testing.B) { benchmarkPatch(b, WithInlineThreshold(64<<10)) }
+
+func BenchmarkBBoltFile_WriteAt_Inline(b *testing.B) { benchmarkPatch(b) }
+
+func TestBBoltFs_OpenBuffered_Spill(t *testing.T) {
+	const spill = 128 << 10
+	fs := newTestFs(t, WithInlineThreshold(64<<10), WithSpillThreshold(spill))
+	f, err := fs.OpenBuffered("stream.bin", 32<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	block := make([]byte, 4<<10)
+	for i := 0; i < 256; i++ {
+		for j := range block {
+			block[j] = byte(i + j)
+		}
+		want.Write(block)
+		if _, err := f.Write(block); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		// 句柄只保存尚未写入数据库的内容
+		if c := f.(*bboltFile).buffer.Cap(); c > 2*spill {
+			t.Fatalf("buffer capacity %d after %d bytes, want <= %d", c, want.Len(), 2*spill)
+		}
+	}
+	if fi, _ := f.Stat(); fi.Size() != int64(want.Len()) {
+		t.Errorf("handle size = %d, want %d", fi.Size(), want.Len())
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if got := readAll(t, fs, "stream.bin"); got != want.String() {
+		t.Fatalf("content mismatch: %d bytes, want %d", len(got), want.Len())
+	}
+	if meta := rawMeta(t, fs, "stream.bin"); meta.Storage != storageChunked {
+		t.Errorf("storage = %d, want chunked", meta.Storage)
+	}
+
+	// 已释放内容的句柄在随机读取时重新加载
+	f, err = fs.OpenBuffered("stream.bin", 32<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	_, _ = f.Write(make([]byte, spill+1))
+	buf := make([]byte, 4)
+	if _, err := f.ReadAt(buf, 4<<10); err != nil || !bytes.Equal(buf, want.Bytes()[4<<10:4<<10+4]) {
+		t.Errorf("ReadAt after spill = %v, %v", buf, err)
+	}
+}
+
+func TestBBoltFs_FilesEqual(t *testing.T) {
+	fs := newTestFs(t, WithInlineThreshold(16))
+	fs.chunkSize = 8
+	long := strings.Repeat("0123456789", 4)
+	for name, content := range map[string]string{
+		"a":       long,
+		"b":       long,
+		"c":       long[:39] + "x",
+		"d":       long[:20],
+		"inline":  "short",
+		"inline2": "short",
+	} {
+		f, err := fs.CreateWith(name, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+	for _, tc := range []struct {
+		a, b string
+		want bool
+	}{
+		{"a", "b", true},
+		{"inline", "inline2", true},
+		{"a", "c", false}, // 大小相同, 最后一块不同
+		{"a", "d", false}, // 大小不同
+	} {
+		if got, err := fs.FilesEqual(tc.a, tc.b); err != nil || got != tc.want {
+			t.Errorf("FilesEqual(%s, %s) = %v, %v; want %v", tc.a, tc.b, got, err, tc.want)
+		}
+	}
+	if _, err := fs.FilesEqual("a", "missing"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("missing: err = %v", err)
+	}
+}
+
+func benchmarkRename(b *testing.B, opts ...Option) {
+	fs := newTestFs(b, opts...)
+	const size = 16 << 20
+	f, err := fs.CreateWith("a", bytes.Repeat([]byte("x"), size), 0644)
+	if err != nil {
+		b.Fatal(err)
+	}
+	_ = f.Close()
+	before := fs.db.Stats().TxStats
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		oldname, newname := "a", "b"
+		if i%2 == 1 {
+			oldname, newname = newname, oldname
+		}
+		if err := fs.Rename(oldname, newname); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	stats := fs.db.Stats().TxStats
+	diff := stats.Sub(&before)
+	written := diff.GetPageAlloc() / int64(b.N)
+	b.ReportMetric(float64(written), "bytes-written/op")
+	if fs.inlineThreshold > 0 && written > size/16 {
+		b.Fatalf("rename wrote %d bytes per op, file size %d", written, size)
+	}
+}
+
+// 分块文件的 Rename 只移动元数据, 分块按 inode 存储无需改写; 写入量与文件大小无关
+func BenchmarkBBoltFs_Rename_Chunked(b *testing.B) { benchmarkRename(b, WithInlineThreshold(64<<10)) }
+
+func BenchmarkBBoltFs_Rename_Inline(b *testing.B) { benchmarkRename(b) }
+
+func TestBBoltFs_WriteAtInlineFarOffset(t *testing.T) {
+	fs := newTestFs(t, WithInlineThreshold(16), WithLazyRead())
+	if err := fs.WriteString("a.txt", "abc", 0644); err != nil {
+		t.Fatal(err)
+	}
+	const off = 1 << 30
+
+	// 远处的写入直接转为分块存储, 空洞不分配内存
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if err := fs.CopyRange("a.txt", 0, off, 3); err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.OpenFile("a.txt", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.WriteAt([]byte("xyz"), 2*off); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	runtime.ReadMemStats(&after)
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 16<<20 {
+		t.Errorf("allocated %d bytes writing far past an inline file", alloc)
+	}
+
+	meta := rawMeta(t, fs, "a.txt")
+	if meta.Storage != storageChunked || meta.Size != 2*off+3 {
+		t.Errorf("storage = %d, size = %d", meta.Storage, meta.Size)
+	}
+	if disk, _ := fs.DiskSize("a.txt"); disk != 9 {
+		t.Errorf("DiskSize = %d, want 9", disk)
+	}
+	r, err := fs.NewSectionReader("a.txt", 0, meta.Size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for pos, want := range map[int64]string{0: "abc", off: "abc", 2 * off: "xyz"} {
+		buf := make([]byte, 3)
+		if _, err := r.ReadAt(buf, pos); err != nil || string(buf) != want {
+			t.Errorf("ReadAt(%d) = %q, %v, want %q", pos, buf, err, want)
+		}
+	}
+}
@@ -14,20 +14,34 @@ type bboltDirFile struct {
 }
 
 func (d *bboltDirFile) Name() string                                 { return d.name }
-func (d *bboltDirFile) Read(p []byte) (int, error)                   { return 0, io.EOF }
-func (d *bboltDirFile) ReadAt(p []byte, off int64) (int, error)      { return 0, io.EOF }
+func (d *bboltDirFile) Read(p []byte) (int, error)                   { return 0, d.readErr() }
+func (d *bboltDirFile) ReadAt(p []byte, off int64) (int, error)      { return 0, d.readErr() }
 func (d *bboltDirFile) Seek(offset int64, whence int) (int64, error) { return 0, io.EOF }
 func (d *bboltDirFile) Write(p []byte) (int, error)                  { return 0, os.ErrInvalid }
 func (d *bboltDirFile) WriteAt(p []byte, off int64) (int, error)     { return 0, os.ErrInvalid }
 func (d *bboltDirFile) WriteString(s string) (int, error)            { return 0, os.ErrInvalid }
-func (d *bboltDirFile) Close() error                                 { return nil }
+
+// readErr 返回读取目录内容时的错误: 默认为 io.EOF, 开启 WithStrictDirRead 时与 POSIX 一致返回 ErrIsDirectory
+func (d *bboltDirFile) readErr() error {
+	if d.fs.strictDirRead {
+		return ErrIsDirectory
+	}
+	return io.EOF
+}
+
+func (d *bboltDirFile) Close() error {
+	d.fs.untrack(d)
+	return nil
+}
 func (d *bboltDirFile) Stat() (os.FileInfo, error) {
 	return &fileInfo{
+		key:     d.name,
 		name:    filepath.Base(d.name),
 		size:    0,
 		mode:    d.meta.Mode,
 		modTime: time.Unix(0, d.meta.ModTime),
 		isDir:   true,
+		owner:   ownerOf(d.meta),
 	}, nil
 }
 func (d *bboltDirFile) Sync() error               { return nil }
@@ -35,6 +49,13 @@ func (d *bboltDirFile) Truncate(size int64) error { return os.ErrInvalid }
 func (d *bboltDirFile) Readdir(count int) ([]os.FileInfo, error) {
 	return d.fs.readDir(d.name, count)
 }
+func (d *bboltDirFile) ReadDir(n int) ([]os.DirEntry, error) {
+	infos, err := d.fs.readDir(d.name, n)
+	if err != nil {
+		return nil, err
+	}
+	return dirEntries(infos), nil
+}
 func (d *bboltDirFile) Readdirnames(n int) ([]string, error) {
 	infos, err := d.fs.readDir(d.name, n)
 	if err != nil {
@@ -3,11 +3,14 @@ package bboltfs
 import (
 	"bytes"
 	"errors"
+	"hash"
 	"io"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
+
+	"go.etcd.io/bbolt"
 )
 
 type fileInfo struct {
@@ -16,6 +19,37 @@ type fileInfo struct {
 	mode    os.FileMode
 	modTime time.Time
 	isDir   bool
+	nlink   uint64 // 链接数, 只在 Stat 时计算, 0 表示未知
+	disk    int64  // 内容实际占用的字节数, 只在 Stat 文件时计算
+	key     string // 在 bbolt 中存储使用的 key
+	storage Storage
+	owner   FileOwner
+}
+
+// FileOwner 是 Chown 设置的属主, 从未设置过时均为 0
+type FileOwner struct {
+	Uid int
+	Gid int
+}
+
+// ownerOf 返回 meta 中保存的属主
+func ownerOf(meta fileMeta) FileOwner {
+	return FileOwner{Uid: int(meta.Uid), Gid: int(meta.Gid)}
+}
+
+// SysInfo 是 fileInfo.Sys() 返回的附加信息, 供 FUSE 等需要 inode 属性的适配层使用
+type SysInfo struct {
+	// Nlink 是链接数: 文件为 1, 目录为 2 加上直接子目录的数量. 只有 Stat 返回的结果包含
+	// Nlink 和 DiskSize, 目录列表和句柄的 Stat 中为 0
+	Nlink uint64
+	// DiskSize 是内容在数据库中实际占用的字节数, 与 Size() 返回的逻辑大小不同, 目录为 0
+	DiskSize int64
+	// Key 是 files 或 dirs bucket 中对应的 key, 即路径经过规范化后的形式
+	Key string
+	// Storage 是文件内容的存储方式, 目录为 StorageNone
+	Storage Storage
+	// FileOwner 是 Chown 设置的属主
+	FileOwner
 }
 
 func (fi *fileInfo) Name() string       { return fi.name }
@@ -23,14 +57,35 @@ func (fi *fileInfo) Size() int64        { return fi.size }
 func (fi *fileInfo) Mode() os.FileMode  { return fi.mode }
 func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
 func (fi *fileInfo) IsDir() bool        { return fi.isDir }
-func (fi *fileInfo) Sys() interface{}   { return nil }
+func (fi *fileInfo) Sys() interface{} {
+	return &SysInfo{Nlink: fi.nlink, DiskSize: fi.disk, Key: fi.key, Storage: fi.storage, FileOwner: fi.owner}
+}
+
+// fileInfo 同时实现 fs.DirEntry, Readdir 和 ReadDir 共用同一个结构
+func (fi *fileInfo) Type() os.FileMode          { return fi.mode.Type() }
+func (fi *fileInfo) Info() (os.FileInfo, error) { return fi, nil }
+
+var (
+	_ os.FileInfo = (*fileInfo)(nil)
+	_ os.DirEntry = (*fileInfo)(nil)
+)
 
 // fileMeta 存储文件或目录的元信息
 type fileMeta struct {
-	Mode    os.FileMode
-	Size    int64
-	ModTime int64
-	IsDir   bool
+	Mode      os.FileMode
+	Size      int64
+	ModTime   int64
+	IsDir     bool
+	Storage   uint8  // 内容的存储方式, 见 storageInline/storageChunked
+	Ino       uint64 // 分块存储时内容所属的 inode
+	ChunkSize uint32 // 分块存储时每块的大小
+	Version   uint64 // 内容版本号, 每次写入内容时分配新的值, 用于生成 ETag
+	Seq       uint64 // 创建序号, 创建时分配且之后不变, 用于按创建顺序列出目录
+	Uid       int32  // 属主, 只由 Chown 修改
+	Gid       int32
+
+	version byte   // 解码时读到的格式版本
+	extra   []byte // 更新版本写入的未知字段, 重新编码时原样保留
 }
 
 // --------- bboltFile 实现 ---------
@@ -42,6 +97,20 @@ type bboltFile struct {
 	offset int64
 	mu     sync.Mutex
 	closed bool
+
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	bufSize int   // 缓冲模式下积累多少字节后写入数据库, 0 表示每次修改都立即写入
+	pending int   // 尚未写入数据库的字节数
+	dirty   bool  // 是否有尚未写入数据库的修改
+	base    int64 // 缓冲模式下已写入数据库并从内存中释放的内容长度, buffer 只保存 base 之后的内容
+
+	hash hash.Hash // 缓冲模式下随写入增量计算的内容 SHA-256, 出现覆盖写入后为 nil
+
+	appendOnly bool // 以 O_APPEND 打开, 每次 Write 都追加到数据库中文件当前的末尾
+
+	records []JournalRecord // 尚未写入数据库的修改的日志记录, 与修改在同一个事务中写入
 }
 
 func (f *bboltFile) Name() string { return f.name }
@@ -52,7 +121,20 @@ func (f *bboltFile) Read(p []byte) (int, error) {
 	if f.closed {
 		return 0, os.ErrClosed
 	}
-	return f.buffer.Read(p)
+	if err := f.checkDeadline(f.readDeadline); err != nil {
+		return 0, err
+	}
+	// 从 offset 处读取, 不移动 buffer 自身的读取位置, 与 ReadAt 和 Seek 保持一致
+	if f.offset >= f.base+int64(f.buffer.Len()) {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	n, err := f.readContent(p, f.offset)
+	f.offset += int64(n)
+	f.fs.ioStats.add(f.name, n, 0)
+	return n, err
 }
 
 func (f *bboltFile) ReadAt(p []byte, off int64) (int, error) {
@@ -61,14 +143,61 @@ func (f *bboltFile) ReadAt(p []byte, off int64) (int, error) {
 	if f.closed {
 		return 0, os.ErrClosed
 	}
-	buf := f.buffer.Bytes()
-	if off >= int64(len(buf)) {
-		return 0, io.EOF
+	if err := f.checkDeadline(f.readDeadline); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, errors.New("negative offset")
 	}
-	n := copy(p, buf[off:])
-	if n == 0 {
+	if off >= f.base+int64(f.buffer.Len()) {
 		return 0, io.EOF
 	}
+	n, err := f.readContent(p, off)
+	f.fs.ioStats.add(f.name, n, 0)
+	if err != nil {
+		return n, err
+	}
+	if n < len(p) {
+		// io.ReaderAt 要求读取不足时返回错误
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// readContent 将 off 处的内容读入 p, 返回读取的字节数. 已写入数据库而不在内存中的 base 之前的部分
+// 只读取涉及的分块, 因此读取大文件 (包括带空洞的稀疏文件) 的一小段不需要分配整个文件的内存
+func (f *bboltFile) readContent(p []byte, off int64) (int, error) {
+	size := f.base + int64(f.buffer.Len())
+	if off >= size {
+		return 0, nil
+	}
+	if int64(len(p)) > size-off {
+		p = p[:size-off]
+	}
+	n := 0
+	if off < f.base {
+		head := p
+		if int64(len(head)) > f.base-off {
+			head = head[:f.base-off]
+		}
+		err := f.fs.view(func(tx *bbolt.Tx) error {
+			val := tx.Bucket([]byte(bucketFiles)).Get([]byte(f.name))
+			if val == nil {
+				return ErrFileNotFound
+			}
+			meta, inline := f.fs.splitMeta(val)
+			// 其他句柄截短了文件时, 超出部分读作 0
+			clear(head[f.fs.readAt(tx, meta, inline, head, off):])
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+		n = len(head)
+	}
+	if n < len(p) {
+		n += copy(p[n:], f.buffer.Bytes()[off+int64(n)-f.base:])
+	}
 	return n, nil
 }
 
@@ -78,14 +207,15 @@ func (f *bboltFile) Seek(offset int64, whence int) (int64, error) {
 	if f.closed {
 		return 0, os.ErrClosed
 	}
+	// 只移动位置, 内容由之后的 Read 或覆盖写入按需读入
 	var abs int64
 	switch whence {
 	case io.SeekStart:
 		abs = offset
 	case io.SeekCurrent:
-		abs = int64(f.buffer.Len()) + offset
+		abs = f.offset + offset
 	case io.SeekEnd:
-		abs = int64(f.buffer.Len()) + offset
+		abs = f.meta.Size + offset
 	default:
 		return 0, errors.New("invalid whence")
 	}
@@ -102,13 +232,52 @@ func (f *bboltFile) Write(p []byte) (int, error) {
 	if f.closed {
 		return 0, os.ErrClosed
 	}
+	if err := f.checkDeadline(f.writeDeadline); err != nil {
+		return 0, err
+	}
+	if f.appendOnly {
+		return f.appendWrite(p)
+	}
+	off := f.base + int64(f.buffer.Len())
+	if f.offset != off {
+		// 不在末尾时与 os.File 一样从当前位置覆盖写入
+		n, err := f.writeAt(p, f.offset)
+		f.offset += int64(n)
+		return n, err
+	}
 	n, err := f.buffer.Write(p)
+	f.offset += int64(n)
+	f.fs.ioStats.add(f.name, 0, n)
+	if f.hash != nil {
+		f.hash.Write(p[:n])
+	}
 	if err != nil {
 		return n, err
 	}
-	f.meta.Size = int64(f.buffer.Len())
+	f.meta.Size = f.base + int64(f.buffer.Len())
+	f.meta.ModTime = time.Now().UnixNano()
+	f.log(JournalRecord{Op: OpWrite, Path: f.name, Offset: off, Data: p[:n], Size: f.meta.Size})
+	return n, f.save(n)
+}
+
+// log 记录一次修改, 日志在修改写入数据库的事务中一起写入
+func (f *bboltFile) log(rec JournalRecord) {
+	f.records = f.fs.deferRecord(f.records, rec)
+}
+
+// appendWrite 在一个事务中将 p 追加到数据库中文件的末尾, 其他句柄在此期间追加的内容不会被覆盖
+func (f *bboltFile) appendWrite(p []byte) (int, error) {
+	n, err := f.fs.Append(f.name, p)
+	if err != nil {
+		return n, err
+	}
+	f.buffer.Write(p)
+	f.meta.Size = f.base + int64(f.buffer.Len())
 	f.meta.ModTime = time.Now().UnixNano()
-	return n, f.fs.saveFile(f.name, f.buffer.Bytes(), f.meta)
+	f.offset = f.meta.Size
+	f.hash = nil
+	f.fs.ioStats.add(f.name, 0, n)
+	return n, nil
 }
 
 func (f *bboltFile) WriteAt(p []byte, off int64) (int, error) {
@@ -117,20 +286,194 @@ func (f *bboltFile) WriteAt(p []byte, off int64) (int, error) {
 	if f.closed {
 		return 0, os.ErrClosed
 	}
+	if f.appendOnly {
+		// 与 os.File 一样, O_APPEND 打开的文件不允许指定位置写入
+		return 0, errors.New("bboltfs: WriteAt on file opened with O_APPEND")
+	}
+	if err := f.checkDeadline(f.writeDeadline); err != nil {
+		return 0, err
+	}
+	return f.writeAt(p, off)
+}
+
+// writeAt 在持有 f.mu 时将 p 写入 off 位置, 不改变 offset
+func (f *bboltFile) writeAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if f.base > 0 {
+		// 部分内容只在数据库中: 先写入缓冲的修改, 再直接改写涉及的分块, 不载入整个文件
+		if err := f.flush(); err != nil {
+			return 0, err
+		}
+		f.hashAt(off, f.base, p)
+		f.meta.ModTime = time.Now().UnixNano()
+		f.log(JournalRecord{Op: OpWrite, Path: f.name, Offset: off, Data: p, Size: max(f.base, off+int64(len(p)))})
+		found, err := f.patch(p, off)
+		if err != nil {
+			return 0, err
+		}
+		if !found {
+			return 0, ErrFileNotFound
+		}
+		f.base = f.meta.Size
+		f.fs.ioStats.add(f.name, 0, len(p))
+		return len(p), nil
+	}
+	if err := f.unspill(); err != nil {
+		return 0, err
+	}
 	buf := f.buffer.Bytes()
+	f.hashAt(off, int64(len(buf)), p)
 	if off > int64(len(buf)) {
 		// 填充0
 		padding := make([]byte, off-int64(len(buf)))
 		f.buffer.Write(padding)
 		buf = f.buffer.Bytes()
 	}
-	tmp := make([]byte, len(buf))
+	end := off + int64(len(p))
+	if end < int64(len(buf)) {
+		end = int64(len(buf))
+	}
+	tmp := make([]byte, end)
 	copy(tmp, buf)
 	copy(tmp[off:], p)
 	f.buffer = bytes.NewBuffer(tmp)
 	f.meta.Size = int64(f.buffer.Len())
 	f.meta.ModTime = time.Now().UnixNano()
-	return len(p), f.fs.saveFile(f.name, f.buffer.Bytes(), f.meta)
+	f.fs.ioStats.add(f.name, 0, len(p))
+	f.log(JournalRecord{Op: OpWrite, Path: f.name, Offset: off, Data: p, Size: f.meta.Size})
+	return len(p), f.saveAt(p, off)
+}
+
+// save 记录一次修改; 非缓冲模式或缓冲区已满时立即写入数据库
+func (f *bboltFile) save(n int) error {
+	f.dirty = true
+	f.pending += n
+	if f.bufSize > 0 && f.pending < f.bufSize {
+		return nil
+	}
+	return f.flush()
+}
+
+// saveAt 记录一次 WriteAt. 非缓冲模式且没有其他未写入的修改时, 只更新数据库中写入涉及的分块,
+// 不重写整个文件; 其余情况与 save 相同
+func (f *bboltFile) saveAt(p []byte, off int64) error {
+	if f.bufSize > 0 || f.dirty {
+		return f.save(len(p))
+	}
+	found, err := f.patch(p, off)
+	if err != nil || found {
+		return err
+	}
+	// 文件已被删除, 与其他写入一样按句柄中的内容重新创建
+	return f.save(len(p))
+}
+
+// patch 在一个事务中将 p 写入数据库中文件的 off 处并记录尚未写入的日志, 只更新涉及的分块;
+// 返回文件是否存在, 不存在时不做任何事
+func (f *bboltFile) patch(p []byte, off int64) (bool, error) {
+	var found bool
+	err := f.fs.update(func(tx *bbolt.Tx) error {
+		val := tx.Bucket([]byte(bucketFiles)).Get([]byte(f.name))
+		if val == nil {
+			return nil
+		}
+		found = true
+		meta, err := f.fs.writeAt(tx, f.name, val, p, off, f.meta.ModTime)
+		if err != nil {
+			return err
+		}
+		f.meta = meta
+		return f.fs.recordTx(tx, f.records...)
+	})
+	if err == nil && found {
+		f.records = nil
+	}
+	return found, err
+}
+
+// flush 将尚未写入的修改写入数据库
+func (f *bboltFile) flush() error {
+	if !f.dirty {
+		return nil
+	}
+	if f.base > 0 || (f.bufSize > 0 && f.fs.spillThreshold > 0 && f.buffer.Len() > f.fs.spillThreshold) {
+		return f.spill()
+	}
+	if err := f.fs.saveFile(f.name, f.buffer.Bytes(), f.meta, f.records...); err != nil {
+		return err
+	}
+	f.dirty, f.pending, f.records = false, 0, nil
+	return nil
+}
+
+// spill 将内存中 base 之后的内容写入数据库 (分块存储的文件只写涉及的分块) 并释放这部分内存,
+// 使大量追加写入时句柄占用的内存保持在 WithSpillThreshold 附近
+func (f *bboltFile) spill() error {
+	err := f.fs.update(func(tx *bbolt.Tx) error {
+		val := tx.Bucket([]byte(bucketFiles)).Get([]byte(f.name))
+		if val == nil {
+			return ErrFileNotFound
+		}
+		meta, err := f.fs.writeAt(tx, f.name, val, f.buffer.Bytes(), f.base, f.meta.ModTime)
+		if err != nil {
+			return err
+		}
+		f.meta = meta
+		f.fs.saves.Add(1)
+		return f.fs.recordTx(tx, f.records...)
+	})
+	if err != nil {
+		return err
+	}
+	f.base += int64(f.buffer.Len())
+	f.buffer = new(bytes.Buffer)
+	f.dirty, f.pending, f.records = false, 0, nil
+	return nil
+}
+
+// unspill 在需要随机访问内容前, 将已释放的内容重新从数据库读入内存
+func (f *bboltFile) unspill() error {
+	if f.base == 0 {
+		return nil
+	}
+	if err := f.flush(); err != nil {
+		return err
+	}
+	data, meta, err := f.fs.loadFile(f.name)
+	if err != nil {
+		return err
+	}
+	f.buffer, f.meta, f.base = bytes.NewBuffer(data), meta, 0
+	return nil
+}
+
+// CopyRange 将文件中 [srcOff, srcOff+length) 的内容复制到 dstOff 处, 与 memmove 一样允许区间重叠,
+// 目标区间超出文件末尾时文件会变大
+func (f *bboltFile) CopyRange(srcOff, dstOff, length int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	if err := f.unspill(); err != nil {
+		return err
+	}
+	buf := f.buffer.Bytes()
+	if srcOff < 0 || dstOff < 0 || length < 0 || srcOff+length > int64(len(buf)) {
+		return os.ErrInvalid
+	}
+	f.hash = nil
+	if end := dstOff + length; end > int64(len(buf)) {
+		buf = append(buf, make([]byte, end-int64(len(buf)))...)
+	}
+	copy(buf[dstOff:dstOff+length], buf[srcOff:srcOff+length])
+	f.buffer = bytes.NewBuffer(buf)
+	f.meta.Size = int64(len(buf))
+	f.meta.ModTime = time.Now().UnixNano()
+	f.log(JournalRecord{Op: OpWrite, Path: f.name, Offset: dstOff, Data: buf[dstOff : dstOff+length], Size: f.meta.Size})
+	return f.save(int(length))
 }
 
 func (f *bboltFile) WriteString(s string) (int, error) {
@@ -140,21 +483,74 @@ func (f *bboltFile) WriteString(s string) (int, error) {
 func (f *bboltFile) Close() error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
+	if f.closed {
+		return nil
+	}
+	if err := f.flush(); err != nil {
+		return err
+	}
 	f.closed = true
+	f.fs.untrack(f)
+	if f.fs.syncOnClose && !f.fs.readOnly {
+		f.fs.dbMu.RLock()
+		defer f.fs.dbMu.RUnlock()
+		return f.fs.db.Sync()
+	}
+	return nil
+}
+
+// SetDeadline 同时设置读写的截止时间, 零值表示不设截止时间
+func (f *bboltFile) SetDeadline(t time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.readDeadline, f.writeDeadline = t, t
+	return nil
+}
+
+// SetReadDeadline 设置读操作的截止时间, 超过后 Read/ReadAt 返回 os.ErrDeadlineExceeded
+func (f *bboltFile) SetReadDeadline(t time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.readDeadline = t
+	return nil
+}
+
+// SetWriteDeadline 设置写操作的截止时间, 超过后 Write/WriteAt 返回 os.ErrDeadlineExceeded
+func (f *bboltFile) SetWriteDeadline(t time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.writeDeadline = t
+	return nil
+}
+
+func (f *bboltFile) checkDeadline(deadline time.Time) error {
+	if !deadline.IsZero() && !time.Now().Before(deadline) {
+		return os.ErrDeadlineExceeded
+	}
 	return nil
 }
 
 func (f *bboltFile) Stat() (os.FileInfo, error) {
 	return &fileInfo{
+		key:     f.name,
 		name:    filepath.Base(f.name),
 		size:    f.meta.Size,
 		mode:    f.meta.Mode,
 		modTime: time.Unix(0, f.meta.ModTime),
 		isDir:   f.meta.IsDir,
+		storage: storageOf(f.meta),
+		owner:   ownerOf(f.meta),
 	}, nil
 }
 
-func (f *bboltFile) Sync() error { return nil }
+func (f *bboltFile) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	return f.flush()
+}
 
 func (f *bboltFile) Truncate(size int64) error {
 	f.mu.Lock()
@@ -162,7 +558,15 @@ func (f *bboltFile) Truncate(size int64) error {
 	if f.closed {
 		return os.ErrClosed
 	}
+	if size < 0 {
+		return &os.PathError{Op: "truncate", Path: f.name, Err: os.ErrInvalid}
+	}
+	if f.base > 0 || (f.fs.inlineThreshold > 0 && size >= int64(f.fs.inlineThreshold)) {
+		// 截断后使用分块存储时直接在数据库中截断, 扩展的部分作为空洞
+		return f.truncateStored(size)
+	}
 	buf := f.buffer.Bytes()
+	f.hashAt(size, int64(len(buf)), nil)
 	if int(size) < len(buf) {
 		f.buffer = bytes.NewBuffer(buf[:size])
 	} else if int(size) > len(buf) {
@@ -171,13 +575,43 @@ func (f *bboltFile) Truncate(size int64) error {
 	}
 	f.meta.Size = size
 	f.meta.ModTime = time.Now().UnixNano()
-	return f.fs.saveFile(f.name, f.buffer.Bytes(), f.meta)
+	f.log(JournalRecord{Op: OpTruncate, Path: f.name, Size: size})
+	return f.save(0)
+}
+
+// truncateStored 在持有 f.mu 时截断数据库中的文件: 先写入缓冲的修改,
+// 再按分块截断或扩展数据库中的内容, 不把整个文件读入内存
+func (f *bboltFile) truncateStored(size int64) error {
+	if err := f.flush(); err != nil {
+		return err
+	}
+	f.hashAt(size, f.base+int64(f.buffer.Len()), nil)
+	err := f.fs.update(func(tx *bbolt.Tx) error {
+		if err := f.fs.truncateTx(tx, f.name, size, time.Now().UnixNano()); err != nil {
+			return err
+		}
+		f.meta = f.fs.decodeMeta(tx.Bucket([]byte(bucketFiles)).Get([]byte(f.name)))
+		return f.fs.recordTx(tx, JournalRecord{Op: OpTruncate, Path: f.name, Size: size})
+	})
+	if err != nil {
+		return err
+	}
+	f.base, f.buffer = size, new(bytes.Buffer)
+	return nil
 }
 
 func (f *bboltFile) Readdir(count int) ([]os.FileInfo, error) {
 	return f.fs.readDir(f.name, count)
 }
 
+func (f *bboltFile) ReadDir(n int) ([]os.DirEntry, error) {
+	infos, err := f.fs.readDir(f.name, n)
+	if err != nil {
+		return nil, err
+	}
+	return dirEntries(infos), nil
+}
+
 func (f *bboltFile) Readdirnames(n int) ([]string, error) {
 	infos, err := f.fs.readDir(f.name, n)
 	if err != nil {
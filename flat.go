@@ -0,0 +1,63 @@
+package bboltfs
+
+import (
+	"bytes"
+	"os"
+	"sort"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// pseudoDirMode 是 WithFlatMode 下由文件路径推导出的目录的权限
+const pseudoDirMode = os.ModeDir | 0755
+
+// flatPrefix 返回 WithFlatMode 下目录 dir 内所有文件 key 共同的前缀
+func flatPrefix(dir string) []byte {
+	if dir == "" || dir[len(dir)-1] == '/' {
+		return []byte(dir)
+	}
+	return []byte(dir + "/")
+}
+
+// isPseudoDir 判断 WithFlatMode 下是否有文件位于 name 之下
+func isPseudoDir(tx *bbolt.Tx, name string) bool {
+	prefix := flatPrefix(name)
+	k, _ := tx.Bucket([]byte(bucketFiles)).Cursor().Seek(prefix)
+	return k != nil && bytes.HasPrefix(k, prefix)
+}
+
+// flatReadDirTx 扫描 files bucket 中以 dir 为前缀的 key, 列出直接子文件和推导出的子目录,
+// count > 0 时最多返回 count 项
+func (fs *BBolt) flatReadDirTx(tx *bbolt.Tx, dir string, count int) []os.FileInfo {
+	var fis []os.FileInfo
+	prefix := flatPrefix(dir)
+	c := tx.Bucket([]byte(bucketFiles)).Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); {
+		rest := k[len(prefix):]
+		if i := bytes.IndexByte(rest, '/'); i >= 0 {
+			sub := string(rest[:i])
+			fis = append(fis, &fileInfo{key: string(prefix) + sub, name: sub, mode: pseudoDirMode, modTime: time.Unix(0, 0), isDir: true})
+			// 跳过该子目录下的其余文件: '0' 是 '/' 之后的字符
+			k, v = c.Seek([]byte(string(prefix) + sub + "0"))
+			continue
+		}
+		meta := fs.decodeMeta(v)
+		fis = append(fis, &fileInfo{
+			key:     string(k),
+			name:    string(rest),
+			size:    meta.Size,
+			mode:    meta.Mode,
+			modTime: time.Unix(0, meta.ModTime),
+			storage: storageOf(meta),
+			owner:   ownerOf(meta),
+		})
+		k, v = c.Next()
+	}
+	// key 顺序中 "a-b" 在 "a/..." 之前, 按名称重新排序
+	sort.Slice(fis, func(i, j int) bool { return fis[i].Name() < fis[j].Name() })
+	if count > 0 && len(fis) > count {
+		fis = fis[:count]
+	}
+	return fis
+}
@@ -0,0 +1,65 @@
+package bboltfs
+
+import (
+	"reflect"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestBBoltFs_FlatMode(t *testing.T) {
+	fs := newTestFs(t, WithFlatMode())
+	if err := fs.Mkdir("ignored", 0755); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	if err := fs.MkdirAll("a/b", 0755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	// 父目录不需要存在
+	for _, name := range []string{"top.txt", "a/one", "a/b/two", "a/b/three", "a-b", "z/deep/file"} {
+		f, err := fs.CreateWith(name, []byte(name), 0644)
+		if err != nil {
+			t.Fatalf("Create %s: %v", name, err)
+		}
+		_ = f.Close()
+	}
+
+	err := fs.db.View(func(tx *bbolt.Tx) error {
+		if n := tx.Bucket([]byte(bucketDirs)).Stats().KeyN; n != 0 {
+			t.Errorf("dirs bucket has %d entries, want 0", n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := readDirNames(t, fs, ""); !reflect.DeepEqual(names, []string{"a", "a-b", "top.txt", "z"}) {
+		t.Errorf("ReadDir(root) = %v", names)
+	}
+	if names := readDirNames(t, fs, "a"); !reflect.DeepEqual(names, []string{"b", "one"}) {
+		t.Errorf("ReadDir(a) = %v", names)
+	}
+	if names := readDirNames(t, fs, "a/b"); !reflect.DeepEqual(names, []string{"three", "two"}) {
+		t.Errorf("ReadDir(a/b) = %v", names)
+	}
+
+	fi, err := fs.Stat("z/deep")
+	if err != nil || !fi.IsDir() {
+		t.Errorf("Stat(z/deep) = %v, %v; want pseudo directory", fi, err)
+	}
+	if _, err := fs.Stat("ignored"); err == nil {
+		t.Error("Mkdir should not create anything in flat mode")
+	}
+	d, err := fs.Open("a")
+	if err != nil {
+		t.Fatalf("Open(a): %v", err)
+	}
+	defer d.Close()
+	if names, err := d.Readdirnames(0); err != nil || !reflect.DeepEqual(names, []string{"b", "one"}) {
+		t.Errorf("Readdirnames = %v, %v", names, err)
+	}
+	if got := readAll(t, fs, "a/b/two"); got != "a/b/two" {
+		t.Errorf("content = %q", got)
+	}
+}
@@ -0,0 +1,112 @@
+package bboltfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+// bucketMeta 保存数据库级别的信息, 目前只有格式版本
+const (
+	bucketMeta       = "meta"
+	keyFormatVersion = "format_version"
+)
+
+// 数据库格式版本:
+//
+//	1: 只有 files 和 dirs bucket, 元数据为 21 字节的旧格式
+//	2: 增加目录索引、分块存储和带版本头部的元数据
+//
+// 没有 meta bucket 的数据库由已有的 bucket 推断版本. 修改格式时增加 currentFormatVersion,
+// 并在 migrations 中添加从上一个版本升级的函数
+const currentFormatVersion = 2
+
+var ErrFormatTooNew = errors.New("bboltfs: database format is newer than supported")
+
+// migrations[n] 在事务中将数据库从版本 n 升级到 n+1
+var migrations = map[int]func(fs *BBolt, tx *bbolt.Tx) error{
+	1: migrateV1,
+}
+
+// detectFormat 返回数据库的格式版本, 新建的数据库返回 0
+func detectFormat(tx *bbolt.Tx) int {
+	if b := tx.Bucket([]byte(bucketMeta)); b != nil {
+		if v := b.Get([]byte(keyFormatVersion)); len(v) == 4 {
+			return int(binary.BigEndian.Uint32(v))
+		}
+	}
+	switch {
+	case tx.Bucket([]byte(bucketFiles)) == nil:
+		return 0
+	case tx.Bucket([]byte(bucketIndex)) == nil:
+		return 1
+	default:
+		return currentFormatVersion
+	}
+}
+
+// checkFormat 拒绝打开比当前代码更新的格式, 避免旧版本改写后损坏数据
+func checkFormat(version int) error {
+	if version > currentFormatVersion {
+		return fmt.Errorf("%w: version %d, supported %d", ErrFormatTooNew, version, currentFormatVersion)
+	}
+	return nil
+}
+
+// migrate 将数据库逐个版本升级到 currentFormatVersion, 需要在创建好所有 bucket 之后调用
+func (fs *BBolt) migrate(tx *bbolt.Tx, version int) error {
+	if err := checkFormat(version); err != nil {
+		return err
+	}
+	// 新建的数据库 (version 为 0) 直接使用当前格式
+	for v := version; v > 0 && v < currentFormatVersion; v++ {
+		if err := migrations[v](fs, tx); err != nil {
+			return fmt.Errorf("migrate format %d to %d: %w", v, v+1, err)
+		}
+	}
+	b, err := tx.CreateBucketIfNotExists([]byte(bucketMeta))
+	if err != nil {
+		return err
+	}
+	v := make([]byte, 4)
+	binary.BigEndian.PutUint32(v, currentFormatVersion)
+	return b.Put([]byte(keyFormatVersion), v)
+}
+
+// migrateV1 生成目录索引, 并将旧格式的元数据改写为带版本的头部
+func migrateV1(fs *BBolt, tx *bbolt.Tx) error {
+	for _, name := range []string{bucketFiles, bucketDirs} {
+		b := tx.Bucket([]byte(name))
+		updates := make(map[string][]byte)
+		// ForEach 期间不能修改 bucket, 先收集需要改写的记录
+		err := b.ForEach(func(k, v []byte) error {
+			if len(v) >= 4 && (v[0] == metaMagic && v[1] >= metaVersion || v[0] == '{' && v[1] == '"') {
+				return nil
+			}
+			meta, inline := fs.splitMeta(v)
+			updates[string(k)] = append(fs.encodeMeta(meta), inline...)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for k, v := range updates {
+			if err = b.Put([]byte(k), v); err != nil {
+				return err
+			}
+		}
+	}
+	return buildIndex(tx)
+}
+
+// FormatVersion 返回数据库的格式版本. 可写模式下 New 已将数据库升级到当前版本
+func (fs *BBolt) FormatVersion() (int, error) {
+	var v int
+	err := fs.view(func(tx *bbolt.Tx) error {
+		v = detectFormat(tx)
+		return nil
+	})
+	return v, err
+}
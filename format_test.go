@@ -0,0 +1,92 @@
+package bboltfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestNew_MigratesLegacyFormat(t *testing.T) {
+	path := mustTmpFile(t)
+	// 版本 1 的数据库: 只有 files 和 dirs, 元数据为 21 字节的旧格式
+	legacy := func(mode os.FileMode, size int64, isDir bool, content string) []byte {
+		buf := new(bytes.Buffer)
+		_ = binary.Write(buf, binary.LittleEndian, mode)
+		_ = binary.Write(buf, binary.LittleEndian, size)
+		_ = binary.Write(buf, binary.LittleEndian, int64(42))
+		_ = binary.Write(buf, binary.LittleEndian, isDir)
+		buf.WriteString(content)
+		return buf.Bytes()
+	}
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		files, _ := tx.CreateBucket([]byte(bucketFiles))
+		dirs, _ := tx.CreateBucket([]byte(bucketDirs))
+		if err := dirs.Put([]byte("dir"), legacy(os.ModeDir|0755, 0, true, "")); err != nil {
+			return err
+		}
+		return files.Put([]byte("dir/old.txt"), legacy(0644, 6, false, "legacy"))
+	})
+	_ = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := New(path)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	fs := f.(*BBolt)
+	defer fs.Close()
+	if v, err := fs.FormatVersion(); err != nil || v != currentFormatVersion {
+		t.Errorf("FormatVersion = %d, %v; want %d", v, err, currentFormatVersion)
+	}
+	if raw := rawValue(t, fs, "dir/old.txt"); raw[0] != metaMagic || raw[1] != metaVersion {
+		t.Errorf("record not migrated: %q", raw)
+	}
+	if got := readAll(t, fs, "dir/old.txt"); got != "legacy" {
+		t.Errorf("content = %q, want %q", got, "legacy")
+	}
+	if fi, err := fs.Stat("dir/old.txt"); err != nil || fi.Size() != 6 || fi.Mode() != 0644 || fi.ModTime().UnixNano() != 42 {
+		t.Errorf("Stat = %v, %v", fi, err)
+	}
+	if names := readDirNames(t, fs, "dir"); !reflect.DeepEqual(names, []string{"old.txt"}) {
+		t.Errorf("ReadDir after migration = %v", names)
+	}
+}
+
+func TestNew_FormatVersion(t *testing.T) {
+	path := mustTmpFile(t)
+	f, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := f.(*BBolt).FormatVersion(); err != nil || v != currentFormatVersion {
+		t.Errorf("FormatVersion of new db = %d, %v", v, err)
+	}
+	// 模拟更新版本写入的数据库
+	err = f.(*BBolt).db.Update(func(tx *bbolt.Tx) error {
+		v := make([]byte, 4)
+		binary.BigEndian.PutUint32(v, currentFormatVersion+1)
+		return tx.Bucket([]byte(bucketMeta)).Put([]byte(keyFormatVersion), v)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	if _, err := New(path); !errors.Is(err, ErrFormatTooNew) {
+		t.Errorf("New on newer format: err = %v, want ErrFormatTooNew", err)
+	}
+	if _, err := New(path, WithReadOnly()); !errors.Is(err, ErrFormatTooNew) {
+		t.Errorf("New read-only on newer format: err = %v, want ErrFormatTooNew", err)
+	}
+}
@@ -2,6 +2,12 @@ module github.com/busyster996/bboltfs
 
 go 1.24.4
 
-require go.etcd.io/bbolt v1.4.2
+require (
+	github.com/spf13/afero v1.15.0
+	go.etcd.io/bbolt v1.4.2
+)
 
-require golang.org/x/sys v0.29.0 // indirect
+require (
+	golang.org/x/sys v0.29.0 // indirect
+	golang.org/x/text v0.28.0 // indirect
+)
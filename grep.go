@@ -0,0 +1,73 @@
+package bboltfs
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+
+	"go.etcd.io/bbolt"
+)
+
+// grepMaxLine 是 Grep 支持的最长行, 超过该长度的文件剩余部分不再搜索
+const grepMaxLine = 1 << 20
+
+// Match 是 Grep 找到的一行
+type Match struct {
+	Path string
+	Line int // 从 1 开始的行号
+	Text string
+}
+
+// Grep 在文件 prefix 或目录 prefix 下的所有文件中逐行匹配正则表达式 pattern, 按路径和行号顺序返回匹配的行.
+// 与 RemoveAll 一样只匹配 prefix 本身及其下的路径, 不包括 prefix10、prefix.txt 等只是前缀相同的兄弟.
+// 文件内容逐块读取, 内存占用与文件大小无关; 开头包含 NUL 字节的文件视为二进制文件并跳过, 符号链接同样跳过
+func (fs *BBolt) Grep(pattern string, prefix string) ([]Match, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	prefix = fs.normalize(prefix)
+	var matches []Match
+	err = fs.view(func(tx *bbolt.Tx) error {
+		grep := func(k, v []byte) error {
+			meta, inline := fs.splitMeta(v)
+			if meta.Mode&os.ModeSymlink != 0 {
+				return nil
+			}
+			r := bufio.NewReader(&contentReader{fs: fs, tx: tx, meta: meta, inline: inline})
+			if head, _ := r.Peek(512); bytes.IndexByte(head, 0) >= 0 {
+				return nil
+			}
+			sc := bufio.NewScanner(r)
+			sc.Buffer(nil, grepMaxLine)
+			for line := 1; sc.Scan(); line++ {
+				if re.Match(sc.Bytes()) {
+					matches = append(matches, Match{Path: string(k), Line: line, Text: sc.Text()})
+				}
+			}
+			if err := sc.Err(); err != nil && !errors.Is(err, bufio.ErrTooLong) {
+				return err
+			}
+			return nil
+		}
+		b := tx.Bucket([]byte(bucketFiles))
+		p := []byte(prefix + "/")
+		if prefix == "" || strings.HasSuffix(prefix, "/") {
+			p = []byte(prefix)
+		} else if v := b.Get([]byte(prefix)); v != nil {
+			// prefix 是文件时只搜索它本身
+			return grep([]byte(prefix), v)
+		}
+		c := b.Cursor()
+		for k, v := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, v = c.Next() {
+			if err := grep(k, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return matches, err
+}
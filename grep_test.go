@@ -0,0 +1,75 @@
+package bboltfs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBBoltFs_Grep(t *testing.T) {
+	fs := newTestFs(t, WithInlineThreshold(32))
+	fs.chunkSize = 16
+	_ = fs.MkdirAll("logs", 0755)
+	files := map[string]string{
+		"logs/a.log":  "ok\nERROR disk full\nok\n",
+		"logs/b.log":  strings.Repeat("filler line\n", 5) + "late ERROR here\n",
+		"logs/c.bin":  "\x00\x01ERROR in binary\n",
+		"other/d.log": "ERROR outside prefix\n",
+	}
+	for name, content := range files {
+		f, err := fs.CreateWith(name, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+
+	got, err := fs.Grep(`ERROR \w+`, "logs/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Match{
+		{Path: "logs/a.log", Line: 2, Text: "ERROR disk full"},
+		{Path: "logs/b.log", Line: 6, Text: "late ERROR here"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Grep = %+v, want %+v", got, want)
+	}
+
+	if _, err := fs.Grep("(", ""); err == nil {
+		t.Error("invalid pattern should fail")
+	}
+}
+
+func TestBBoltFs_GrepSiblingPrefix(t *testing.T) {
+	fs := newTestFs(t)
+	for name, content := range map[string]string{
+		"logs/a.log":     "ERROR inside\n",
+		"logs10/b.log":   "ERROR sibling dir\n",
+		"logs.txt":       "ERROR sibling file\n",
+		"logs-old/c.log": "ERROR sibling dir\n",
+	} {
+		if err := fs.WriteString(name, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 只匹配 logs 本身及其下的文件, 不能扩展到只是前缀相同的兄弟
+	got, err := fs.Grep("ERROR", "logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Match{{Path: "logs/a.log", Line: 1, Text: "ERROR inside"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Grep(logs) = %+v, want %+v", got, want)
+	}
+	// prefix 是文件时只搜索该文件
+	got, err = fs.Grep("ERROR", "logs.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Match{{Path: "logs.txt", Line: 1, Text: "ERROR sibling file"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Grep(logs.txt) = %+v, want %+v", got, want)
+	}
+	if got, err = fs.Grep("ERROR", ""); err != nil || len(got) != 4 {
+		t.Errorf("Grep(root) = %+v, %v", got, err)
+	}
+}
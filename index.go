@@ -0,0 +1,193 @@
+package bboltfs
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// 目录索引: key 为 "父目录\x00名称", value 为 1 字节类型加上完整的存储 key,
+// 用于快速列出目录下的直接子项, 而不必扫描整个 files bucket
+const (
+	indexFile byte = 'f'
+	indexDir  byte = 'd'
+)
+
+// splitPath 将路径拆分为父目录和名称
+func splitPath(name string) (dir, base string) {
+	i := strings.LastIndex(name, "/")
+	if i < 0 {
+		return "", name
+	}
+	return name[:i], name[i+1:]
+}
+
+// indexPrefix 返回目录 dir 下所有子项索引共同的前缀
+func indexPrefix(dir string) []byte {
+	return []byte(strings.TrimSuffix(dir, "/") + "\x00")
+}
+
+func indexKey(name string) []byte {
+	dir, base := splitPath(name)
+	return append(indexPrefix(dir), base...)
+}
+
+func indexPut(tx *bbolt.Tx, name string, isDir bool) error {
+	typ := indexFile
+	if isDir {
+		typ = indexDir
+	}
+	if err := tx.Bucket([]byte(bucketIndex)).Put(indexKey(name), append([]byte{typ}, name...)); err != nil {
+		return err
+	}
+	return orderPut(tx, name, isDir)
+}
+
+func indexDelete(tx *bbolt.Tx, name string) error {
+	if err := tx.Bucket([]byte(bucketIndex)).Delete(indexKey(name)); err != nil {
+		return err
+	}
+	return orderDelete(tx, name)
+}
+
+// buildIndex 根据 files 和 dirs 重新生成目录索引, 调用方需保证索引 bucket 为空
+func buildIndex(tx *bbolt.Tx) error {
+	err := tx.Bucket([]byte(bucketDirs)).ForEach(func(k, _ []byte) error {
+		return indexPut(tx, string(k), true)
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Bucket([]byte(bucketFiles)).ForEach(func(k, _ []byte) error {
+		return indexPut(tx, string(k), false)
+	})
+}
+
+func (fs *BBolt) readDir(dir string, count int) ([]os.FileInfo, error) {
+	var fis []os.FileInfo
+	err := fs.view(func(tx *bbolt.Tx) error {
+		fis = fs.readDirTx(tx, dir, count)
+		return nil
+	})
+	return fis, err
+}
+
+// readDirTx 在事务 tx 中通过索引列出目录 dir 的直接子项, count > 0 时最多返回 count 项
+func (fs *BBolt) readDirTx(tx *bbolt.Tx, dir string, count int) []os.FileInfo {
+	if fs.flat {
+		return fs.flatReadDirTx(tx, dir, count)
+	}
+	if fs.creationOrder && tx.Bucket([]byte(bucketOrder)) != nil {
+		return fs.orderReadDirTx(tx, dir, count)
+	}
+	var fis []os.FileInfo
+	prefix := indexPrefix(dir)
+	c := tx.Bucket([]byte(bucketIndex)).Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		fi := fs.indexEntry(tx, string(k[len(prefix):]), v)
+		if fi == nil {
+			continue // 索引与数据不一致时跳过该项
+		}
+		fis = append(fis, fi)
+		if count > 0 && len(fis) >= count {
+			break
+		}
+	}
+	return fis
+}
+
+// indexEntry 根据名称为 base 的索引项 v 读出子项的元信息, 数据不存在时返回 nil
+func (fs *BBolt) indexEntry(tx *bbolt.Tx, base string, v []byte) *fileInfo {
+	if len(v) == 0 {
+		return nil
+	}
+	b := tx.Bucket([]byte(bucketFiles))
+	if v[0] == indexDir {
+		b = tx.Bucket([]byte(bucketDirs))
+	}
+	val := b.Get(v[1:])
+	if val == nil {
+		return nil
+	}
+	meta := fs.decodeMeta(val)
+	fi := &fileInfo{
+		key:     string(v[1:]),
+		name:    fs.displayName(tx, string(v[1:]), base),
+		size:    meta.Size,
+		mode:    meta.Mode,
+		modTime: time.Unix(0, meta.ModTime),
+		isDir:   meta.IsDir,
+		storage: storageOf(meta),
+		owner:   ownerOf(meta),
+	}
+	if v[0] == indexDir {
+		fi.size, fi.isDir, fi.storage = 0, true, StorageNone
+	}
+	return fi
+}
+
+// touchParent 更新 name 所在目录的修改时间, 与 POSIX 一样在创建、删除或重命名直接子项时调用.
+// 父目录没有对应的记录 (如根目录) 时不做任何事
+func (fs *BBolt) touchParent(tx *bbolt.Tx, name string) error {
+	dir, _ := splitPath(name)
+	b := tx.Bucket([]byte(bucketDirs))
+	val := b.Get([]byte(dir))
+	if val == nil {
+		return nil
+	}
+	meta := fs.decodeMeta(val)
+	meta.ModTime = time.Now().UnixNano()
+	return b.Put([]byte(dir), fs.encodeMeta(meta))
+}
+
+// subdirCount 通过索引统计目录 dir 的直接子目录数量
+func subdirCount(tx *bbolt.Tx, dir string) uint64 {
+	var n uint64
+	prefix := indexPrefix(dir)
+	c := tx.Bucket([]byte(bucketIndex)).Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		if v[0] == indexDir {
+			n++
+		}
+	}
+	return n
+}
+
+// RebuildIndex 在一个事务中丢弃目录索引, 并根据 files 和 dirs 重新生成
+func (fs *BBolt) RebuildIndex() error {
+	return fs.update(func(tx *bbolt.Tx) error {
+		if err := tx.DeleteBucket([]byte(bucketIndex)); err != nil && !errors.Is(err, bbolt.ErrBucketNotFound) {
+			return err
+		}
+		if _, err := tx.CreateBucket([]byte(bucketIndex)); err != nil {
+			return err
+		}
+		// 创建顺序索引随目录索引一起重建
+		if tx.Bucket([]byte(bucketOrder)) != nil {
+			if err := tx.DeleteBucket([]byte(bucketOrder)); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket([]byte(bucketOrder)); err != nil {
+				return err
+			}
+		}
+		return buildIndex(tx)
+	})
+}
+
+// AllDirs 扫描一次 dirs bucket, 返回按字典序排列的所有目录路径
+func (fs *BBolt) AllDirs() ([]string, error) {
+	var dirs []string
+	err := fs.view(func(tx *bbolt.Tx) error {
+		// bbolt 的 key 本身按字节序排列, 无需额外排序
+		return tx.Bucket([]byte(bucketDirs)).ForEach(func(k, _ []byte) error {
+			dirs = append(dirs, string(k))
+			return nil
+		})
+	})
+	return dirs, err
+}
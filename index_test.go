@@ -0,0 +1,208 @@
+package bboltfs
+
+import (
+	"reflect"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+func readDirNames(t *testing.T, fs *BBolt, dir string) []string {
+	t.Helper()
+	infos, err := fs.readDir(dir, 0)
+	if err != nil {
+		t.Fatalf("readDir %s: %v", dir, err)
+	}
+	names := []string{}
+	for _, fi := range infos {
+		names = append(names, fi.Name())
+	}
+	return names
+}
+
+func TestBBoltFs_Rename_UpdatesIndex(t *testing.T) {
+	fs := newTestFs(t)
+
+	_ = fs.Mkdir("a", 0755)
+	_ = fs.Mkdir("b", 0755)
+	f, _ := fs.CreateWith("a/x.txt", []byte("x"), 0644)
+	f.Close()
+	f, _ = fs.CreateWith("a/y.txt", []byte("y"), 0644)
+	f.Close()
+
+	if got := readDirNames(t, fs, "a"); !reflect.DeepEqual(got, []string{"x.txt", "y.txt"}) {
+		t.Fatalf("a = %v before rename", got)
+	}
+	if err := fs.Rename("a/x.txt", "b/x.txt"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if got := readDirNames(t, fs, "a"); !reflect.DeepEqual(got, []string{"y.txt"}) {
+		t.Errorf("a = %v after rename, want [y.txt]", got)
+	}
+	if got := readDirNames(t, fs, "b"); !reflect.DeepEqual(got, []string{"x.txt"}) {
+		t.Errorf("b = %v after rename, want [x.txt]", got)
+	}
+	if got := readDirNames(t, fs, ""); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("root = %v, want [a b]", got)
+	}
+	if got := readAll(t, fs, "b/x.txt"); got != "x" {
+		t.Errorf("content = %q, want %q", got, "x")
+	}
+}
+
+func TestBBoltFs_RebuildIndex(t *testing.T) {
+	fs := newTestFs(t)
+
+	_ = fs.MkdirAll("a/sub", 0755)
+	f, _ := fs.Create("a/x.txt")
+	f.Close()
+
+	// 破坏索引: 删除一项并添加一个悬空项
+	err := fs.db.Update(func(tx *bbolt.Tx) error {
+		if err := indexDelete(tx, "a/x.txt"); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(bucketIndex)).Put(indexKey("a/ghost"), append([]byte{indexFile}, "a/ghost"...))
+	})
+	if err != nil {
+		t.Fatalf("corrupt: %v", err)
+	}
+	if got := readDirNames(t, fs, "a"); reflect.DeepEqual(got, []string{"sub", "x.txt"}) {
+		t.Fatalf("index not corrupted: %v", got)
+	}
+
+	if err := fs.RebuildIndex(); err != nil {
+		t.Fatalf("RebuildIndex: %v", err)
+	}
+	if got := readDirNames(t, fs, "a"); !reflect.DeepEqual(got, []string{"sub", "x.txt"}) {
+		t.Errorf("a = %v after rebuild, want [sub x.txt]", got)
+	}
+	var n int
+	_ = fs.db.View(func(tx *bbolt.Tx) error {
+		n = tx.Bucket([]byte(bucketIndex)).Stats().KeyN
+		return nil
+	})
+	if n != 3 {
+		t.Errorf("index has %d keys, want 3", n)
+	}
+}
+
+func TestBBoltFs_AllDirs(t *testing.T) {
+	fs := newTestFs(t)
+
+	_ = fs.MkdirAll("b/c/d", 0755)
+	_ = fs.MkdirAll("a/x", 0755)
+	_ = fs.Mkdir("a-b", 0755)
+	f, _ := fs.Create("a/file.txt")
+	f.Close()
+
+	dirs, err := fs.AllDirs()
+	if err != nil {
+		t.Fatalf("AllDirs: %v", err)
+	}
+	want := []string{"a", "a-b", "a/x", "b", "b/c", "b/c/d"}
+	if !reflect.DeepEqual(dirs, want) {
+		t.Errorf("AllDirs = %v, want %v", dirs, want)
+	}
+}
+
+func TestBBoltFs_DirNlink(t *testing.T) {
+	fs := newTestFs(t)
+	_ = fs.MkdirAll("top/a/x", 0755)
+	_ = fs.MkdirAll("top/b", 0755)
+	_ = fs.MkdirAll("top/c", 0755)
+	f, err := fs.CreateWith("top/file.txt", nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	nlink := func(name string) uint64 {
+		t.Helper()
+		fi, err := fs.Stat(name)
+		if err != nil {
+			t.Fatalf("Stat %s: %v", name, err)
+		}
+		sys, ok := fi.Sys().(*SysInfo)
+		if !ok {
+			t.Fatalf("Sys() of %s = %T", name, fi.Sys())
+		}
+		return sys.Nlink
+	}
+	// 文件和孙目录不计入, 只统计直接子目录
+	for name, want := range map[string]uint64{"top": 5, "top/a": 3, "top/b": 2, "top/file.txt": 1} {
+		if got := nlink(name); got != want {
+			t.Errorf("nlink(%s) = %d, want %d", name, got, want)
+		}
+	}
+}
+
+func TestBBoltFs_DirMtimeOnChildChange(t *testing.T) {
+	fs := newTestFs(t)
+	_ = fs.MkdirAll("src", 0755)
+	_ = fs.MkdirAll("dst", 0755)
+	// 将目录的修改时间设为很早的时间, 便于判断是否被更新
+	reset := func(dirs ...string) {
+		t.Helper()
+		err := fs.db.Update(func(tx *bbolt.Tx) error {
+			b := tx.Bucket([]byte(bucketDirs))
+			for _, d := range dirs {
+				meta := fs.decodeMeta(b.Get([]byte(d)))
+				meta.ModTime = 1
+				if err := b.Put([]byte(d), fs.encodeMeta(meta)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	advanced := func(step, dir string) {
+		t.Helper()
+		fi, err := fs.Stat(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.ModTime().UnixNano() <= 1 {
+			t.Errorf("%s: mtime of %s not updated", step, dir)
+		}
+	}
+
+	reset("src")
+	f, err := fs.CreateWith("src/a", []byte("x"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	advanced("create", "src")
+
+	// 修改已有文件的内容不算目录的变化
+	reset("src")
+	if err := fs.Truncate("src/a", 0); err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := fs.Stat("src"); fi.ModTime().UnixNano() != 1 {
+		t.Errorf("write to child changed parent mtime")
+	}
+
+	reset("src", "dst")
+	if err := fs.Rename("src/a", "dst/a"); err != nil {
+		t.Fatal(err)
+	}
+	advanced("rename", "src")
+	advanced("rename", "dst")
+
+	reset("dst")
+	if err := fs.Remove("dst/a"); err != nil {
+		t.Fatal(err)
+	}
+	advanced("remove", "dst")
+
+	reset("dst")
+	if err := fs.Mkdir("dst/sub", 0755); err != nil {
+		t.Fatal(err)
+	}
+	advanced("mkdir", "dst")
+}
@@ -0,0 +1,177 @@
+package bboltfs
+
+import (
+	"io"
+	iofs "io/fs"
+	"os"
+	"sort"
+)
+
+// FS 返回文件系统的 io/fs.FS 视图, 可以交给 fs.WalkDir、fs.Sub、template.ParseFS、http.FS 等标准库工具使用.
+// 返回值同时实现 fs.ReadDirFS、fs.StatFS 和 fs.ReadFileFS, 路径按 fs.ValidPath 的规则校验, "." 表示根目录
+func (fs *BBolt) FS() iofs.FS {
+	return ioFS{fs: fs}
+}
+
+type ioFS struct {
+	fs *BBolt
+}
+
+// key 校验 io/fs 风格的路径并转换为 BBolt 使用的路径, 根目录为 ""
+func (f ioFS) key(op, name string) (string, error) {
+	if !iofs.ValidPath(name) {
+		return "", &iofs.PathError{Op: op, Path: name, Err: iofs.ErrInvalid}
+	}
+	if name == "." {
+		return "", nil
+	}
+	return name, nil
+}
+
+// rootInfo 返回根目录的元信息, 根目录在数据库中没有对应的记录
+func rootInfo() *fileInfo {
+	return &fileInfo{name: ".", mode: os.ModeDir | 0755, isDir: true}
+}
+
+func (f ioFS) Open(name string) (iofs.File, error) {
+	key, err := f.key("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		return &ioDir{fs: f.fs, path: name, info: rootInfo()}, nil
+	}
+	h, err := f.fs.Open(key)
+	if err != nil {
+		return nil, &iofs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if _, ok := h.(*bboltFile); ok {
+		return h, nil
+	}
+	// 目录句柄的 ReadDir 每次都从头列出, 这里改为按 fs.ReadDirFile 的约定分批返回
+	defer h.Close()
+	fi, err := h.Stat()
+	if err != nil {
+		return nil, &iofs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &ioDir{fs: f.fs, key: h.Name(), path: name, info: fi}, nil
+}
+
+func (f ioFS) Stat(name string) (iofs.FileInfo, error) {
+	key, err := f.key("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		return rootInfo(), nil
+	}
+	fi, err := f.fs.Stat(key)
+	if err != nil {
+		return nil, &iofs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return fi, nil
+}
+
+func (f ioFS) ReadDir(name string) ([]iofs.DirEntry, error) {
+	key, err := f.key("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := readDirSorted(f.fs, key)
+	if err != nil {
+		return nil, &iofs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return entries, nil
+}
+
+func (f ioFS) ReadFile(name string) ([]byte, error) {
+	key, err := f.key("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		return nil, &iofs.PathError{Op: "readfile", Path: name, Err: ErrIsDirectory}
+	}
+	s, err := f.fs.ReadString(key)
+	if err != nil {
+		return nil, &iofs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+	return []byte(s), nil
+}
+
+// readDirSorted 返回目录 key 按名称排序的子项, key 不是目录时返回 ErrNotDirectory
+func readDirSorted(fs *BBolt, key string) ([]iofs.DirEntry, error) {
+	if key != "" {
+		fi, err := fs.Stat(key)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			return nil, ErrNotDirectory
+		}
+	}
+	entries, err := fs.ReadDir(key)
+	if err != nil {
+		return nil, err
+	}
+	// 开启 WithCreationOrderListing 时 ReadDir 按创建顺序返回, io/fs 要求按名称排序
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// ioDir 是 ioFS 打开的目录, 第一次 ReadDir 时读取全部子项, 之后按 fs.ReadDirFile 的约定分批返回
+type ioDir struct {
+	fs      *BBolt
+	key     string
+	path    string
+	info    iofs.FileInfo
+	entries []iofs.DirEntry
+	loaded  bool
+	closed  bool
+}
+
+func (d *ioDir) Stat() (iofs.FileInfo, error) {
+	if d.closed {
+		return nil, &iofs.PathError{Op: "stat", Path: d.path, Err: iofs.ErrClosed}
+	}
+	return d.info, nil
+}
+
+func (d *ioDir) Read([]byte) (int, error) {
+	return 0, &iofs.PathError{Op: "read", Path: d.path, Err: ErrIsDirectory}
+}
+
+func (d *ioDir) Close() error {
+	if d.closed {
+		return &iofs.PathError{Op: "close", Path: d.path, Err: iofs.ErrClosed}
+	}
+	d.closed = true
+	return nil
+}
+
+func (d *ioDir) ReadDir(n int) ([]iofs.DirEntry, error) {
+	if d.closed {
+		return nil, &iofs.PathError{Op: "readdir", Path: d.path, Err: iofs.ErrClosed}
+	}
+	if !d.loaded {
+		entries, err := readDirSorted(d.fs, d.key)
+		if err != nil {
+			return nil, &iofs.PathError{Op: "readdir", Path: d.path, Err: err}
+		}
+		d.entries, d.loaded = entries, true
+	}
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
@@ -0,0 +1,128 @@
+package bboltfs
+
+import (
+	"errors"
+	"io"
+	iofs "io/fs"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func newIOFsTest(t *testing.T, opts ...Option) *BBolt {
+	t.Helper()
+	fs := newTestFs(t, opts...)
+	err := fs.LoadFromFS(fstest.MapFS{
+		"readme.md":             {Data: []byte("# demo"), Mode: 0644},
+		"web/index.html":        {Data: []byte("<html></html>"), Mode: 0644},
+		"web/static/app.js":     {Data: []byte("console.log(1)"), Mode: 0644},
+		"web/static/style.css":  {Data: []byte("body{}"), Mode: 0644},
+		"web/templates/a.tmpl":  {Data: []byte("{{.}}"), Mode: 0644},
+		"empty":                 {Mode: iofs.ModeDir | 0755},
+		"data/2024/01/log.txt":  {Data: []byte("jan"), Mode: 0600},
+		"data/2024/02/log.txt":  {Data: []byte("feb"), Mode: 0600},
+		"data/2024/02/zero.bin": {Mode: 0600},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func TestBBoltFs_FS_WalkDir(t *testing.T) {
+	fsys := newIOFsTest(t).FS()
+	var visited []string
+	err := iofs.WalkDir(fsys, ".", func(p string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		visited = append(visited, p)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		".",
+		"data", "data/2024", "data/2024/01", "data/2024/01/log.txt",
+		"data/2024/02", "data/2024/02/log.txt", "data/2024/02/zero.bin",
+		"empty",
+		"readme.md",
+		"web", "web/index.html", "web/static", "web/static/app.js", "web/static/style.css",
+		"web/templates", "web/templates/a.tmpl",
+	}
+	if !reflect.DeepEqual(visited, want) {
+		t.Errorf("WalkDir visited\n%q\nwant\n%q", visited, want)
+	}
+
+	// fs.Sub 之后的子树同样可以遍历
+	sub, err := iofs.Sub(fsys, "web/static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names, err := iofs.Glob(sub, "*.js"); err != nil || !reflect.DeepEqual(names, []string{"app.js"}) {
+		t.Errorf("Glob(sub, *.js) = %q, %v", names, err)
+	}
+}
+
+func TestBBoltFs_FS_TestFS(t *testing.T) {
+	fs := newIOFsTest(t, WithCreationOrderListing())
+	if err := fstest.TestFS(fs.FS(), "readme.md", "web/static/app.js", "data/2024/02/zero.bin", "empty"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBBoltFs_FS_Paths(t *testing.T) {
+	fs := newIOFsTest(t)
+	fsys := fs.FS()
+	for _, name := range []string{"/readme.md", "web/", "./readme.md", "web/../readme.md", ""} {
+		if _, err := fsys.Open(name); !errors.Is(err, iofs.ErrInvalid) {
+			t.Errorf("Open(%q) = %v, want ErrInvalid", name, err)
+		}
+		if _, err := iofs.Stat(fsys, name); !errors.Is(err, iofs.ErrInvalid) {
+			t.Errorf("Stat(%q) = %v, want ErrInvalid", name, err)
+		}
+	}
+	if _, err := fsys.Open("missing"); !errors.Is(err, iofs.ErrNotExist) {
+		t.Errorf("Open(missing) = %v, want ErrNotExist", err)
+	}
+	if data, err := iofs.ReadFile(fsys, "web/index.html"); err != nil || string(data) != "<html></html>" {
+		t.Errorf("ReadFile = %q, %v", data, err)
+	}
+	if _, err := iofs.ReadDir(fsys, "readme.md"); !errors.Is(err, ErrNotDirectory) {
+		t.Errorf("ReadDir(file) = %v, want ErrNotDirectory", err)
+	}
+
+	// 目录句柄的 ReadDir(n) 分批返回, 读完后返回 io.EOF
+	f, err := fsys.Open("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	dir := f.(iofs.ReadDirFile)
+	var names []string
+	for {
+		entries, err := dir.ReadDir(1)
+		if err == io.EOF {
+			break
+		}
+		if err != nil || len(entries) != 1 {
+			t.Fatalf("ReadDir(1) = %v, %v", entries, err)
+		}
+		names = append(names, entries[0].Name())
+	}
+	if want := []string{"index.html", "static", "templates"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("paged ReadDir = %q, want %q", names, want)
+	}
+
+	// 符号链接在 Open 和 Stat 时都会被跟随
+	if err = fs.Symlink("web/index.html", "home.html"); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := iofs.Stat(fsys, "home.html"); err != nil || fi.Size() != int64(len("<html></html>")) {
+		t.Errorf("Stat(symlink) = %v, %v", fi, err)
+	}
+	if data, err := iofs.ReadFile(fsys, "home.html"); err != nil || string(data) != "<html></html>" {
+		t.Errorf("ReadFile(symlink) = %q, %v", data, err)
+	}
+}
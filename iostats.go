@@ -0,0 +1,64 @@
+package bboltfs
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrIOStatsDisabled = errors.New("bboltfs: io stats are not enabled")
+
+// ioStats 按路径统计通过句柄、OpenReader 和 ReadFileInto 读写的字节数, 只保存在内存中.
+// nil 表示未开启统计, 所有方法都可以在 nil 上调用
+type ioStats struct {
+	mu sync.Mutex
+	m  map[string]*ioCounter
+}
+
+type ioCounter struct {
+	read, write int64
+}
+
+func newIOStats() *ioStats {
+	return &ioStats{m: make(map[string]*ioCounter)}
+}
+
+func (s *ioStats) add(name string, read, write int) {
+	if s == nil || read <= 0 && write <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.m[name]
+	if !ok {
+		c = &ioCounter{}
+		s.m[name] = c
+	}
+	c.read += int64(max(read, 0))
+	c.write += int64(max(write, 0))
+}
+
+func (s *ioStats) get(name string) (ioCounter, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.m[name]
+	if !ok {
+		return ioCounter{}, false
+	}
+	return *c, true
+}
+
+// IOStats 返回开启 WithIOStats 以来通过路径 name 读取和写入的字节数. 计数按路径累计,
+// 重命名或删除文件不会清零. 未开启统计时返回 ErrIOStatsDisabled, 路径既没有计数也不存在时返回 ErrFileNotFound
+func (fs *BBolt) IOStats(name string) (readBytes, writeBytes int64, err error) {
+	if fs.ioStats == nil {
+		return 0, 0, ErrIOStatsDisabled
+	}
+	name = fs.normalize(name)
+	if c, ok := fs.ioStats.get(name); ok {
+		return c.read, c.write, nil
+	}
+	if _, err := fs.stat(name); err != nil {
+		return 0, 0, err
+	}
+	return 0, 0, nil
+}
@@ -0,0 +1,64 @@
+package bboltfs
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestBBoltFs_IOStats(t *testing.T) {
+	fs := newTestFs(t, WithIOStats())
+	f, err := fs.Create("hot.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("hello, "); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("world"), 7); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	f, err = fs.Open("hot.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.ReadAt(make([]byte, 5), 7); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(f); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	if _, err := fs.ReadFileInto("hot.txt", make([]byte, 64)); err != nil {
+		t.Fatal(err)
+	}
+
+	r, w, err := fs.IOStats("hot.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != 12+5+12 || w != 7+5 {
+		t.Errorf("IOStats = %d, %d; want 29, 12", r, w)
+	}
+
+	mustCreate := func(name string) {
+		f, err := fs.CreateWith(name, nil, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+	mustCreate("cold.txt")
+	if r, w, err := fs.IOStats("cold.txt"); err != nil || r != 0 || w != 0 {
+		t.Errorf("IOStats(cold.txt) = %d, %d, %v", r, w, err)
+	}
+	if _, _, err := fs.IOStats("missing"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("IOStats(missing): err = %v, want ErrFileNotFound", err)
+	}
+
+	if _, _, err := newTestFs(t).IOStats("hot.txt"); !errors.Is(err, ErrIOStatsDisabled) {
+		t.Errorf("IOStats without option: err = %v", err)
+	}
+}
@@ -0,0 +1,215 @@
+package bboltfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// 日志记录的操作类型
+const (
+	OpCreate    = "create"
+	OpMkdir     = "mkdir"
+	OpWrite     = "write"
+	OpTruncate  = "truncate"
+	OpRemove    = "remove"
+	OpRemoveAll = "removeall"
+	OpRename    = "rename"
+	OpChmod     = "chmod"
+	OpChtimes   = "chtimes"
+	OpSymlink   = "symlink"
+	OpChown     = "chown"
+)
+
+// JournalRecord 描述一次成功的修改操作
+type JournalRecord struct {
+	Op      string      `json:"op"`
+	Path    string      `json:"path"`
+	Time    time.Time   `json:"time"`
+	Size    int64       `json:"size"`
+	NewPath string      `json:"new_path,omitempty"` // rename 的目标路径
+	Mode    os.FileMode `json:"mode,omitempty"`     // create/mkdir/chmod 的权限
+	Offset  int64       `json:"offset,omitempty"`   // write 的写入位置
+	Data    []byte      `json:"data,omitempty"`     // write 写入的内容
+	ModTime int64       `json:"mod_time,omitempty"` // chtimes 的修改时间 (UnixNano)
+	Target  string      `json:"target,omitempty"`   // symlink 的目标
+	Uid     int         `json:"uid,omitempty"`      // chown 的属主
+	Gid     int         `json:"gid,omitempty"`
+}
+
+// recordTx 在写事务 tx 中记录修改, 未开启日志时不做任何事. WithChangeLog 的记录与修改在同一个事务中写入,
+// 回滚时一起丢弃; WithJournal 的日志在事务提交后才写出
+func (fs *BBolt) recordTx(tx *bbolt.Tx, recs ...JournalRecord) error {
+	if fs.journal == nil && !fs.changeLog {
+		return nil
+	}
+	for _, rec := range recs {
+		if rec.Time.IsZero() {
+			rec.Time = time.Now()
+		}
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		if fs.changeLog {
+			b := tx.Bucket([]byte(bucketChanges))
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			if err = b.Put(changeKey(JournalPos(seq)), line); err != nil {
+				return err
+			}
+		}
+		if fs.journal != nil {
+			fs.pending = append(fs.pending, line)
+		}
+	}
+	return nil
+}
+
+// deferRecord 将尚未写入数据库的修改的日志 rec 追加到 recs, 之后与修改一起交给 recordTx; 未开启日志时原样返回 recs
+func (fs *BBolt) deferRecord(recs []JournalRecord, rec JournalRecord) []JournalRecord {
+	if fs.journal == nil && !fs.changeLog {
+		return recs
+	}
+	// 写入数据库前调用方可能复用 Data
+	rec.Time, rec.Data = time.Now(), bytes.Clone(rec.Data)
+	return append(recs, rec)
+}
+
+// writeJournal 将已提交的事务中记录的日志写入 WithJournal 指定的 io.Writer
+func (fs *BBolt) writeJournal(lines [][]byte) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	fs.journalMu.Lock()
+	defer fs.journalMu.Unlock()
+	for _, line := range lines {
+		if _, err := fs.journal.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bucketChanges 存储 WithChangeLog 记录的修改, key 为 8 字节大端序的序列号, value 为 JSON 格式的 JournalRecord
+const bucketChanges = "changes"
+
+// JournalPos 是修改记录的位置, 即最后一条已读取记录的序列号, 0 表示从头开始
+type JournalPos uint64
+
+// Change 是 ChangesSince 返回的一条修改记录
+type Change struct {
+	Pos JournalPos
+	JournalRecord
+}
+
+func changeKey(pos JournalPos) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(pos))
+	return key
+}
+
+// ChangesSince 返回位置 pos 之后的所有修改记录以及新的位置, 副本保存新位置后即可增量拉取.
+// 没有新的修改时返回的位置与 pos 相同
+func (fs *BBolt) ChangesSince(pos JournalPos) ([]Change, JournalPos, error) {
+	var changes []Change
+	err := fs.view(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucketChanges))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.Seek(changeKey(pos + 1)); k != nil; k, v = c.Next() {
+			ch := Change{Pos: JournalPos(binary.BigEndian.Uint64(k))}
+			if err := json.Unmarshal(v, &ch.JournalRecord); err != nil {
+				return fmt.Errorf("decode change %d: %w", ch.Pos, err)
+			}
+			changes = append(changes, ch)
+			pos = ch.Pos
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return changes, pos, nil
+}
+
+// ReplayJournal 读取 WithJournal 写出的日志, 并按顺序将操作重新应用到 fs 上
+func ReplayJournal(fs Fs, r io.Reader) error {
+	dec := json.NewDecoder(r)
+	for {
+		var rec JournalRecord
+		if err := dec.Decode(&rec); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if err := replayRecord(fs, rec); err != nil {
+			return fmt.Errorf("replay %s %s: %w", rec.Op, rec.Path, err)
+		}
+	}
+}
+
+func replayRecord(fs Fs, rec JournalRecord) error {
+	switch rec.Op {
+	case OpCreate:
+		f, err := fs.Create(rec.Path)
+		if err != nil {
+			return err
+		}
+		if err = f.Close(); err != nil || rec.Mode == 0 {
+			return err
+		}
+		return fs.Chmod(rec.Path, rec.Mode)
+	case OpMkdir:
+		return fs.Mkdir(rec.Path, rec.Mode)
+	case OpWrite:
+		// Open 打开的句柄在一般的 Fs 上是只读的
+		f, err := fs.OpenFile(rec.Path, os.O_WRONLY|os.O_CREATE, 0666)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = f.WriteAt(rec.Data, rec.Offset)
+		return err
+	case OpTruncate:
+		f, err := fs.OpenFile(rec.Path, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return f.Truncate(rec.Size)
+	case OpRemove:
+		return fs.Remove(rec.Path)
+	case OpRemoveAll:
+		return fs.RemoveAll(rec.Path)
+	case OpRename:
+		return fs.Rename(rec.Path, rec.NewPath)
+	case OpChmod:
+		return fs.Chmod(rec.Path, rec.Mode)
+	case OpChtimes:
+		mtime := time.Unix(0, rec.ModTime)
+		return fs.Chtimes(rec.Path, mtime, mtime)
+	case OpChown:
+		return fs.Chown(rec.Path, rec.Uid, rec.Gid)
+	case OpSymlink:
+		sl, ok := fs.(Symlinker)
+		if !ok {
+			return errors.ErrUnsupported
+		}
+		return sl.Symlink(rec.Target, rec.Path)
+	default:
+		return fmt.Errorf("unknown journal op %q", rec.Op)
+	}
+}
@@ -0,0 +1,199 @@
+package bboltfs
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestBBoltFs_Journal_Replay(t *testing.T) {
+	var journal bytes.Buffer
+	src := newTestFs(t, WithJournal(&journal))
+
+	_ = src.Mkdir("dir", 0755)
+	f, _ := src.Create("dir/a.txt")
+	f.WriteString("hello")
+	f.WriteString(", world")
+	f.Close()
+	f, _ = src.Create("b.txt")
+	f.WriteString("1234567890")
+	f.Truncate(4)
+	f.Close()
+	_ = src.Chmod("b.txt", 0600)
+	_ = src.Rename("b.txt", "dir/c.txt")
+	f, _ = src.Create("tmp.txt")
+	f.Close()
+	_ = src.Remove("tmp.txt")
+
+	dst := newTestFs(t)
+	if err := ReplayJournal(dst, &journal); err != nil {
+		t.Fatalf("ReplayJournal: %v", err)
+	}
+
+	for _, name := range []string{"dir/a.txt", "dir/c.txt"} {
+		if got, want := readAll(t, dst, name), readAll(t, src, name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+		si, _ := src.Stat(name)
+		di, err := dst.Stat(name)
+		if err != nil {
+			t.Fatalf("Stat %s: %v", name, err)
+		}
+		if si.Mode() != di.Mode() || si.Size() != di.Size() {
+			t.Errorf("%s: mode/size = %v/%d, want %v/%d", name, di.Mode(), di.Size(), si.Mode(), si.Size())
+		}
+	}
+	if info, err := dst.Stat("dir"); err != nil || !info.IsDir() {
+		t.Errorf("dir not replayed: %v", err)
+	}
+	for _, name := range []string{"b.txt", "tmp.txt"} {
+		if _, err := dst.Stat(name); err == nil {
+			t.Errorf("%s should not exist after replay", name)
+		}
+	}
+}
+
+func TestBBoltFs_ChangesSince(t *testing.T) {
+	fs := newTestFs(t, WithChangeLog())
+	if err := fs.Mkdir("d", 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.CreateWith("d/a", []byte("x"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	all, mid, err := fs.ChangesSince(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// mkdir, create, write
+	if len(all) != 3 || mid != all[2].Pos {
+		t.Fatalf("ChangesSince(0) = %+v, %d", all, mid)
+	}
+
+	if err := fs.Rename("d/a", "d/b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Remove("d/b"); err != nil {
+		t.Fatal(err)
+	}
+	later, pos, err := fs.ChangesSince(mid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(later) != 2 || later[0].Op != OpRename || later[0].NewPath != "d/b" || later[1].Op != OpRemove {
+		t.Fatalf("ChangesSince(mid) = %+v", later)
+	}
+	if later[0].Pos <= mid || pos != later[1].Pos {
+		t.Errorf("positions %d, %d after %d; new pos %d", later[0].Pos, later[1].Pos, mid, pos)
+	}
+
+	none, same, err := fs.ChangesSince(pos)
+	if err != nil || len(none) != 0 || same != pos {
+		t.Errorf("ChangesSince(latest) = %v, %d, %v", none, same, err)
+	}
+}
+
+func TestBBoltFs_ChangeLogSameTx(t *testing.T) {
+	fs := newTestFs(t, WithChangeLog())
+	var txs int
+	fs.updateHook = func() { txs++ }
+
+	// 每个修改与它的记录在同一个写事务中提交
+	steps := []struct {
+		name string
+		fn   func() error
+	}{
+		{"Mkdir", func() error { return fs.Mkdir("d", 0755) }},
+		{"WriteString", func() error { return fs.WriteString("d/a", "x", 0644) }},
+		{"Append", func() error { _, err := fs.Append("d/a", []byte("y")); return err }},
+		{"Truncate", func() error { return fs.Truncate("d/a", 1) }},
+		{"Chmod", func() error { return fs.Chmod("d/a", 0600) }},
+		{"Rename", func() error { return fs.Rename("d/a", "d/b") }},
+		{"Remove", func() error { return fs.Remove("d/b") }},
+	}
+	var pos JournalPos
+	for _, s := range steps {
+		txs = 0
+		if err := s.fn(); err != nil {
+			t.Fatalf("%s: %v", s.name, err)
+		}
+		changes, next, err := fs.ChangesSince(pos)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if txs != 1 || len(changes) == 0 {
+			t.Errorf("%s: %d write transactions, %d changes", s.name, txs, len(changes))
+		}
+		pos = next
+	}
+
+	// 失败回滚的修改不留下记录
+	if err := fs.Rename("missing", "x"); err == nil {
+		t.Fatal("Rename(missing) succeeded")
+	}
+	if changes, _, _ := fs.ChangesSince(pos); len(changes) != 0 {
+		t.Errorf("failed rename recorded %+v", changes)
+	}
+
+	// 缓冲写入在写入数据库时才记录
+	fs.updateHook = nil
+	f, err := fs.OpenBuffered("buf", 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, pos, _ = fs.ChangesSince(pos)
+	if _, err = f.Write([]byte("pending")); err != nil {
+		t.Fatal(err)
+	}
+	if changes, _, _ := fs.ChangesSince(pos); len(changes) != 0 {
+		t.Errorf("unflushed write recorded %+v", changes)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	changes, _, err := fs.ChangesSince(pos)
+	if err != nil || len(changes) != 1 || changes[0].Op != OpWrite || string(changes[0].Data) != "pending" {
+		t.Errorf("flushed write changes = %+v, %v", changes, err)
+	}
+}
+
+// writeOnlyOpenFs 的 Open 不能用于写入, 模拟 Open 返回只读句柄的一般 Fs
+type writeOnlyOpenFs struct {
+	*BBolt
+}
+
+func (w writeOnlyOpenFs) Open(name string) (File, error) {
+	return nil, errors.New("Open is read-only")
+}
+
+func TestBBoltFs_Journal_ReplayWithoutOpen(t *testing.T) {
+	var journal bytes.Buffer
+	src := newTestFs(t, WithJournal(&journal))
+	f, _ := src.Create("a.txt")
+	f.WriteString("hello, world")
+	f.Truncate(5)
+	f.Close()
+
+	dst := newTestFs(t)
+	if err := ReplayJournal(writeOnlyOpenFs{dst}, &journal); err != nil {
+		t.Fatalf("ReplayJournal: %v", err)
+	}
+	if got := readAll(t, dst, "a.txt"); got != "hello" {
+		t.Errorf("a.txt = %q, want %q", got, "hello")
+	}
+}
+
+func TestBBoltFs_Journal_RemoveMissing(t *testing.T) {
+	var journal bytes.Buffer
+	fs := newTestFs(t, WithJournal(&journal), WithChangeLog())
+	_ = fs.Remove("missing")
+	if journal.Len() != 0 {
+		t.Errorf("journal = %q, want empty", journal.String())
+	}
+	if recs, _, err := fs.ChangesSince(0); err != nil || len(recs) != 0 {
+		t.Errorf("ChangesSince = %v, %v", recs, err)
+	}
+}
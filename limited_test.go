@@ -0,0 +1,57 @@
+package bboltfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestBBoltFs_OpenLimited(t *testing.T) {
+	fs := newTestFs(t, WithInlineThreshold(8))
+	fs.chunkSize = 4
+	f, err := fs.CreateWith("big.txt", []byte("0123456789abcdef"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	lf, err := fs.OpenLimited("big.txt", 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Close()
+	buf := make([]byte, 10)
+	n, err := io.ReadFull(lf, buf)
+	if n != 6 || !errors.Is(err, io.ErrUnexpectedEOF) || string(buf[:n]) != "012345" {
+		t.Errorf("ReadFull = %d, %q, %v; want 6 bytes", n, buf[:n], err)
+	}
+	if n, err := lf.Read(buf); n != 0 || err != io.EOF {
+		t.Errorf("Read at cap = %d, %v; want 0, EOF", n, err)
+	}
+	if n, err := lf.ReadAt(buf[:4], 4); n != 2 || err != io.EOF {
+		t.Errorf("ReadAt across cap = %d, %v; want 2, EOF", n, err)
+	}
+	if _, err := lf.Write([]byte("x")); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("Write: err = %v, want ErrPermission", err)
+	}
+	if err := lf.Truncate(0); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("Truncate: err = %v, want ErrPermission", err)
+	}
+	if fi, _ := lf.Stat(); fi.Size() != 16 {
+		t.Errorf("Stat size = %d, want 16", fi.Size())
+	}
+
+	// limit 大于文件时读到完整内容
+	lf2, err := fs.OpenLimited("big.txt", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lf2.Close()
+	if data, err := io.ReadAll(lf2); err != nil || string(data) != "0123456789abcdef" {
+		t.Errorf("ReadAll = %q, %v", data, err)
+	}
+	if _, err := fs.OpenLimited("missing", 1); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("OpenLimited(missing): err = %v", err)
+	}
+}
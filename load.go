@@ -0,0 +1,121 @@
+package bboltfs
+
+import (
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// LoadFromFS 将 src (如 embed.FS 或 os.DirFS) 中的所有文件和目录写入文件系统的根目录, 保留权限和修改时间.
+// 所有内容在一个写事务中写入, 中途出错时不会留下部分内容. 已存在的文件被覆盖, 已存在的目录保持不变
+func (fs *BBolt) LoadFromFS(src iofs.FS) error {
+	return fs.update(func(tx *bbolt.Tx) error {
+		var records []JournalRecord
+		if err := fs.loadTx(tx, src, "", &records); err != nil {
+			return err
+		}
+		return fs.recordTx(tx, records...)
+	})
+}
+
+// loadTx 在事务 tx 中将 src 的内容写入目录 root 之下 (root 为 "" 时写入根目录), 并将对应的日志记录追加到 records
+func (fs *BBolt) loadTx(tx *bbolt.Tx, src iofs.FS, root string, records *[]JournalRecord) error {
+	return iofs.WalkDir(src, ".", func(p string, d iofs.DirEntry, err error) error {
+		if err != nil || p == "." {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		raw := p
+		if root != "" {
+			raw = root + "/" + p
+		}
+		name := fs.normalize(raw)
+		mtime := info.ModTime()
+		if mtime.IsZero() {
+			mtime = time.Now()
+		}
+		perm := info.Mode().Perm()
+		if d.IsDir() {
+			if fs.flat || tx.Bucket([]byte(bucketDirs)).Get([]byte(name)) != nil {
+				return nil
+			}
+			meta := fileMeta{Mode: perm | os.ModeDir, ModTime: mtime.UnixNano(), IsDir: true}
+			if err = fs.saveDirTx(tx, name, meta); err != nil {
+				return err
+			}
+			*records = append(*records, JournalRecord{Op: OpMkdir, Path: name, Mode: perm})
+			return fs.setDisplayName(tx, name, raw)
+		}
+		if !info.Mode().IsRegular() {
+			return nil // 跳过符号链接等特殊文件
+		}
+		data, err := iofs.ReadFile(src, p)
+		if err != nil {
+			return err
+		}
+		meta := fileMeta{Mode: perm, Size: int64(len(data)), ModTime: mtime.UnixNano()}
+		if err = fs.putFileTx(tx, name, data, meta, true); err != nil {
+			return err
+		}
+		*records = append(*records,
+			JournalRecord{Op: OpCreate, Path: name, Mode: perm},
+			JournalRecord{Op: OpWrite, Path: name, Data: data, Size: meta.Size},
+			JournalRecord{Op: OpChtimes, Path: name, ModTime: meta.ModTime},
+		)
+		return fs.setDisplayName(tx, name, raw)
+	})
+}
+
+// ReplaceTree 用 src 的内容整体替换目录 dest. 新内容先写入 dest 旁的临时目录, 然后在一个事务中
+// 删除旧的子树并将临时目录重命名为 dest, 读取方只会看到完整的旧树或完整的新树. dest 不存在时直接创建
+func (fs *BBolt) ReplaceTree(dest string, src iofs.FS) error {
+	dest = fs.normalize(dest)
+	if dest == "" {
+		return fmt.Errorf("%w: cannot replace the root directory", os.ErrInvalid)
+	}
+	perm := os.FileMode(0755)
+	if info, err := iofs.Stat(src, "."); err == nil {
+		perm = info.Mode().Perm()
+	}
+	tmp := path.Join(path.Dir(dest), fmt.Sprintf(".%s.replace-%d", path.Base(dest), time.Now().UnixNano()))
+	err := fs.update(func(tx *bbolt.Tx) error {
+		meta := fileMeta{Mode: perm | os.ModeDir, ModTime: time.Now().UnixNano(), IsDir: true}
+		if err := fs.saveDirTx(tx, tmp, meta); err != nil {
+			return err
+		}
+		records := []JournalRecord{{Op: OpMkdir, Path: tmp, Mode: perm}}
+		if err := fs.loadTx(tx, src, tmp, &records); err != nil {
+			return err
+		}
+		return fs.recordTx(tx, records...)
+	})
+	if err != nil {
+		return err
+	}
+	err = fs.update(func(tx *bbolt.Tx) error {
+		if tx.Bucket([]byte(bucketFiles)).Get([]byte(dest)) != nil {
+			return ErrNotDirectory
+		}
+		if err := fs.removeAllTx(tx, dest); err != nil {
+			return err
+		}
+		if err := fs.rename(tx, tmp, dest); err != nil {
+			return err
+		}
+		return fs.recordTx(tx,
+			JournalRecord{Op: OpRemoveAll, Path: dest},
+			JournalRecord{Op: OpRename, Path: tmp, NewPath: dest},
+		)
+	})
+	if err != nil {
+		_ = fs.RemoveAll(tmp)
+	}
+	return err
+}
@@ -0,0 +1,162 @@
+package bboltfs
+
+import (
+	"errors"
+	"io/fs"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestBBoltFs_LoadFromFS(t *testing.T) {
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	src := fstest.MapFS{
+		"index.html":          {Data: []byte("<html>"), Mode: 0644, ModTime: mtime},
+		"static":              {Mode: fs.ModeDir | 0750, ModTime: mtime},
+		"static/app.js":       {Data: []byte("console.log(1)"), Mode: 0600},
+		"static/img/logo.png": {Data: []byte{0x89, 'P', 'N', 'G'}, Mode: 0644},
+	}
+	b := newTestFs(t)
+	if err := b.LoadFromFS(src); err != nil {
+		t.Fatalf("LoadFromFS: %v", err)
+	}
+
+	for name, f := range src {
+		fi, err := b.Stat(name)
+		if err != nil {
+			t.Errorf("Stat %s: %v", name, err)
+			continue
+		}
+		if fi.IsDir() != f.Mode.IsDir() {
+			t.Errorf("%s: IsDir = %v", name, fi.IsDir())
+			continue
+		}
+		if f.Mode.IsDir() {
+			if fi.Mode().Perm() != f.Mode.Perm() {
+				t.Errorf("%s: mode = %v, want %v", name, fi.Mode(), f.Mode)
+			}
+			continue
+		}
+		if fi.Mode() != f.Mode {
+			t.Errorf("%s: mode = %v, want %v", name, fi.Mode(), f.Mode)
+		}
+		if got := readAll(t, b, name); got != string(f.Data) {
+			t.Errorf("%s: content = %q, want %q", name, got, f.Data)
+		}
+	}
+	// MapFS 会为没有列出的父目录生成目录项
+	if fi, err := b.Stat("static/img"); err != nil || !fi.IsDir() {
+		t.Errorf("static/img = %v, %v", fi, err)
+	}
+	if fi, _ := b.Stat("index.html"); !fi.ModTime().Equal(mtime) {
+		t.Errorf("index.html mtime = %v, want %v", fi.ModTime(), mtime)
+	}
+	if names := readDirNames(t, b, "static"); !reflect.DeepEqual(names, []string{"app.js", "img"}) {
+		t.Errorf("ReadDir(static) = %v", names)
+	}
+}
+
+func TestBBoltFs_LoadFromFS_Atomic(t *testing.T) {
+	b := newTestFs(t)
+	f, err := b.CreateWith("conflict", []byte("file"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	// "conflict" 已经是文件, 无法作为目录写入, 整个导入应当回滚
+	src := fstest.MapFS{
+		"a.txt":          {Data: []byte("a")},
+		"conflict/b.txt": {Data: []byte("b")},
+	}
+	if err := b.LoadFromFS(src); !errors.Is(err, ErrFileExists) {
+		t.Fatalf("LoadFromFS: err = %v, want ErrFileExists", err)
+	}
+	if _, err := b.Stat("a.txt"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("a.txt should not exist after failed load: %v", err)
+	}
+}
+
+func TestBBoltFs_ReplaceTree(t *testing.T) {
+	b := newTestFs(t)
+	bundle := func(v string, names ...string) fstest.MapFS {
+		m := fstest.MapFS{}
+		for _, name := range names {
+			m[name] = &fstest.MapFile{Data: []byte(v), Mode: 0644}
+		}
+		return m
+	}
+	oldTree := bundle("v1", "a.txt", "sub/b.txt", "old.txt")
+	newTree := bundle("v2", "a.txt", "sub/b.txt", "new.txt")
+	if err := b.ReplaceTree("site", oldTree); err != nil {
+		t.Fatalf("ReplaceTree(create): %v", err)
+	}
+
+	tree := func() string {
+		entries, err := b.Manifest()
+		if err != nil {
+			t.Error(err)
+			return ""
+		}
+		var s string
+		for _, e := range entries {
+			if name, ok := strings.CutPrefix(e.Path, "site/"); ok {
+				s += name + "=" + readAll(t, b, e.Path) + ";"
+			}
+		}
+		return s
+	}
+	// 读取方在一个读事务中取得 site 下的清单, 只能是完整的旧树或完整的新树
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			entries, err := b.Manifest()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			var names []string
+			for _, e := range entries {
+				if name, ok := strings.CutPrefix(e.Path, "site/"); ok {
+					names = append(names, name)
+				}
+			}
+			if got := strings.Join(names, ","); got != "a.txt,old.txt,sub/b.txt" && got != "a.txt,new.txt,sub/b.txt" {
+				t.Errorf("reader saw %q", got)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		tree := oldTree
+		if i%2 == 0 {
+			tree = newTree
+		}
+		if err := b.ReplaceTree("site", tree); err != nil {
+			t.Fatalf("ReplaceTree: %v", err)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	if got := tree(); got != "a.txt=v1;old.txt=v1;sub/b.txt=v1;" {
+		t.Errorf("final tree = %q", got)
+	}
+	if names := readDirNames(t, b, ""); !reflect.DeepEqual(names, []string{"site"}) {
+		t.Errorf("root = %v, temporary directory left behind", names)
+	}
+	_ = b.WriteString("file", "x", 0644)
+	if err := b.ReplaceTree("file", newTree); !errors.Is(err, ErrNotDirectory) {
+		t.Errorf("ReplaceTree(file) = %v, want ErrNotDirectory", err)
+	}
+}
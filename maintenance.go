@@ -0,0 +1,232 @@
+package bboltfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// xattrExpires 保存 SetExpiry 设置的过期时间 (8 字节大端序的 UnixNano), 随文件一起重命名和删除
+const xattrExpires = "bboltfs.expires"
+
+// SetExpiry 设置文件 name 的过期时间, 过期后由 ExpireFiles 或 WithMaintenance 的后台任务删除.
+// at 为零值时取消过期时间
+func (fs *BBolt) SetExpiry(name string, at time.Time) error {
+	if at.IsZero() {
+		err := fs.RemoveXattr(name, xattrExpires)
+		if errors.Is(err, ErrNoXattr) {
+			return nil
+		}
+		return err
+	}
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, uint64(at.UnixNano()))
+	return fs.SetXattr(name, xattrExpires, v)
+}
+
+// ExpireFiles 删除所有已过期的文件和空目录, 返回删除的数量
+func (fs *BBolt) ExpireFiles() (int, error) {
+	now := time.Now().UnixNano()
+	var expired []string
+	err := fs.update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucketXattrs))
+		if b == nil {
+			return nil
+		}
+		suffix := "\x00" + xattrExpires
+		// ForEach 期间不能修改 bucket, 先收集过期的文件
+		err := b.ForEach(func(k, v []byte) error {
+			if name, ok := strings.CutSuffix(string(k), suffix); ok && len(v) == 8 && int64(binary.BigEndian.Uint64(v)) <= now {
+				expired = append(expired, name)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		n := 0
+		for _, name := range expired {
+			_, err := fs.removeTx(tx, name)
+			if errors.Is(err, ErrDirNotEmpty) {
+				continue // 过期的目录等到清空后再删除
+			}
+			if err != nil {
+				return err
+			}
+			if err = fs.recordTx(tx, JournalRecord{Op: OpRemove, Path: name}); err != nil {
+				return err
+			}
+			expired[n] = name
+			n++
+		}
+		expired = expired[:n]
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(expired), nil
+}
+
+// PruneEmptyDirs 删除所有空目录, 删除子目录后变空的父目录也一并删除, 返回删除的数量
+func (fs *BBolt) PruneEmptyDirs() (int, error) {
+	var pruned []string
+	err := fs.update(func(tx *bbolt.Tx) error {
+		var dirs []string
+		err := tx.Bucket([]byte(bucketDirs)).ForEach(func(k, _ []byte) error {
+			dirs = append(dirs, string(k))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// 子目录的 key 总是排在父目录之后, 倒序遍历即可先删除子目录
+		for i := len(dirs) - 1; i >= 0; i-- {
+			name := dirs[i]
+			if name == "" || name == "/" {
+				continue
+			}
+			_, err := fs.removeTx(tx, name)
+			if errors.Is(err, ErrDirNotEmpty) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err = fs.recordTx(tx, JournalRecord{Op: OpRemove, Path: name}); err != nil {
+				return err
+			}
+			pruned = append(pruned, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(pruned), nil
+}
+
+// Compact 将数据库压缩到临时文件后替换原文件, 回收空闲页占用的磁盘空间.
+// 压缩期间其他操作会等待, 已打开的句柄在压缩后继续可用
+func (fs *BBolt) Compact() error {
+	if fs.readOnly {
+		return ErrReadOnly
+	}
+	tmp := fs.name + ".compact"
+	dst, err := bbolt.Open(tmp, 0600, nil)
+	if err != nil {
+		return err
+	}
+	fs.dbMu.Lock()
+	defer fs.dbMu.Unlock()
+	if fs.dbErr != nil {
+		_ = dst.Close()
+		_ = os.Remove(tmp)
+		return fs.dbErr
+	}
+	err = bbolt.Compact(dst, fs.db, 0)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return translateErr(err)
+	}
+	if fs.txPool != nil {
+		fs.txPool.close()
+	}
+	if err = fs.db.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	// 替换失败时仍然重新打开原文件, 保证文件系统依然可用
+	renameErr := os.Rename(tmp, fs.name)
+	db, err := fs.openDB(fs.name)
+	if err != nil {
+		return fs.lostDB(err)
+	}
+	fs.setDB(db)
+	fs.statCache.clear()
+	return renameErr
+}
+
+// MaintenanceConfig 配置 WithMaintenance 的后台任务, 间隔 <=0 的任务不执行
+type MaintenanceConfig struct {
+	ExpireInterval  time.Duration // 删除过期文件的间隔
+	PruneInterval   time.Duration // 删除空目录的间隔
+	CompactInterval time.Duration // 检查碎片率的间隔
+	CompactRatio    float64       // 碎片率达到该值时压缩, <=0 时使用 FragmentationReport 的建议
+
+	OnError func(error) // 后台任务出错时调用, 为 nil 时忽略错误
+}
+
+// maintainer 运行 WithMaintenance 的后台任务
+type maintainer struct {
+	stop chan struct{}
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+func (fs *BBolt) startMaintenance(cfg MaintenanceConfig) *maintainer {
+	m := &maintainer{stop: make(chan struct{})}
+	// 未启用的任务使用 nil channel, select 永远不会选中
+	tick := func(d time.Duration) (<-chan time.Time, func()) {
+		if d <= 0 {
+			return nil, func() {}
+		}
+		t := time.NewTicker(d)
+		return t.C, t.Stop
+	}
+	expire, stopExpire := tick(cfg.ExpireInterval)
+	prune, stopPrune := tick(cfg.PruneInterval)
+	compact, stopCompact := tick(cfg.CompactInterval)
+	report := func(err error) {
+		if err != nil && cfg.OnError != nil {
+			cfg.OnError(err)
+		}
+	}
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer stopExpire()
+		defer stopPrune()
+		defer stopCompact()
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-expire:
+				_, err := fs.ExpireFiles()
+				report(err)
+			case <-prune:
+				_, err := fs.PruneEmptyDirs()
+				report(err)
+			case <-compact:
+				report(fs.compactIfFragmented(cfg.CompactRatio))
+			}
+		}
+	}()
+	return m
+}
+
+// close 停止后台任务并等待正在执行的任务结束, 可重复调用
+func (m *maintainer) close() {
+	m.once.Do(func() { close(m.stop) })
+	m.wg.Wait()
+}
+
+func (fs *BBolt) compactIfFragmented(ratio float64) error {
+	r, err := fs.FragmentationReport()
+	if err != nil {
+		return err
+	}
+	if ratio > 0 && r.Ratio < ratio || ratio <= 0 && !r.ShouldCompact {
+		return nil
+	}
+	return fs.Compact()
+}
@@ -0,0 +1,232 @@
+package bboltfs
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBBoltFs_ExpireFiles(t *testing.T) {
+	fs := newTestFs(t)
+	for _, name := range []string{"old.txt", "new.txt", "keep.txt"} {
+		f, err := fs.CreateWith(name, []byte(name), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+	if err := fs.SetExpiry("old.txt", time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.SetExpiry("new.txt", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	n, err := fs.ExpireFiles()
+	if err != nil || n != 1 {
+		t.Fatalf("ExpireFiles = %d, %v; want 1", n, err)
+	}
+	if _, err := fs.Stat("old.txt"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("old.txt: err = %v, want ErrFileNotFound", err)
+	}
+	for _, name := range []string{"new.txt", "keep.txt"} {
+		if _, err := fs.Stat(name); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	// 取消过期时间
+	if err := fs.SetExpiry("new.txt", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.GetXattr("new.txt", xattrExpires); !errors.Is(err, ErrNoXattr) {
+		t.Errorf("expiry not cleared: %v", err)
+	}
+}
+
+func TestBBoltFs_PruneEmptyDirs(t *testing.T) {
+	fs := newTestFs(t)
+	for _, dir := range []string{"a", "a/b", "a/b/c", "d"} {
+		if err := fs.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := fs.CreateWith("d/file", []byte("x"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	n, err := fs.PruneEmptyDirs()
+	if err != nil || n != 3 {
+		t.Fatalf("PruneEmptyDirs = %d, %v; want 3", n, err)
+	}
+	if _, err := fs.Stat("a"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("a: err = %v, want ErrFileNotFound", err)
+	}
+	if _, err := fs.Stat("d"); err != nil {
+		t.Errorf("d: %v", err)
+	}
+}
+
+func TestBBoltFs_Compact(t *testing.T) {
+	fs := newTestFs(t)
+	big := make([]byte, 1<<20)
+	for i := 0; i < 8; i++ {
+		f, err := fs.CreateWith(string(rune('a'+i)), big, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+	f, err := fs.CreateWith("keep", []byte("kept"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 8; i++ {
+		if err := fs.Remove(string(rune('a' + i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before, _ := fs.FragmentationReport()
+	if err := fs.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	after, err := fs.FragmentationReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.TotalPages >= before.TotalPages {
+		t.Errorf("TotalPages = %d, want < %d", after.TotalPages, before.TotalPages)
+	}
+	if got := readAll(t, fs, "keep"); got != "kept" {
+		t.Errorf("keep = %q", got)
+	}
+	// 压缩前打开的句柄继续可用
+	if _, err := f.WriteString("!"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, fs, "keep"); got != "kept!" {
+		t.Errorf("keep after write = %q", got)
+	}
+}
+
+func TestBBoltFs_WithMaintenance(t *testing.T) {
+	errs := make(chan error, 10)
+	fs := newTestFs(t, WithMaintenance(MaintenanceConfig{
+		ExpireInterval: 10 * time.Millisecond,
+		OnError:        func(err error) { errs <- err },
+	}))
+	f, err := fs.CreateWith("tmp.txt", []byte("temp"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	if err := fs.SetExpiry("tmp.txt", time.Now().Add(20*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := fs.Stat("tmp.txt"); errors.Is(err, ErrFileNotFound) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expired file was not reclaimed by the background task")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	select {
+	case err := <-errs:
+		t.Errorf("background error: %v", err)
+	default:
+	}
+	// Close 停止后台任务, 之后不再访问已关闭的数据库
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	select {
+	case err := <-errs:
+		t.Errorf("background task still running after Close: %v", err)
+	default:
+	}
+}
+
+// 用 go test -race 运行时检查 Compact 替换 db 和事务池与并发读写之间没有数据竞争
+func TestBBoltFs_CompactConcurrentWrites(t *testing.T) {
+	fs := newTestFs(t, WithTxPool(2))
+	var started sync.WaitGroup
+	started.Add(4)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("w%d", i)
+			for j := 0; ; j++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if err := fs.WriteString(name, fmt.Sprint(j), 0644); err != nil {
+					t.Error(err)
+					return
+				}
+				if j == 0 {
+					started.Done()
+				}
+				if _, err := fs.Stat(name); err != nil {
+					t.Error(err)
+					return
+				}
+				fs.InvalidateAll()
+			}
+		}(i)
+	}
+	started.Wait()
+	for i := 0; i < 5; i++ {
+		if err := fs.Compact(); err != nil {
+			t.Error(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+	for i := 0; i < 4; i++ {
+		if _, err := fs.ReadString(fmt.Sprintf("w%d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestBBoltFs_LostDB(t *testing.T) {
+	fs := newTestFs(t, WithTxPool(2))
+	_ = fs.WriteString("a", "x", 0644)
+	// 模拟 Compact 关闭数据库后重新打开失败
+	fs.dbMu.Lock()
+	fs.txPool.close()
+	_ = fs.db.Close()
+	err := fs.lostDB(errors.New("disk gone"))
+	fs.dbMu.Unlock()
+	if !errors.Is(err, ErrDatabaseLost) {
+		t.Fatalf("lostDB = %v", err)
+	}
+	if _, err = fs.Stat("a"); !errors.Is(err, ErrDatabaseLost) {
+		t.Errorf("Stat = %v, want ErrDatabaseLost", err)
+	}
+	if err = fs.WriteString("b", "y", 0644); !errors.Is(err, ErrDatabaseLost) {
+		t.Errorf("WriteString = %v, want ErrDatabaseLost", err)
+	}
+	if err = fs.Compact(); !errors.Is(err, ErrDatabaseLost) {
+		t.Errorf("Compact = %v, want ErrDatabaseLost", err)
+	}
+	if _, _, err = fs.Map("a"); !errors.Is(err, ErrDatabaseLost) {
+		t.Errorf("Map = %v, want ErrDatabaseLost", err)
+	}
+	if err = fs.Close(); err != nil {
+		t.Errorf("Close = %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package bboltfs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+
+	"go.etcd.io/bbolt"
+)
+
+// ManifestEntry 是 Manifest 中的一个文件
+type ManifestEntry struct {
+	Path string
+	Size int64
+	Mode os.FileMode
+	Hash string // 内容的 SHA-256, 十六进制小写
+}
+
+// Manifest 在一个读事务中扫描所有文件, 返回按路径字节序排列的清单, 可用于签名和校验.
+// 目录和符号链接没有内容, 不包含在清单中; 修改时间也不参与, 内容相同的树总是得到相同的清单
+func (fs *BBolt) Manifest() ([]ManifestEntry, error) {
+	var entries []ManifestEntry
+	err := fs.view(func(tx *bbolt.Tx) error {
+		// bbolt 的 key 本身按字节序排列, 无需额外排序
+		return tx.Bucket([]byte(bucketFiles)).ForEach(func(k, v []byte) error {
+			meta, inline := fs.splitMeta(v)
+			if meta.Mode&os.ModeSymlink != 0 {
+				return nil
+			}
+			h := sha256.New()
+			// 分块存储的文件逐块读取, 不必一次载入整个文件
+			if _, err := io.Copy(h, &contentReader{fs: fs, tx: tx, meta: meta, inline: inline}); err != nil {
+				return err
+			}
+			entries = append(entries, ManifestEntry{
+				Path: string(k),
+				Size: meta.Size,
+				Mode: meta.Mode,
+				Hash: hex.EncodeToString(h.Sum(nil)),
+			})
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,47 @@
+package bboltfs
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBBoltFs_Manifest(t *testing.T) {
+	fs := newTestFs(t, WithInlineThreshold(8))
+	fs.chunkSize = 4
+	if err := fs.Mkdir("dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"b.txt": "hello", "a.txt": "", "dir/big": "0123456789abcdef"} {
+		f, err := fs.CreateWith(name, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+
+	m1, err := fs.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ManifestEntry{
+		{"a.txt", 0, 0644, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{"b.txt", 5, 0644, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{"dir/big", 16, 0644, "9f9f5111f7b27a781f1f1ddde5ebc2dd2b796bfc7365c9c28b548e564176929f"},
+	}
+	if !reflect.DeepEqual(m1, want) {
+		t.Errorf("Manifest = %v\nwant %v", m1, want)
+	}
+
+	// 修改时间变化不影响清单
+	if err := fs.Chtimes("b.txt", time.Unix(1, 0), time.Unix(1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	m2, err := fs.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m1, m2) {
+		t.Errorf("Manifest is not deterministic:\n%v\n%v", m1, m2)
+	}
+}
@@ -0,0 +1,62 @@
+package bboltfs
+
+import (
+	"sync"
+
+	"go.etcd.io/bbolt"
+)
+
+// Map 返回文件 name 内容的只读视图和释放函数, 视图在调用释放函数前有效. 内联存储以及只有一个完整分块的文件
+// 直接返回 bbolt 的 value, 不复制数据; 其余分块存储的文件 (包括带空洞的文件) 需要复制一次内容.
+//
+// 视图由一个只读事务支撑, 之后的写入不会反映到视图中, 调用方也不能修改返回的切片, 否则会破坏数据库.
+// 释放前该事务会阻止旧页面被回收, 写入需要扩容数据库时以及 Compact 都会等待释放, 因此应尽快调用释放函数.
+// 释放函数可以重复调用
+func (fs *BBolt) Map(name string) ([]byte, func(), error) {
+	name = fs.normalize(name)
+	fs.dbMu.RLock()
+	tx, err := fs.db.Begin(false)
+	if fs.dbErr != nil {
+		err = fs.dbErr
+	}
+	fs.dbMu.RUnlock()
+	if err != nil {
+		return nil, nil, translateErr(err)
+	}
+	var once sync.Once
+	release := func() { once.Do(func() { _ = tx.Rollback() }) }
+	data, err := fs.mapTx(tx, name)
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	fs.ioStats.add(name, len(data), 0)
+	return data, release, nil
+}
+
+func (fs *BBolt) mapTx(tx *bbolt.Tx, name string) ([]byte, error) {
+	name, err := fs.resolveTx(tx, name, true)
+	if err != nil {
+		return nil, err
+	}
+	val := tx.Bucket([]byte(bucketFiles)).Get([]byte(name))
+	if val == nil {
+		if tx.Bucket([]byte(bucketDirs)).Get([]byte(name)) != nil {
+			return nil, ErrIsDirectory
+		}
+		return nil, ErrFileNotFound
+	}
+	meta, inline := fs.splitMeta(val)
+	if meta.Storage != storageChunked {
+		if int64(len(inline)) >= meta.Size {
+			return inline[:meta.Size:meta.Size], nil
+		}
+	} else if meta.Size <= int64(meta.ChunkSize) {
+		if chunk := tx.Bucket([]byte(bucketChunks)).Get(chunkKey(meta.Ino, 0)); int64(len(chunk)) == meta.Size {
+			return chunk[:meta.Size:meta.Size], nil
+		}
+	}
+	data := make([]byte, meta.Size)
+	fs.readAt(tx, meta, inline, data, 0)
+	return data, nil
+}
@@ -0,0 +1,61 @@
+package bboltfs
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestBBoltFs_Map(t *testing.T) {
+	fs := newTestFs(t, WithInlineThreshold(16))
+	fs.chunkSize = 16
+	for name, content := range map[string]string{
+		"inline":  "hello",
+		"single":  "0123456789abcdef",
+		"chunked": "0123456789abcdefXYZ",
+	} {
+		f, err := fs.CreateWith(name, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+
+		data, release, err := fs.Map(name)
+		if err != nil {
+			t.Fatalf("Map(%s): %v", name, err)
+		}
+		if string(data) != content {
+			t.Errorf("Map(%s) = %q, want %q", name, data, content)
+		}
+		if cap(data) != len(data) {
+			t.Errorf("Map(%s) cap = %d, want %d", name, cap(data), len(data))
+		}
+		release()
+		release()
+		// 释放后写入不再等待视图
+		if _, err = fs.Append(name, []byte("!")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 空洞读作 0
+	if err := fs.Truncate("inline", 40); err != nil {
+		t.Fatal(err)
+	}
+	data, release, err := fs.Map("inline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := append([]byte("hello!"), make([]byte, 34)...); !bytes.Equal(data, want) {
+		t.Errorf("Map(sparse) = %q", data)
+	}
+	release()
+
+	_ = fs.Mkdir("dir", 0755)
+	if _, _, err := fs.Map("dir"); !errors.Is(err, ErrIsDirectory) {
+		t.Errorf("Map(dir) = %v, want ErrIsDirectory", err)
+	}
+	if _, _, err := fs.Map("missing"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Map(missing) = %v, want ErrFileNotFound", err)
+	}
+}
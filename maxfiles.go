@@ -0,0 +1,58 @@
+package bboltfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+// keyFileCount 是 meta bucket 中保存文件数量的 key, 只在设置了 WithMaxFiles 时维护
+const keyFileCount = "file_count"
+
+var ErrTooManyFiles = errors.New("bboltfs: too many files")
+
+// countFiles 重新统计 files bucket 中的文件数量并写入 meta bucket.
+// 未设置 WithMaxFiles 时打开的数据库不会维护计数, 因此每次打开都重新统计
+func countFiles(tx *bbolt.Tx) error {
+	n := tx.Bucket([]byte(bucketFiles)).Stats().KeyN
+	return tx.Bucket([]byte(bucketMeta)).Put([]byte(keyFileCount), binary.BigEndian.AppendUint64(nil, uint64(n)))
+}
+
+// addFiles 在事务 tx 中将文件计数加上 delta, 新增文件超过 WithMaxFiles 的限制时返回 ErrTooManyFiles.
+// 计数与文件在同一个事务中修改, 事务回滚时一起恢复
+func (fs *BBolt) addFiles(tx *bbolt.Tx, delta int64) error {
+	if fs.maxFiles <= 0 {
+		return nil
+	}
+	b := tx.Bucket([]byte(bucketMeta))
+	var n int64
+	if v := b.Get([]byte(keyFileCount)); len(v) == 8 {
+		n = int64(binary.BigEndian.Uint64(v))
+	}
+	n += delta
+	if delta > 0 && n > int64(fs.maxFiles) {
+		return fmt.Errorf("%w: limit %d", ErrTooManyFiles, fs.maxFiles)
+	}
+	if n < 0 {
+		n = 0
+	}
+	return b.Put([]byte(keyFileCount), binary.BigEndian.AppendUint64(nil, uint64(n)))
+}
+
+// FileCount 返回文件数量 (不含目录). 设置了 WithMaxFiles 时读取维护的计数, 否则扫描 files bucket
+func (fs *BBolt) FileCount() (int, error) {
+	var n int
+	err := fs.view(func(tx *bbolt.Tx) error {
+		if fs.maxFiles > 0 {
+			if v := tx.Bucket([]byte(bucketMeta)).Get([]byte(keyFileCount)); len(v) == 8 {
+				n = int(binary.BigEndian.Uint64(v))
+				return nil
+			}
+		}
+		n = tx.Bucket([]byte(bucketFiles)).Stats().KeyN
+		return nil
+	})
+	return n, err
+}
@@ -0,0 +1,74 @@
+package bboltfs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestBBoltFs_MaxFiles(t *testing.T) {
+	dbfile := mustTmpFile(t)
+	fs, err := New(dbfile, WithMaxFiles(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = fs.Mkdir("dir", 0755) // 目录不计入
+	for i := 0; i < 3; i++ {
+		f, err := fs.Create(fmt.Sprintf("dir/f%d", i))
+		if err != nil {
+			t.Fatalf("Create f%d: %v", i, err)
+		}
+		_ = f.Close()
+	}
+	if _, err := fs.Create("dir/f3"); !errors.Is(err, ErrTooManyFiles) {
+		t.Fatalf("Create beyond limit = %v, want ErrTooManyFiles", err)
+	}
+	// 覆盖已有文件不占用新的名额
+	f, err := fs.(*BBolt).CreateWith("dir/f0", []byte("again"), 0644)
+	if err != nil {
+		t.Fatalf("overwrite: %v", err)
+	}
+	_ = f.Close()
+	if n, _ := fs.(*BBolt).FileCount(); n != 3 {
+		t.Errorf("FileCount = %d, want 3", n)
+	}
+
+	if err := fs.Remove("dir/f1"); err != nil {
+		t.Fatal(err)
+	}
+	if f, err = fs.Create("dir/f3"); err != nil {
+		t.Fatalf("Create after Remove: %v", err)
+	}
+	_ = f.Close()
+	if err := fs.RemoveAll("dir"); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := fs.(*BBolt).FileCount(); n != 0 {
+		t.Errorf("FileCount after RemoveAll = %d, want 0", n)
+	}
+	_ = fs.Close()
+
+	// 不带限制时写入的文件在下次打开时重新统计
+	fs, err = New(dbfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b"} {
+		f, _ := fs.Create(name)
+		_ = f.Close()
+	}
+	_ = fs.Close()
+	fs, err = New(dbfile, WithMaxFiles(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+	if n, _ := fs.(*BBolt).FileCount(); n != 2 {
+		t.Errorf("FileCount after reopen = %d, want 2", n)
+	}
+	f, _ = fs.Create("c")
+	_ = f.Close()
+	if _, err := fs.Create("d"); !errors.Is(err, ErrTooManyFiles) {
+		t.Errorf("Create after reopen = %v, want ErrTooManyFiles", err)
+	}
+}
@@ -0,0 +1,211 @@
+package bboltfs
+
+import (
+	"io"
+	"time"
+)
+
+// Option 用于在 New 时配置文件系统
+type Option func(fs *BBolt)
+
+// WithJournal 在每次修改成功后向 w 追加一条 JSON 行格式的日志记录,
+// 配合 ReplayJournal 可以将修改重放到另一个文件系统上
+func WithJournal(w io.Writer) Option {
+	return func(fs *BBolt) {
+		fs.journal = w
+	}
+}
+
+// WithChangeLog 将每次修改以递增的序列号记录到数据库中, 配合 ChangesSince 供副本增量拉取.
+// 记录与修改在同一个写事务中提交, 不会多出写事务, 也不会出现有修改而没有记录的情况
+func WithChangeLog() Option {
+	return func(fs *BBolt) {
+		fs.changeLog = true
+	}
+}
+
+// WithMaintenance 启动一个后台 goroutine 按 cfg 定期删除过期文件、清理空目录和压缩数据库, Close 时停止.
+// 只读模式下不启动
+func WithMaintenance(cfg MaintenanceConfig) Option {
+	return func(fs *BBolt) {
+		fs.maintenance = &cfg
+	}
+}
+
+// WithLockTimeout 设置打开数据库时等待文件锁的时间, 超时后 New 返回 ErrLocked. 默认一直等待
+func WithLockTimeout(d time.Duration) Option {
+	return func(fs *BBolt) {
+		fs.lockTimeout = d
+	}
+}
+
+// WithReadOnly 以只读模式打开数据库, 所有修改操作都会失败
+func WithReadOnly() Option {
+	return func(fs *BBolt) {
+		fs.readOnly = true
+	}
+}
+
+// WithBackslashSeparator 将路径中的 '\' 视为目录分隔符并转换为 '/'.
+// 由于 '\' 在 Unix 上是合法的文件名字符, 该行为需要显式开启
+func WithBackslashSeparator() Option {
+	return func(fs *BBolt) {
+		fs.backslash = true
+	}
+}
+
+// WithMaxPathDepth 拒绝创建超过 n 层的文件或目录并返回 ErrPathTooDeep, 防止异常输入生成过长的 key
+func WithMaxPathDepth(n int) Option {
+	return func(fs *BBolt) {
+		fs.maxPathDepth = n
+	}
+}
+
+// WithMaxFiles 限制文件 (不含目录) 的数量, 超过 n 个时创建文件返回 ErrTooManyFiles, 防止 key 数量失控.
+// 文件数量保存在数据库中随创建和删除更新, 打开时重新统计
+func WithMaxFiles(n int) Option {
+	return func(fs *BBolt) {
+		fs.maxFiles = n
+	}
+}
+
+// WithReadableMeta 以 JSON 格式写入元数据, 时间保存为 RFC3339 字符串, 便于用 bbolt 工具直接查看.
+// 占用的空间比默认的二进制格式多, 两种格式的数据都能正常读取
+func WithReadableMeta() Option {
+	return func(fs *BBolt) {
+		fs.readableMeta = true
+	}
+}
+
+// WithCaseInsensitive 使路径不区分大小写: key 统一转换为小写, 文件和目录创建时的原始名称作为显示名称
+// 保存, Stat 和 ReadDir 返回显示名称. 只改变大小写的 Rename 只更新显示名称
+func WithCaseInsensitive() Option {
+	return func(fs *BBolt) {
+		fs.caseInsensitive = true
+	}
+}
+
+// WithIOStats 在内存中按路径统计读写的字节数, 通过 IOStats 查询
+func WithIOStats() Option {
+	return func(fs *BBolt) {
+		fs.ioStats = newIOStats()
+	}
+}
+
+// WithFlatMode 以扁平的 key/value 方式使用文件系统: 不保存目录, Mkdir 不做任何事,
+// 目录列表和目录的 Stat 由文件路径的前缀推导. 适合不需要目录语义的纯 key/value 场景
+func WithFlatMode() Option {
+	return func(fs *BBolt) {
+		fs.flat = true
+	}
+}
+
+// WithCreationOrderListing 使 Readdir 按创建顺序而不是名称顺序返回子项. 首次开启时根据已有数据
+// 生成创建顺序索引, 之后每次增删都会多写一个索引项; 开启前创建的项排在最前面, 按名称排列
+func WithCreationOrderListing() Option {
+	return func(fs *BBolt) {
+		fs.creationOrder = true
+	}
+}
+
+// WithStrictDirRead 使目录句柄的 Read/ReadAt 与 POSIX 的 EISDIR 一样返回 ErrIsDirectory,
+// 默认返回 io.EOF 以兼容已有的调用方
+func WithStrictDirRead() Option {
+	return func(fs *BBolt) {
+		fs.strictDirRead = true
+	}
+}
+
+// WithSyncOnClose 在每次关闭文件时将数据库同步到磁盘, 默认关闭以保证性能
+func WithSyncOnClose() Option {
+	return func(fs *BBolt) {
+		fs.syncOnClose = true
+	}
+}
+
+// WithSyncOnCreate 使 Create 和 CreateWith 在返回前将新文件连同父目录的修改时间和索引一起同步到磁盘
+func WithSyncOnCreate() Option {
+	return func(fs *BBolt) {
+		fs.syncOnCreate = true
+	}
+}
+
+// WithExclusiveCreate 让 Create、CreateWith、WriteString 等所有创建文件的途径都按 O_CREATE|O_EXCL 处理,
+// 文件已存在时返回 ErrFileExists 而不是清空它. 需要覆盖时先 Remove 或以 O_TRUNC 打开
+func WithExclusiveCreate() Option {
+	return func(fs *BBolt) {
+		fs.exclCreate = true
+	}
+}
+
+// WithInlineThreshold 设置内联阈值: 小于 n 字节的文件与元数据存放在同一个 value 中,
+// 其余文件按 WithChunkSize 指定的大小分块存储, 避免单个 value 过大. n <= 0 表示所有文件都内联存储 (默认)
+func WithInlineThreshold(n int) Option {
+	return func(fs *BBolt) {
+		fs.inlineThreshold = n
+	}
+}
+
+// WithChunkSize 设置分块存储的文件每块的大小, n <= 0 时使用默认的 64 KiB. 分块大小记录在每个文件的元数据中,
+// 修改后已有文件仍按原来的分块大小读写, 直到整体重写时才按新的大小重新分块
+func WithChunkSize(n int) Option {
+	return func(fs *BBolt) {
+		if n > 0 {
+			fs.chunkSize = n
+		}
+	}
+}
+
+// WithOpTimeout 为每个写事务设置超时时间, 超时后操作返回 context.DeadlineExceeded.
+// 注意 bbolt 事务无法被强制取消, 超时的事务仍会在后台继续执行直到提交或回滚,
+// 因此超时并不代表修改一定没有生效
+func WithOpTimeout(d time.Duration) Option {
+	return func(fs *BBolt) {
+		fs.opTimeout = d
+	}
+}
+
+// WithStatCache 开启容量为 n 的 Stat 结果 LRU 缓存. 通过 fs 的修改会自动使缓存失效,
+// 通过 DB 直接修改数据时需要调用 InvalidateCache 或 InvalidateAll
+func WithStatCache(n int) Option {
+	return func(fs *BBolt) {
+		if n > 0 {
+			fs.statCache = newStatCache(n)
+		}
+	}
+}
+
+// WithTxPool 缓存最多 n 个只读事务供 Stat/Open/Readdir 等读操作复用, 降低高并发读取时开启事务的开销.
+// 通过 fs 的写入提交后缓存的事务会全部丢弃, 不会读到旧数据; 通过 DB 直接写入时需要调用 InvalidateAll.
+// 空闲事务会阻止旧页面被回收直到下一次写入, 写入很少而数据频繁变化的场景下数据库文件可能略大
+func WithTxPool(n int) Option {
+	return func(fs *BBolt) {
+		fs.txPoolSize = n
+	}
+}
+
+// WithSpillThreshold 使 OpenBuffered 返回的句柄在内存中的内容超过 n 字节时, 将其写入数据库并释放内存,
+// 大文件的流式写入因此只占用有限的内存. 需要配合 WithInlineThreshold 使用分块存储, 否则每次写入都会重写整个文件.
+// 之后对该句柄的读取或随机写入会重新将内容读入内存
+func WithSpillThreshold(n int) Option {
+	return func(fs *BBolt) {
+		fs.spillThreshold = n
+	}
+}
+
+// WithLazyRead 使 Open 只读取元数据而不读取文件内容, 内容在第一次 Read、ReadAt、Seek 或随机写入时才从数据库读入内存.
+// 打开后只调用 Stat 或追加写入的大文件因此不会被整个读入内存. 默认在 Open 时读取全部内容
+func WithLazyRead() Option {
+	return func(fs *BBolt) {
+		fs.lazyRead = true
+	}
+}
+
+// WithWriteBuffer 使 Create、CreateWith、Open 和 OpenFile 返回的句柄与 OpenBuffered 一样在内存中积累修改,
+// 未写入的修改超过 n 字节或调用 Sync/Close 时才写入数据库, 顺序写入大文件时不再每次 Write 都重写整个文件.
+// 写入数据库之前其他句柄读不到这些修改. n <= 0 表示每次修改都立即写入 (默认)
+func WithWriteBuffer(n int) Option {
+	return func(fs *BBolt) {
+		fs.writeBuffer = n
+	}
+}
@@ -0,0 +1,123 @@
+package bboltfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+
+	"go.etcd.io/bbolt"
+)
+
+// bucketOrder 是按创建顺序排列的目录索引, 只在开启 WithCreationOrderListing 后创建, bucket 存在时随目录索引一起维护.
+// 其中有两类 key:
+//
+//	'o' + "父目录\x00" + Seq(8 字节大端序) + 名称 -> 空
+//	'r' + "父目录\x00名称"                      -> Seq, 删除时用于找到上面的 key
+//
+// 升级前创建的项 Seq 为 0, 按名称排在最前面
+const bucketOrder = "order"
+
+func orderKey(name string, seq uint64) []byte {
+	dir, base := splitPath(name)
+	key := append([]byte{'o'}, indexPrefix(dir)...)
+	key = binary.BigEndian.AppendUint64(key, seq)
+	return append(key, base...)
+}
+
+func orderRevKey(name string) []byte {
+	return append([]byte{'r'}, indexKey(name)...)
+}
+
+// orderPut 按 name 当前元数据中的 Seq 更新创建顺序索引, 需要在写入元数据之后调用
+func orderPut(tx *bbolt.Tx, name string, isDir bool) error {
+	b := tx.Bucket([]byte(bucketOrder))
+	if b == nil {
+		return nil
+	}
+	src := tx.Bucket([]byte(bucketFiles))
+	if isDir {
+		src = tx.Bucket([]byte(bucketDirs))
+	}
+	var seq uint64
+	if val := src.Get([]byte(name)); val != nil {
+		meta, _ := parseMeta(val)
+		seq = meta.Seq
+	}
+	if v := b.Get(orderRevKey(name)); len(v) == 8 && binary.BigEndian.Uint64(v) == seq {
+		return nil
+	}
+	if err := orderDelete(tx, name); err != nil {
+		return err
+	}
+	if err := b.Put(orderKey(name, seq), nil); err != nil {
+		return err
+	}
+	return b.Put(orderRevKey(name), binary.BigEndian.AppendUint64(nil, seq))
+}
+
+func orderDelete(tx *bbolt.Tx, name string) error {
+	b := tx.Bucket([]byte(bucketOrder))
+	if b == nil {
+		return nil
+	}
+	rev := orderRevKey(name)
+	v := b.Get(rev)
+	if len(v) != 8 {
+		return nil
+	}
+	if err := b.Delete(orderKey(name, binary.BigEndian.Uint64(v))); err != nil {
+		return err
+	}
+	return b.Delete(rev)
+}
+
+// ensureOrder 创建创建顺序索引并根据目录索引生成, 已存在时不做任何事
+func ensureOrder(tx *bbolt.Tx) error {
+	if tx.Bucket([]byte(bucketOrder)) != nil {
+		return nil
+	}
+	if _, err := tx.CreateBucket([]byte(bucketOrder)); err != nil {
+		return err
+	}
+	return buildOrder(tx)
+}
+
+func buildOrder(tx *bbolt.Tx) error {
+	var names []string
+	var dirs []bool
+	err := tx.Bucket([]byte(bucketIndex)).ForEach(func(_, v []byte) error {
+		names = append(names, string(v[1:]))
+		dirs = append(dirs, v[0] == indexDir)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i, name := range names {
+		if err = orderPut(tx, name, dirs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orderReadDirTx 按创建顺序列出目录 dir 的直接子项, count > 0 时最多返回 count 项
+func (fs *BBolt) orderReadDirTx(tx *bbolt.Tx, dir string, count int) []os.FileInfo {
+	var fis []os.FileInfo
+	index := tx.Bucket([]byte(bucketIndex))
+	prefix := append([]byte{'o'}, indexPrefix(dir)...)
+	c := tx.Bucket([]byte(bucketOrder)).Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		base := k[len(prefix)+8:]
+		ik := append(indexPrefix(dir), base...)
+		fi := fs.indexEntry(tx, string(base), index.Get(ik))
+		if fi == nil {
+			continue
+		}
+		fis = append(fis, fi)
+		if count > 0 && len(fis) >= count {
+			break
+		}
+	}
+	return fis
+}
@@ -0,0 +1,80 @@
+package bboltfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBBoltFs_CreationOrderListing(t *testing.T) {
+	fs := newTestFs(t, WithCreationOrderListing())
+	if err := fs.Mkdir("dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"dir/charlie", "dir/alpha", "dir/bravo"} {
+		f, err := fs.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+	if err := fs.Mkdir("dir/sub", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if names := readDirNames(t, fs, "dir"); !reflect.DeepEqual(names, []string{"charlie", "alpha", "bravo", "sub"}) {
+		t.Errorf("ReadDir = %v", names)
+	}
+
+	// 重写内容不改变顺序, 重命名保持创建序号, 删除后不再列出
+	f, err := fs.Create("dir/charlie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	if err := fs.Rename("dir/alpha", "dir/zulu"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Remove("dir/bravo"); err != nil {
+		t.Fatal(err)
+	}
+	if names := readDirNames(t, fs, "dir"); !reflect.DeepEqual(names, []string{"charlie", "zulu", "sub"}) {
+		t.Errorf("ReadDir after changes = %v", names)
+	}
+	if infos, _ := fs.readDir("dir", 2); len(infos) != 2 || infos[1].Name() != "zulu" {
+		t.Errorf("readDir count 2 = %v", infos)
+	}
+	if err := fs.RebuildIndex(); err != nil {
+		t.Fatal(err)
+	}
+	if names := readDirNames(t, fs, "dir"); !reflect.DeepEqual(names, []string{"charlie", "zulu", "sub"}) {
+		t.Errorf("ReadDir after RebuildIndex = %v", names)
+	}
+}
+
+func TestBBoltFs_CreationOrderListing_Enable(t *testing.T) {
+	path := mustTmpFile(t)
+	fs, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"b", "c", "a"} {
+		f, err := fs.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+	if names := readDirNames(t, fs.(*BBolt), ""); !reflect.DeepEqual(names, []string{"a", "b", "c"}) {
+		t.Errorf("ReadDir without option = %v", names)
+	}
+	_ = fs.Close()
+
+	// 之后开启时根据已有的创建序号生成索引
+	fs, err = New(path, WithCreationOrderListing())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+	if names := readDirNames(t, fs.(*BBolt), ""); !reflect.DeepEqual(names, []string{"b", "c", "a"}) {
+		t.Errorf("ReadDir with option = %v", names)
+	}
+}
@@ -0,0 +1,35 @@
+package bboltfs
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBBoltFs_Prefetch(t *testing.T) {
+	fs := newTestFs(t, WithInlineThreshold(16))
+	fs.chunkSize = 16
+	_ = fs.MkdirAll("hot/sub", 0755)
+	_ = fs.MkdirAll("cold", 0755)
+	for name, content := range map[string][]byte{
+		"hot/a":     []byte("small"),
+		"hot/sub/b": bytes.Repeat([]byte("x"), 100),
+		"cold/c":    []byte("other"),
+	} {
+		f, err := fs.CreateWith(name, content, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+
+	if err := fs.Prefetch("hot"); err != nil {
+		t.Fatalf("Prefetch: %v", err)
+	}
+	// hot, hot/sub, hot/a, hot/sub/b
+	if n, err := fs.prefetch("hot"); err != nil || n != 4 {
+		t.Errorf("prefetch(hot) = %d, %v; want 4", n, err)
+	}
+	if n, err := fs.prefetch(""); err != nil || n != 6 {
+		t.Errorf("prefetch(\"\") = %d, %v; want 6", n, err)
+	}
+}
@@ -0,0 +1,120 @@
+package bboltfs
+
+import (
+	"bufio"
+	"io"
+	"os"
+
+	"go.etcd.io/bbolt"
+)
+
+// contentReader 在事务中按顺序读取文件内容, 每次只读取涉及的分块
+type contentReader struct {
+	fs     *BBolt
+	tx     *bbolt.Tx
+	meta   fileMeta
+	inline []byte
+	off    int64
+}
+
+func (r *contentReader) Read(p []byte) (int, error) {
+	if r.off >= r.meta.Size {
+		return 0, io.EOF
+	}
+	n := r.fs.readAt(r.tx, r.meta, r.inline, p, r.off)
+	r.off += int64(n)
+	return n, nil
+}
+
+// OpenReader 返回按行读取等场景使用的 bufio.Reader 和关闭函数. 每次填充缓冲区时在独立的读事务中
+// 读取下一块内容, 不会长时间占用事务; 读取期间文件被修改时, 之后读到的是修改后的内容
+func (fs *BBolt) OpenReader(name string) (*bufio.Reader, func() error, error) {
+	name = fs.normalize(name)
+	size := defaultChunkSize
+	err := fs.view(func(tx *bbolt.Tx) error {
+		val := tx.Bucket([]byte(bucketFiles)).Get([]byte(name))
+		if val == nil {
+			if tx.Bucket([]byte(bucketDirs)).Get([]byte(name)) != nil {
+				return ErrIsDirectory
+			}
+			return ErrFileNotFound
+		}
+		if meta := fs.decodeMeta(val); meta.Storage == storageChunked {
+			size = int(meta.ChunkSize)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	r := &streamReader{fs: fs, name: name}
+	return bufio.NewReaderSize(r, size), r.close, nil
+}
+
+// streamReader 每次 Read 在一个读事务中读取文件 off 之后的内容
+type streamReader struct {
+	fs     *BBolt
+	name   string
+	off    int64
+	closed bool
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+	var n int
+	err := r.fs.view(func(tx *bbolt.Tx) error {
+		val := tx.Bucket([]byte(bucketFiles)).Get([]byte(r.name))
+		if val == nil {
+			return ErrFileNotFound
+		}
+		meta, inline := r.fs.splitMeta(val)
+		n = r.fs.readAt(tx, meta, inline, p, r.off)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 && len(p) > 0 {
+		return 0, io.EOF
+	}
+	r.fs.ioStats.add(r.name, n, 0)
+	r.off += int64(n)
+	return n, nil
+}
+
+func (r *streamReader) close() error {
+	r.closed = true
+	return nil
+}
+
+// rangeReader 每次 ReadAt 在一个读事务中读取文件 off 处的内容
+type rangeReader struct {
+	fs   *BBolt
+	name string
+}
+
+func (r *rangeReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, os.ErrInvalid
+	}
+	var n int
+	err := r.fs.view(func(tx *bbolt.Tx) error {
+		val := tx.Bucket([]byte(bucketFiles)).Get([]byte(r.name))
+		if val == nil {
+			return ErrFileNotFound
+		}
+		meta, inline := r.fs.splitMeta(val)
+		n = r.fs.readAt(tx, meta, inline, p, off)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	r.fs.ioStats.add(r.name, n, 0)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,44 @@
+package bboltfs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBBoltFs_OpenReader(t *testing.T) {
+	fs := newTestFs(t, WithInlineThreshold(16))
+	fs.chunkSize = 16
+	var lines []string
+	for i := 0; i < 20; i++ {
+		lines = append(lines, strings.Repeat("x", i)+"|")
+	}
+	f, err := fs.CreateWith("multi.txt", []byte(strings.Join(lines, "\n")+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	r, closeFn, err := fs.OpenReader("multi.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			break
+		}
+		got = append(got, strings.TrimSuffix(line, "\n"))
+	}
+	if !reflect.DeepEqual(got, lines) {
+		t.Errorf("lines = %q, want %q", got, lines)
+	}
+	if err := closeFn(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := fs.OpenReader("missing"); err == nil {
+		t.Error("OpenReader on missing file should fail")
+	}
+}
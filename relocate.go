@@ -0,0 +1,69 @@
+package bboltfs
+
+import (
+	"errors"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+var ErrHandlesOpen = errors.New("bboltfs: file handles are still open")
+
+// ErrDatabaseLost 表示 Compact 或 Relocate 关闭数据库后无法重新打开, 文件系统不再可用, 只能关闭后重新 New
+var ErrDatabaseLost = errors.New("bboltfs: database could not be reopened")
+
+// Relocate 将数据库迁移到 newPath: 先在读事务中复制一份一致的备份, 再关闭当前数据库并从 newPath 重新打开.
+// 仍有未关闭的句柄时返回 ErrHandlesOpen. 原文件保留不动, 确认迁移成功后由调用方删除.
+// 迁移期间其他 goroutine 的操作会等待迁移完成
+func (fs *BBolt) Relocate(newPath string) error {
+	if handles := fs.OpenHandles(); len(handles) > 0 {
+		return fmt.Errorf("%w: %v", ErrHandlesOpen, handles)
+	}
+	// 复制和切换都在写锁内完成, 复制之后提交的写入不会丢失
+	fs.dbMu.Lock()
+	defer fs.dbMu.Unlock()
+	if fs.dbErr != nil {
+		return fs.dbErr
+	}
+	if err := fs.db.View(func(tx *bbolt.Tx) error {
+		return tx.CopyFile(newPath, 0600)
+	}); err != nil {
+		return translateErr(err)
+	}
+	if fs.txPool != nil {
+		fs.txPool.close()
+	}
+	if err := fs.db.Close(); err != nil {
+		return err
+	}
+	db, err := fs.openDB(newPath)
+	if err != nil {
+		// 新文件无法打开时退回原文件, 保证文件系统依然可用
+		old, oldErr := fs.openDB(fs.name)
+		if oldErr != nil {
+			return fs.lostDB(oldErr)
+		}
+		fs.setDB(old)
+		return err
+	}
+	fs.setDB(db)
+	fs.name = newPath
+	fs.statCache.clear()
+	return nil
+}
+
+// setDB 切换底层数据库并按配置重建事务池
+func (fs *BBolt) setDB(db *bbolt.DB) {
+	fs.db, fs.dbErr = db, nil
+	fs.txPool = nil
+	if fs.txPoolSize > 0 {
+		fs.txPool = newTxPool(db, fs.txPoolSize)
+	}
+}
+
+// lostDB 在关闭数据库后无法重新打开时调用, 记录错误使之后的操作都返回 ErrDatabaseLost 而不是访问已关闭的数据库
+func (fs *BBolt) lostDB(err error) error {
+	fs.txPool = nil
+	fs.dbErr = fmt.Errorf("%w: %v", ErrDatabaseLost, err)
+	return fs.dbErr
+}
@@ -0,0 +1,91 @@
+package bboltfs
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBBoltFs_Relocate(t *testing.T) {
+	fs := newTestFs(t, WithTxPool(2))
+	_ = fs.MkdirAll("d", 0755)
+	f, err := fs.CreateWith("d/a", []byte("before"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newPath := filepath.Join(t.TempDir(), "moved.db")
+	if err := fs.Relocate(newPath); !errors.Is(err, ErrHandlesOpen) {
+		t.Fatalf("Relocate with open handle: err = %v", err)
+	}
+	_ = f.Close()
+	if err := fs.Relocate(newPath); err != nil {
+		t.Fatalf("Relocate: %v", err)
+	}
+	if fs.Name() != newPath || fs.db.Path() != newPath {
+		t.Fatalf("name = %s, db path = %s", fs.Name(), fs.db.Path())
+	}
+
+	if got := readAll(t, fs, "d/a"); got != "before" {
+		t.Errorf("content after relocate = %q", got)
+	}
+	f, err = fs.CreateWith("d/b", []byte("after"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新打开新文件, 迁移后的写入已保存在其中
+	reopened, err := New(newPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	for name, want := range map[string]string{"d/a": "before", "d/b": "after"} {
+		if got := readAll(t, reopened, name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestBBoltFs_RelocateConcurrentWrites(t *testing.T) {
+	fs := newTestFs(t)
+	// 数据库足够大, 复制期间有机会提交写入
+	if err := fs.WriteString("big", strings.Repeat("x", 8<<20), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	done := make(chan []string)
+	go func() {
+		// 迁移期间持续写入, 每个返回成功的写入都必须出现在新文件中
+		var written []string
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				done <- written
+				return
+			default:
+			}
+			name := fmt.Sprintf("f%d", i)
+			if err := fs.WriteString(name, name, 0644); err == nil {
+				written = append(written, name)
+			}
+		}
+	}()
+	for i := 0; i < 3; i++ {
+		if err := fs.Relocate(filepath.Join(t.TempDir(), fmt.Sprintf("moved%d.db", i))); err != nil {
+			t.Fatalf("Relocate: %v", err)
+		}
+	}
+	close(stop)
+	for _, name := range <-done {
+		if _, err := fs.Stat(name); err != nil {
+			t.Errorf("%s written during Relocate was lost: %v", name, err)
+		}
+	}
+}
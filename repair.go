@@ -0,0 +1,159 @@
+package bboltfs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	"go.etcd.io/bbolt"
+)
+
+// ResolveConflicts 的优先类型
+const (
+	PreferFile = "file"
+	PreferDir  = "dir"
+)
+
+// ResolveConflicts 查找同时存在于 files 和 dirs 中的路径, 保留 prefer 指定的类型并删除另一种,
+// 返回处理的路径数量
+func (fs *BBolt) ResolveConflicts(prefer string) (int, error) {
+	var drop string
+	switch prefer {
+	case PreferFile:
+		drop = bucketDirs
+	case PreferDir:
+		drop = bucketFiles
+	default:
+		return 0, fmt.Errorf("%w: prefer must be %q or %q", os.ErrInvalid, PreferFile, PreferDir)
+	}
+	var n int
+	err := fs.update(func(tx *bbolt.Tx) error {
+		files := tx.Bucket([]byte(bucketFiles))
+		var keys [][]byte
+		err := tx.Bucket([]byte(bucketDirs)).ForEach(func(k, _ []byte) error {
+			if files.Get(k) != nil {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		b := tx.Bucket([]byte(drop))
+		for _, k := range keys {
+			if prefer == PreferDir {
+				err = fs.deleteFile(tx, string(k))
+			} else {
+				err = b.Delete(k)
+			}
+			if err != nil {
+				return err
+			}
+			if err = indexPut(tx, string(k), prefer == PreferDir); err != nil {
+				return err
+			}
+		}
+		n = len(keys)
+		return nil
+	})
+	return n, err
+}
+
+// FixSizes 扫描所有文件, 按实际存储的内容重新计算大小并修正与元数据不一致的记录, 返回修正的文件数量.
+// 分块存储的文件末尾可能是不存储分块的空洞, 因此只在最后一个分块超出记录的大小时修正
+func (fs *BBolt) FixSizes() (int, error) {
+	var n int
+	err := fs.update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucketFiles))
+		fixed := make(map[string][]byte)
+		err := b.ForEach(func(k, v []byte) error {
+			meta, inline := fs.splitMeta(v)
+			size := fs.storedSize(tx, meta, inline)
+			if size == meta.Size || meta.Storage == storageChunked && size < meta.Size {
+				return nil
+			}
+			meta.Size = size
+			val := fs.encodeMeta(meta)
+			if meta.Storage != storageChunked {
+				val = append(val, inline...)
+			}
+			// ForEach 期间不能修改 bucket, 先记录下来
+			fixed[string(k)] = val
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for k, v := range fixed {
+			if err := b.Put([]byte(k), v); err != nil {
+				return err
+			}
+		}
+		n = len(fixed)
+		return nil
+	})
+	return n, err
+}
+
+// storedSize 返回文件实际存储的内容长度
+func (fs *BBolt) storedSize(tx *bbolt.Tx, meta fileMeta, inline []byte) int64 {
+	if meta.Storage != storageChunked {
+		return int64(len(inline))
+	}
+	c := tx.Bucket([]byte(bucketChunks)).Cursor()
+	// 定位到下一个 inode 的第一个分块之前, 即当前 inode 的最后一个分块
+	k, v := c.Seek(chunkKey(meta.Ino+1, 0))
+	if k == nil {
+		k, v = c.Last()
+	} else {
+		k, v = c.Prev()
+	}
+	if k == nil || binary.BigEndian.Uint64(k[:8]) != meta.Ino {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(k[8:]))*int64(meta.ChunkSize) + int64(len(v))
+}
+
+// GCOrphans 删除 chunks bucket 中不属于任何文件的分块, 包括 inode 没有对应文件的分块,
+// 以及超出文件大小的多余分块, 返回删除的分块数量
+func (fs *BBolt) GCOrphans() (int, error) {
+	var n int
+	err := fs.update(func(tx *bbolt.Tx) error {
+		// 每个分块存储的文件 inode 可以拥有的分块数
+		owned := make(map[uint64]uint64)
+		err := tx.Bucket([]byte(bucketFiles)).ForEach(func(k, v []byte) error {
+			meta := fs.decodeMeta(v)
+			if meta.Storage == storageChunked && meta.ChunkSize > 0 {
+				cs := uint64(meta.ChunkSize)
+				owned[meta.Ino] = (uint64(meta.Size) + cs - 1) / cs
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		chunks := tx.Bucket([]byte(bucketChunks))
+		var orphans [][]byte
+		err = chunks.ForEach(func(k, _ []byte) error {
+			if len(k) != 16 {
+				return nil
+			}
+			count, ok := owned[binary.BigEndian.Uint64(k[:8])]
+			if !ok || binary.BigEndian.Uint64(k[8:]) >= count {
+				orphans = append(orphans, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range orphans {
+			if err = chunks.Delete(k); err != nil {
+				return err
+			}
+		}
+		n = len(orphans)
+		return nil
+	})
+	return n, err
+}
@@ -0,0 +1,147 @@
+package bboltfs
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestBBoltFs_FileDirInvariant(t *testing.T) {
+	fs := newTestFs(t)
+
+	_ = fs.Mkdir("d", 0755)
+	if _, err := fs.Create("d"); !errors.Is(err, os.ErrExist) {
+		t.Errorf("Create over dir = %v, want ErrExist", err)
+	}
+	f, _ := fs.Create("f")
+	f.Close()
+	if err := fs.Mkdir("f", 0755); !errors.Is(err, os.ErrExist) {
+		t.Errorf("Mkdir over file = %v, want ErrExist", err)
+	}
+}
+
+func TestBBoltFs_ResolveConflicts(t *testing.T) {
+	fs := newTestFs(t)
+
+	// 绕过写入检查, 直接注入冲突
+	inject := func(name string) {
+		err := fs.db.Update(func(tx *bbolt.Tx) error {
+			if err := tx.Bucket([]byte(bucketFiles)).Put([]byte(name), fs.encodeMeta(fileMeta{Mode: 0644})); err != nil {
+				return err
+			}
+			return tx.Bucket([]byte(bucketDirs)).Put([]byte(name), fs.encodeMeta(fileMeta{Mode: os.ModeDir | 0755, IsDir: true}))
+		})
+		if err != nil {
+			t.Fatalf("inject: %v", err)
+		}
+	}
+
+	inject("both")
+	n, err := fs.ResolveConflicts(PreferDir)
+	if err != nil || n != 1 {
+		t.Fatalf("ResolveConflicts(dir) = %d, %v, want 1", n, err)
+	}
+	if info, err := fs.Stat("both"); err != nil || !info.IsDir() {
+		t.Errorf("Stat after prefer dir = %v, %v", info, err)
+	}
+
+	inject("both")
+	n, err = fs.ResolveConflicts(PreferFile)
+	if err != nil || n != 1 {
+		t.Fatalf("ResolveConflicts(file) = %d, %v, want 1", n, err)
+	}
+	if info, err := fs.Stat("both"); err != nil || info.IsDir() {
+		t.Errorf("Stat after prefer file = %v, %v", info, err)
+	}
+
+	if n, _ := fs.ResolveConflicts(PreferFile); n != 0 {
+		t.Errorf("second ResolveConflicts = %d, want 0", n)
+	}
+	if _, err := fs.ResolveConflicts("other"); err == nil {
+		t.Errorf("invalid prefer should fail")
+	}
+}
+
+func TestBBoltFs_FixSizes(t *testing.T) {
+	fs := newTestFs(t, WithInlineThreshold(16))
+	fs.chunkSize = 8
+	for name, content := range map[string]string{"inline": "hello", "chunked": "0123456789abcdefXYZ", "ok": "fine"} {
+		f, err := fs.CreateWith(name, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+	// 直接写入错误的大小
+	corrupt := func(name string, size int64) {
+		t.Helper()
+		err := fs.db.Update(func(tx *bbolt.Tx) error {
+			b := tx.Bucket([]byte(bucketFiles))
+			meta, inline := fs.splitMeta(b.Get([]byte(name)))
+			meta.Size = size
+			return b.Put([]byte(name), append(fs.encodeMeta(meta), inline...))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	corrupt("inline", 99)
+	corrupt("chunked", 3)
+
+	n, err := fs.FixSizes()
+	if err != nil || n != 2 {
+		t.Fatalf("FixSizes = %d, %v; want 2", n, err)
+	}
+	for name, want := range map[string]int64{"inline": 5, "chunked": 19, "ok": 4} {
+		if fi, err := fs.Stat(name); err != nil || fi.Size() != want {
+			t.Errorf("%s: size = %v, %v; want %d", name, fi, err, want)
+		}
+	}
+	if got := readAll(t, fs, "chunked"); got != "0123456789abcdefXYZ" {
+		t.Errorf("chunked content = %q", got)
+	}
+	if n, err := fs.FixSizes(); err != nil || n != 0 {
+		t.Errorf("second FixSizes = %d, %v", n, err)
+	}
+}
+
+func TestBBoltFs_GCOrphans(t *testing.T) {
+	fs := newTestFs(t, WithInlineThreshold(16))
+	fs.chunkSize = 8
+	for _, name := range []string{"lost", "kept"} {
+		f, err := fs.CreateWith(name, []byte("0123456789abcdefXYZ"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+	before := chunkCount(t, fs)
+	// 直接删除文件的元数据, 留下它的分块; 并为 kept 伪造一个超出大小的分块
+	err := fs.db.Update(func(tx *bbolt.Tx) error {
+		files := tx.Bucket([]byte(bucketFiles))
+		meta := fs.decodeMeta(files.Get([]byte("kept")))
+		if err := tx.Bucket([]byte(bucketChunks)).Put(chunkKey(meta.Ino, 10), []byte("stale")); err != nil {
+			return err
+		}
+		return files.Delete([]byte("lost"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := fs.GCOrphans()
+	if err != nil || n != before/2+1 {
+		t.Fatalf("GCOrphans = %d, %v; want %d", n, err, before/2+1)
+	}
+	if got := chunkCount(t, fs); got != before/2 {
+		t.Errorf("chunk count = %d, want %d", got, before/2)
+	}
+	if got := readAll(t, fs, "kept"); got != "0123456789abcdefXYZ" {
+		t.Errorf("kept content = %q", got)
+	}
+	if n, err := fs.GCOrphans(); err != nil || n != 0 {
+		t.Errorf("second GCOrphans = %d, %v", n, err)
+	}
+}
@@ -0,0 +1,80 @@
+package bboltfs
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// rotateTimeFormat 是轮转后文件名中的时间戳格式, 按字典序排序即按时间排序
+const rotateTimeFormat = "20060102T150405.000000000"
+
+// AppendLine 将 line 追加到文件 name 的末尾 (不存在时创建), line 不以换行符结尾时补上一个.
+// rotateAt > 0 且追加后文件会超过 rotateAt 字节时, 先将原文件重命名为带时间戳的名称再写入新文件,
+// 并返回轮转后的文件名; 没有轮转时返回 "". 检查大小、轮转和写入在同一个事务中完成
+func (fs *BBolt) AppendLine(name string, line []byte, rotateAt int64) (string, error) {
+	if len(line) == 0 || line[len(line)-1] != '\n' {
+		line = append(append([]byte(nil), line...), '\n')
+	}
+	raw := name
+	name = fs.normalize(name)
+	var rotated string
+	err := fs.update(func(tx *bbolt.Tx) error {
+		name, err := fs.resolveTx(tx, name, true)
+		if err != nil {
+			return err
+		}
+		val := tx.Bucket([]byte(bucketFiles)).Get([]byte(name))
+		if val == nil && tx.Bucket([]byte(bucketDirs)).Get([]byte(name)) != nil {
+			return ErrIsDirectory
+		}
+		now := time.Now()
+		mode := os.FileMode(0666)
+		if val != nil {
+			old := fs.decodeMeta(val)
+			mode = old.Mode
+			if rotateAt > 0 && old.Size > 0 && old.Size+int64(len(line)) > rotateAt {
+				rotated = rotatedName(tx, name, now)
+				if err = fs.rename(tx, name, rotated); err != nil {
+					return err
+				}
+				if err = fs.recordTx(tx, JournalRecord{Op: OpRename, Path: name, NewPath: rotated}); err != nil {
+					return err
+				}
+				val = nil
+			}
+		}
+		if val == nil {
+			meta := fileMeta{Mode: mode, Size: int64(len(line)), ModTime: now.UnixNano()}
+			if err = fs.putFileTx(tx, name, line, meta, true); err != nil {
+				return err
+			}
+			if err = fs.keepCaseTx(tx, name, raw); err != nil {
+				return err
+			}
+			return fs.recordTx(tx, JournalRecord{Op: OpCreate, Path: name, Mode: meta.Mode}, JournalRecord{Op: OpWrite, Path: name, Data: line, Size: meta.Size})
+		}
+		off := fs.decodeMeta(val).Size
+		meta, err := fs.writeAt(tx, name, val, line, off, now.UnixNano())
+		if err != nil {
+			return err
+		}
+		return fs.recordTx(tx, JournalRecord{Op: OpWrite, Path: name, Offset: off, Data: line, Size: meta.Size})
+	})
+	if err != nil {
+		return "", err
+	}
+	return rotated, nil
+}
+
+// rotatedName 返回 name 轮转后使用的名称, 同一时刻已有同名文件时追加序号
+func rotatedName(tx *bbolt.Tx, name string, now time.Time) string {
+	base := name + "." + now.Format(rotateTimeFormat)
+	rotated := base
+	for i := 1; exists(tx, rotated); i++ {
+		rotated = fmt.Sprintf("%s-%d", base, i)
+	}
+	return rotated
+}
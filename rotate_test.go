@@ -0,0 +1,51 @@
+package bboltfs
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBBoltFs_AppendLine(t *testing.T) {
+	fs := newTestFs(t)
+	_ = fs.Mkdir("logs", 0755)
+	var rotated []string
+	for _, line := range []string{"one", "two\n", "three", "four"} {
+		to, err := fs.AppendLine("logs/app.log", []byte(line), 12)
+		if err != nil {
+			t.Fatalf("AppendLine(%q): %v", line, err)
+		}
+		if to != "" {
+			rotated = append(rotated, to)
+		}
+	}
+	// "one\ntwo\n" 为 8 字节, 再追加 "three\n" 会超过 12 字节
+	if len(rotated) != 1 {
+		t.Fatalf("rotated = %v, want one rotation", rotated)
+	}
+	if !strings.HasPrefix(rotated[0], "logs/app.log.") {
+		t.Errorf("rotated name = %q", rotated[0])
+	}
+	if got := readAll(t, fs, rotated[0]); got != "one\ntwo\n" {
+		t.Errorf("rotated content = %q", got)
+	}
+	if got := readAll(t, fs, "logs/app.log"); got != "three\nfour\n" {
+		t.Errorf("current content = %q", got)
+	}
+	if names := readDirNames(t, fs, "logs"); len(names) != 2 {
+		t.Errorf("logs = %v, want 2 files", names)
+	}
+
+	// rotateAt <= 0 时不轮转
+	for i := 0; i < 5; i++ {
+		if to, err := fs.AppendLine("nolimit.log", []byte("line"), 0); err != nil || to != "" {
+			t.Fatalf("AppendLine = %q, %v", to, err)
+		}
+	}
+	if got := readAll(t, fs, "nolimit.log"); got != strings.Repeat("line\n", 5) {
+		t.Errorf("nolimit.log = %q", got)
+	}
+	if _, err := fs.AppendLine("logs", []byte("x"), 0); !errors.Is(err, ErrIsDirectory) {
+		t.Errorf("AppendLine(dir) = %v, want ErrIsDirectory", err)
+	}
+}
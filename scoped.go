@@ -0,0 +1,323 @@
+package bboltfs
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// ErrOutsideScope 表示路径通过 ".." 或符号链接跳出了 NewScoped 的前缀或 ImportZip 的目标目录
+var ErrOutsideScope = errors.New("bboltfs: path escapes scope")
+
+// scopedFs 将所有路径限定在 prefix 之下, 返回的名称去掉了前缀
+type scopedFs struct {
+	fs     *BBolt
+	prefix string
+}
+
+// scopedFile 包装底层句柄, Name、Stat 和目录列表返回的名称与 key 都相对于前缀
+type scopedFile struct {
+	File
+	s    *scopedFs
+	name string
+}
+
+var _ Fs = (*scopedFs)(nil)
+
+func (f *scopedFile) Name() string { return f.name }
+
+func (f *scopedFile) Stat() (os.FileInfo, error) {
+	fi, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return f.s.info(fi), nil
+}
+
+func (f *scopedFile) Readdir(count int) ([]os.FileInfo, error) {
+	infos, err := f.File.Readdir(count)
+	for i, fi := range infos {
+		infos[i] = f.s.info(fi)
+	}
+	return infos, err
+}
+
+func (f *scopedFile) ReadDir(n int) ([]os.DirEntry, error) {
+	entries, err := f.File.ReadDir(n)
+	if err != nil {
+		return entries, err
+	}
+	return f.s.entries(entries)
+}
+
+// scopedInfo 包装底层的 FileInfo, 前缀的根目录名称为 ".", Sys().Key 去掉了前缀
+type scopedInfo struct {
+	os.FileInfo
+	name string
+	key  string
+}
+
+var _ os.DirEntry = (*scopedInfo)(nil)
+
+func (fi *scopedInfo) Name() string               { return fi.name }
+func (fi *scopedInfo) Type() os.FileMode          { return fi.Mode().Type() }
+func (fi *scopedInfo) Info() (os.FileInfo, error) { return fi, nil }
+func (fi *scopedInfo) Sys() interface{} {
+	sys, ok := fi.FileInfo.Sys().(*SysInfo)
+	if !ok {
+		return fi.FileInfo.Sys()
+	}
+	c := *sys
+	c.Key = fi.key
+	return &c
+}
+
+// NewScoped 打开 name 处的数据库, 返回的 Fs 以 prefix 为根目录:
+// 所有路径都相对于 prefix 存储, 句柄的 Name 也不包含前缀. 试图通过 ".." 访问前缀之外的路径时
+// 返回 ErrOutsideScope. 路径中的符号链接同样在 prefix 之内解析, 绝对路径的目标相对于 prefix,
+// 指向 prefix 之外的链接返回 ErrOutsideScope. prefix 目录不存在时自动创建
+func NewScoped(name, prefix string, opts ...Option) (Fs, error) {
+	prefix = strings.Trim(path.Clean(prefix), "/")
+	if prefix == "" || prefix == "." || prefix == ".." || strings.HasPrefix(prefix, "../") {
+		return nil, os.ErrInvalid
+	}
+	f, err := New(name, opts...)
+	if err != nil {
+		return nil, err
+	}
+	fs := f.(*BBolt)
+	if !fs.readOnly {
+		if err = fs.MkdirAll(prefix, 0777); err != nil {
+			_ = fs.Close()
+			return nil, err
+		}
+	}
+	return &scopedFs{fs: fs, prefix: fs.normalize(prefix)}, nil
+}
+
+// full 将相对路径转换为底层存储的 key. 路径中的符号链接在前缀之内解析: 绝对路径的目标相对于前缀,
+// 跳出前缀的目标返回 ErrOutsideScope. follow 为 false 时不解析最后一个路径分量
+func (s *scopedFs) full(name string, follow bool) (string, error) {
+	name = strings.TrimLeft(path.Clean(s.fs.separators(name)), "/")
+	switch {
+	case name == "" || name == ".":
+		return s.prefix, nil
+	case name == ".." || strings.HasPrefix(name, "../"):
+		return "", ErrOutsideScope
+	}
+	full := s.prefix + "/" + name
+	var key string
+	err := s.fs.view(func(tx *bbolt.Tx) error {
+		var err error
+		key, err = s.fs.resolveUnderTx(tx, s.prefix, s.fs.normalize(name), follow)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if key == s.fs.normalize(full) {
+		// 没有符号链接时保留调用方的原始大小写
+		return full, nil
+	}
+	return key, nil
+}
+
+// rel 去掉 key 的前缀, 前缀本身返回 ""
+func (s *scopedFs) rel(key string) string {
+	if key == s.prefix {
+		return ""
+	}
+	// 前缀之外的 key 不应出现, 也不能原样返回
+	rel, _ := strings.CutPrefix(key, s.prefix+"/")
+	return rel
+}
+
+// info 将底层的 FileInfo 转换为相对于前缀的形式
+func (s *scopedFs) info(fi os.FileInfo) os.FileInfo {
+	sys, ok := fi.Sys().(*SysInfo)
+	if !ok {
+		return fi
+	}
+	key := s.rel(sys.Key)
+	name := fi.Name()
+	if key == "" {
+		name = "."
+	}
+	return &scopedInfo{FileInfo: fi, name: name, key: key}
+}
+
+// entries 将底层的目录列表转换为相对于前缀的形式
+func (s *scopedFs) entries(entries []os.DirEntry) ([]os.DirEntry, error) {
+	for i, e := range entries {
+		fi, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = s.info(fi).(os.DirEntry)
+	}
+	return entries, nil
+}
+
+func (s *scopedFs) wrap(f File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+	name := s.rel(f.Name())
+	if name == "" {
+		name = "."
+	}
+	return &scopedFile{File: f, s: s, name: name}, nil
+}
+
+func (s *scopedFs) Create(name string) (File, error) {
+	name, err := s.full(name, true)
+	if err != nil {
+		return nil, err
+	}
+	return s.wrap(s.fs.Create(name))
+}
+
+func (s *scopedFs) Mkdir(name string, perm os.FileMode) error {
+	name, err := s.full(name, false)
+	if err != nil {
+		return err
+	}
+	return s.fs.Mkdir(name, perm)
+}
+
+func (s *scopedFs) MkdirAll(p string, perm os.FileMode) error {
+	p, err := s.full(p, false)
+	if err != nil {
+		return err
+	}
+	return s.fs.MkdirAll(p, perm)
+}
+
+func (s *scopedFs) Open(name string) (File, error) {
+	name, err := s.full(name, true)
+	if err != nil {
+		return nil, err
+	}
+	return s.wrap(s.fs.Open(name))
+}
+
+func (s *scopedFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	// 与 BBolt.OpenFile 一样, O_EXCL 和 O_NOFOLLOW 不跟随最后一个路径分量上的符号链接, 交给底层检查
+	excl := flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL
+	name, err := s.full(name, !excl && flag&O_NOFOLLOW == 0)
+	if err != nil {
+		return nil, err
+	}
+	return s.wrap(s.fs.OpenFile(name, flag, perm))
+}
+
+func (s *scopedFs) Remove(name string) error {
+	name, err := s.full(name, false)
+	if err != nil {
+		return err
+	}
+	if name == s.prefix {
+		return os.ErrPermission // 不允许删除根目录
+	}
+	return s.fs.Remove(name)
+}
+
+func (s *scopedFs) ReadDir(name string) ([]os.DirEntry, error) {
+	name, err := s.full(name, true)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.fs.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.entries(entries)
+}
+
+// RemoveAll 对根目录调用时只删除其中的内容, 保留根目录本身
+func (s *scopedFs) RemoveAll(p string) error {
+	p, err := s.full(p, false)
+	if err != nil {
+		return err
+	}
+	if p != s.prefix {
+		return s.fs.RemoveAll(p)
+	}
+	entries, err := s.fs.ReadDir(p)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err = s.fs.RemoveAll(p + "/" + e.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *scopedFs) Rename(oldname, newname string) error {
+	oldname, err := s.full(oldname, false)
+	if err != nil {
+		return err
+	}
+	if newname, err = s.full(newname, false); err != nil {
+		return err
+	}
+	if oldname == s.prefix || newname == s.prefix {
+		return os.ErrPermission
+	}
+	return s.fs.Rename(oldname, newname)
+}
+
+func (s *scopedFs) Stat(name string) (os.FileInfo, error) {
+	name, err := s.full(name, true)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := s.fs.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.info(fi), nil
+}
+
+// Name 与 afero.BasePathFs 一样返回固定的名称, 不暴露数据库路径和前缀
+func (s *scopedFs) Name() string { return "ScopedFs" }
+
+func (s *scopedFs) Chmod(name string, mode os.FileMode) error {
+	name, err := s.full(name, false)
+	if err != nil {
+		return err
+	}
+	return s.fs.Chmod(name, mode)
+}
+
+func (s *scopedFs) Chown(name string, uid, gid int) error {
+	name, err := s.full(name, false)
+	if err != nil {
+		return err
+	}
+	return s.fs.Chown(name, uid, gid)
+}
+
+func (s *scopedFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	name, err := s.full(name, false)
+	if err != nil {
+		return err
+	}
+	return s.fs.Chtimes(name, atime, mtime)
+}
+
+func (s *scopedFs) Truncate(name string, size int64) error {
+	name, err := s.full(name, true)
+	if err != nil {
+		return err
+	}
+	return s.fs.Truncate(name, size)
+}
+
+func (s *scopedFs) Close() error { return s.fs.Close() }
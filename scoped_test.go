@@ -0,0 +1,235 @@
+package bboltfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestNewScoped(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scoped.db")
+	sfs, err := NewScoped(path, "tenant/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sfs.MkdirAll("docs", 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := sfs.Create("docs/readme.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Name() != "docs/readme.txt" {
+		t.Errorf("Name() = %q, want docs/readme.txt", f.Name())
+	}
+	if _, err = f.Write([]byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := sfs.ReadDir("/")
+	if err != nil || len(entries) != 1 || entries[0].Name() != "docs" {
+		t.Fatalf("ReadDir(/) = %v, %v; want [docs]", entries, err)
+	}
+	if fi, err := sfs.Stat("docs/../docs/readme.txt"); err != nil || fi.Size() != 2 {
+		t.Fatalf("Stat = %v, %v", fi, err)
+	}
+	for _, name := range []string{"..", "../b/x", "docs/../../x"} {
+		if _, err := sfs.Create(name); !errors.Is(err, ErrOutsideScope) {
+			t.Errorf("Create(%q) error = %v, want ErrOutsideScope", name, err)
+		}
+	}
+	if err = sfs.Remove("/"); err == nil {
+		t.Error("Remove(/) succeeded")
+	}
+	if err = sfs.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 底层存储的 key 带有前缀
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = db.View(func(tx *bbolt.Tx) error {
+		if tx.Bucket([]byte(bucketFiles)).Get([]byte("tenant/a/docs/readme.txt")) == nil {
+			t.Error("file not stored under tenant/a/")
+		}
+		if tx.Bucket([]byte(bucketDirs)).Get([]byte("tenant/a/docs")) == nil {
+			t.Error("dir not stored under tenant/a/")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewScoped_InvalidPrefix(t *testing.T) {
+	for _, prefix := range []string{"", "/", ".", "../x"} {
+		if _, err := NewScoped(filepath.Join(t.TempDir(), "scoped.db"), prefix); err == nil {
+			t.Errorf("NewScoped(%q) succeeded", prefix)
+		}
+	}
+}
+
+func TestNewScoped_Names(t *testing.T) {
+	sfs, err := NewScoped(filepath.Join(t.TempDir(), "scoped.db"), "tenant/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sfs.Close()
+	if err = sfs.MkdirAll("docs", 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := sfs.Create("docs/readme.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	if name := sfs.Name(); strings.Contains(name, "tenant") || strings.Contains(name, "scoped.db") {
+		t.Errorf("Name() = %q leaks the prefix or database path", name)
+	}
+	key := func(fi os.FileInfo) string { return fi.Sys().(*SysInfo).Key }
+
+	// 根目录的名称为 ".", key 为 ""
+	fi, err := sfs.Stat(".")
+	if err != nil || fi.Name() != "." || key(fi) != "" || !fi.IsDir() {
+		t.Fatalf("Stat(.) = %v %q, %v", fi, key(fi), err)
+	}
+	root, err := sfs.Open("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+	if fi, err = root.Stat(); err != nil || root.Name() != "." || fi.Name() != "." || key(fi) != "" {
+		t.Errorf("root handle Name = %q, Stat = %v %q, %v", root.Name(), fi, key(fi), err)
+	}
+	infos, err := root.Readdir(-1)
+	if err != nil || len(infos) != 1 || key(infos[0]) != "docs" {
+		t.Errorf("Readdir = %v, %v; want key docs", infos, err)
+	}
+
+	if fi, err = sfs.Stat("docs/readme.txt"); err != nil || fi.Name() != "readme.txt" || key(fi) != "docs/readme.txt" {
+		t.Errorf("Stat = %v %q, %v", fi, key(fi), err)
+	}
+	entries, err := sfs.ReadDir("docs")
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("ReadDir = %v, %v", entries, err)
+	}
+	if fi, err = entries[0].Info(); err != nil || key(fi) != "docs/readme.txt" {
+		t.Errorf("ReadDir entry key = %q, %v", key(fi), err)
+	}
+	h, err := sfs.Open("docs/readme.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	if fi, err = h.Stat(); err != nil || key(fi) != "docs/readme.txt" {
+		t.Errorf("handle Stat key = %q, %v", key(fi), err)
+	}
+}
+
+func TestNewScoped_Symlinks(t *testing.T) {
+	sfs, err := NewScoped(filepath.Join(t.TempDir(), "scoped.db"), "tenant/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sfs.Close()
+	fs := sfs.(*scopedFs).fs
+	if err = fs.WriteString("secret.txt", "top secret", 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = fs.WriteString("tenant/b/secret.txt", "other tenant", 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = sfs.MkdirAll("docs", 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := sfs.Create("docs/readme.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte("hi"))
+	_ = f.Close()
+	// 链接由不受前缀限制的文件系统创建, 目标写法与在前缀内创建时相同
+	links := map[string]string{
+		"tenant/a/abs":      "/docs/readme.txt",
+		"tenant/a/rel":      "docs/readme.txt",
+		"tenant/a/dir":      "/docs",
+		"tenant/a/root":     "/secret.txt",
+		"tenant/a/up":       "../b/secret.txt",
+		"tenant/a/docs/esc": "../../../secret.txt",
+	}
+	for link, target := range links {
+		if err = fs.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	read := func(name string) (string, error) {
+		f, err := sfs.Open(name)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		data, err := io.ReadAll(f)
+		return string(data), err
+	}
+	for _, name := range []string{"abs", "rel", "dir/readme.txt"} {
+		if got, err := read(name); err != nil || got != "hi" {
+			t.Errorf("read %s = %q, %v; want hi", name, got, err)
+		}
+	}
+	// 绝对路径的目标相对于前缀, 不会读到根目录下的文件
+	if _, err = read("root"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("read root = %v, want ErrFileNotFound", err)
+	}
+	for _, name := range []string{"up", "docs/esc"} {
+		if _, err = read(name); !errors.Is(err, ErrOutsideScope) {
+			t.Errorf("read %s = %v, want ErrOutsideScope", name, err)
+		}
+		if _, err = sfs.Stat(name); !errors.Is(err, ErrOutsideScope) {
+			t.Errorf("Stat(%s) = %v, want ErrOutsideScope", name, err)
+		}
+		if _, err = sfs.Create(name); !errors.Is(err, ErrOutsideScope) {
+			t.Errorf("Create(%s) = %v, want ErrOutsideScope", name, err)
+		}
+	}
+
+	// 通过链接写入时写到前缀内的目标
+	if f, err = sfs.Create("root"); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte("mine"))
+	_ = f.Close()
+	if got := readAll(t, fs, "tenant/a/secret.txt"); got != "mine" {
+		t.Errorf("tenant/a/secret.txt = %q, want mine", got)
+	}
+	if got := readAll(t, fs, "secret.txt"); got != "top secret" {
+		t.Errorf("secret.txt = %q, want it untouched", got)
+	}
+	if got := readAll(t, fs, "tenant/b/secret.txt"); got != "other tenant" {
+		t.Errorf("tenant/b/secret.txt = %q, want it untouched", got)
+	}
+	if err = sfs.Truncate("up", 0); !errors.Is(err, ErrOutsideScope) {
+		t.Errorf("Truncate(up) = %v, want ErrOutsideScope", err)
+	}
+
+	// 删除链接本身不跟随链接
+	if err = sfs.Remove("up"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = fs.Lstat("tenant/a/up"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("link still exists after Remove: %v", err)
+	}
+}
@@ -0,0 +1,264 @@
+package bboltfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// sharedFile 是同一路径所有共享句柄共用的内容, 最后一个句柄关闭时写入数据库
+type sharedFile struct {
+	mu    sync.Mutex
+	name  string
+	data  []byte
+	meta  fileMeta
+	refs  int
+	dirty bool
+
+	records []JournalRecord // 尚未写入数据库的修改的日志记录, 在 persist 的事务中写入
+}
+
+// sharedHandle 是 OpenShared 返回的句柄, 只保存自己的读写位置
+type sharedHandle struct {
+	fs     *BBolt
+	s      *sharedFile
+	mu     sync.Mutex
+	off    int64
+	closed bool
+}
+
+var _ File = (*sharedHandle)(nil)
+
+// OpenShared 打开文件 name (不存在时创建), 同一路径的所有共享句柄共用一份内存中的内容:
+// 通过一个句柄的写入立即对其他句柄可见, 每个句柄有独立的读写位置. 内容在调用 Sync
+// 或最后一个共享句柄关闭时写入数据库. 通过 Open 等普通句柄的写入不会反映到共享内容中
+func (fs *BBolt) OpenShared(name string) (File, error) {
+	// 跟随符号链接, 指向同一文件的路径共用一份内容
+	name, err := fs.resolve(fs.normalize(name), false)
+	if err != nil {
+		return nil, err
+	}
+	fs.sharedMu.Lock()
+	defer fs.sharedMu.Unlock()
+	s, ok := fs.shared[name]
+	if !ok {
+		data, meta, err := fs.loadFile(name)
+		if errors.Is(err, ErrFileNotFound) {
+			var f File
+			if f, err = fs.Create(name); err == nil {
+				_ = f.Close()
+				data, meta, err = fs.loadFile(name)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		s = &sharedFile{name: name, data: data, meta: meta}
+		if fs.shared == nil {
+			fs.shared = make(map[string]*sharedFile)
+		}
+		fs.shared[name] = s
+	}
+	s.refs++
+	return fs.track(&sharedHandle{fs: fs, s: s}), nil
+}
+
+// persist 将共享内容写入数据库, 调用方需持有 s.mu
+func (s *sharedFile) persist(fs *BBolt) error {
+	if !s.dirty {
+		return nil
+	}
+	if err := fs.saveFile(s.name, s.data, s.meta, s.records...); err != nil {
+		return err
+	}
+	s.dirty, s.records = false, nil
+	return nil
+}
+
+// writeAt 在共享内容的 off 处写入 p, 调用方需持有 s.mu
+func (s *sharedFile) writeAt(p []byte, off int64) {
+	if end := off + int64(len(p)); end > int64(len(s.data)) {
+		s.data = append(s.data, make([]byte, end-int64(len(s.data)))...)
+	}
+	copy(s.data[off:], p)
+	s.meta.Size = int64(len(s.data))
+	s.meta.ModTime = time.Now().UnixNano()
+	s.dirty = true
+}
+
+func (h *sharedHandle) Name() string { return h.s.name }
+
+func (h *sharedHandle) Read(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n, err := h.readAt(p, h.off)
+	h.off += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (h *sharedHandle) ReadAt(p []byte, off int64) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.readAt(p, off)
+}
+
+func (h *sharedHandle) readAt(p []byte, off int64) (int, error) {
+	if h.closed {
+		return 0, os.ErrClosed
+	}
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	h.s.mu.Lock()
+	defer h.s.mu.Unlock()
+	if off >= int64(len(h.s.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, h.s.data[off:])
+	h.fs.ioStats.add(h.s.name, n, 0)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (h *sharedHandle) Seek(offset int64, whence int) (int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return 0, os.ErrClosed
+	}
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = h.off + offset
+	case io.SeekEnd:
+		h.s.mu.Lock()
+		abs = int64(len(h.s.data)) + offset
+		h.s.mu.Unlock()
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("negative position")
+	}
+	h.off = abs
+	return abs, nil
+}
+
+func (h *sharedHandle) Write(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n, err := h.writeAt(p, h.off)
+	h.off += int64(n)
+	return n, err
+}
+
+func (h *sharedHandle) WriteAt(p []byte, off int64) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.writeAt(p, off)
+}
+
+func (h *sharedHandle) writeAt(p []byte, off int64) (int, error) {
+	if h.closed {
+		return 0, os.ErrClosed
+	}
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	h.s.mu.Lock()
+	h.s.writeAt(p, off)
+	h.s.records = h.fs.deferRecord(h.s.records, JournalRecord{Op: OpWrite, Path: h.s.name, Offset: off, Data: p, Size: h.s.meta.Size})
+	h.s.mu.Unlock()
+	h.fs.ioStats.add(h.s.name, 0, len(p))
+	return len(p), nil
+}
+
+func (h *sharedHandle) WriteString(s string) (int, error) {
+	return h.Write([]byte(s))
+}
+
+func (h *sharedHandle) Truncate(size int64) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return os.ErrClosed
+	}
+	if size < 0 {
+		return os.ErrInvalid
+	}
+	h.s.mu.Lock()
+	if size < int64(len(h.s.data)) {
+		h.s.data = h.s.data[:size]
+	} else {
+		h.s.data = append(h.s.data, make([]byte, size-int64(len(h.s.data)))...)
+	}
+	h.s.meta.Size = size
+	h.s.meta.ModTime = time.Now().UnixNano()
+	h.s.dirty = true
+	h.s.records = h.fs.deferRecord(h.s.records, JournalRecord{Op: OpTruncate, Path: h.s.name, Size: size})
+	h.s.mu.Unlock()
+	return nil
+}
+
+func (h *sharedHandle) Stat() (os.FileInfo, error) {
+	h.s.mu.Lock()
+	defer h.s.mu.Unlock()
+	return &fileInfo{
+		key:     h.s.name,
+		name:    filepath.Base(h.s.name),
+		size:    h.s.meta.Size,
+		mode:    h.s.meta.Mode,
+		modTime: time.Unix(0, h.s.meta.ModTime),
+		owner:   ownerOf(h.s.meta),
+	}, nil
+}
+
+func (h *sharedHandle) Sync() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return os.ErrClosed
+	}
+	h.s.mu.Lock()
+	defer h.s.mu.Unlock()
+	return h.s.persist(h.fs)
+}
+
+// Close 关闭句柄, 最后一个共享句柄关闭时将内容写入数据库. 写入失败时保留共享内容,
+// 之后再次 OpenShared 同一路径会得到尚未写入的内容, 关闭时重试写入
+func (h *sharedHandle) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil
+	}
+	h.closed = true
+	h.fs.untrack(h)
+	h.fs.sharedMu.Lock()
+	defer h.fs.sharedMu.Unlock()
+	h.s.mu.Lock()
+	defer h.s.mu.Unlock()
+	if h.s.refs--; h.s.refs > 0 {
+		return nil
+	}
+	// 写入成功后才移除登记: 持有 sharedMu 期间不会有新的共享句柄读到旧内容, 失败时未写入的修改也不会丢失
+	if err := h.s.persist(h.fs); err != nil {
+		return err
+	}
+	delete(h.fs.shared, h.s.name)
+	return nil
+}
+
+func (h *sharedHandle) Readdir(count int) ([]os.FileInfo, error) { return nil, ErrNotDirectory }
+func (h *sharedHandle) ReadDir(n int) ([]os.DirEntry, error)     { return nil, ErrNotDirectory }
+func (h *sharedHandle) Readdirnames(n int) ([]string, error)     { return nil, ErrNotDirectory }
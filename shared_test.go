@@ -0,0 +1,158 @@
+package bboltfs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+)
+
+func TestBBoltFs_OpenShared(t *testing.T) {
+	fs := newTestFs(t)
+	a, err := fs.OpenShared("shared.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := fs.OpenShared("shared.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = a.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if _, err = b.ReadAt(buf, 0); err != nil || string(buf) != "hello" {
+		t.Fatalf("ReadAt = %q, %v; want hello", buf, err)
+	}
+	// 每个句柄有独立的读写位置
+	if _, err = b.Write([]byte("HE")); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := io.ReadAll(io.NewSectionReader(a, 0, 5)); string(got) != "HEllo" {
+		t.Fatalf("content = %q, want HEllo", got)
+	}
+
+	if err = a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = b.WriteAt([]byte("!"), 5); err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := b.Stat(); fi.Size() != 6 {
+		t.Fatalf("Size = %d, want 6", fi.Size())
+	}
+	if err = b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, fs, "shared.txt"); string(got) != "HEllo!" {
+		t.Fatalf("persisted = %q, want HEllo!", got)
+	}
+	if n := len(fs.shared); n != 0 {
+		t.Fatalf("%d shared entries left after close", n)
+	}
+}
+
+func TestBBoltFs_OpenShared_Concurrent(t *testing.T) {
+	fs := newTestFs(t)
+	w, err := fs.OpenShared("log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := fs.OpenShared("log")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 100
+	var wg sync.WaitGroup
+	written := make(chan int64)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		defer close(written)
+		for i := 0; i < n; i++ {
+			line := fmt.Sprintf("%03d\n", i)
+			if _, err := w.Write([]byte(line)); err != nil {
+				t.Error(err)
+				return
+			}
+			written <- int64(i+1) * 4
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for end := range written {
+			line := make([]byte, 4)
+			if _, err := r.ReadAt(line, end-4); err != nil {
+				t.Error(err)
+				return
+			}
+			if want := fmt.Sprintf("%03d\n", end/4-1); string(line) != want {
+				t.Errorf("read %q at %d, want %q", line, end-4, want)
+			}
+		}
+	}()
+	wg.Wait()
+
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&want, "%03d\n", i)
+	}
+	if got := readAll(t, fs, "log"); got != want.String() {
+		t.Fatalf("persisted %d bytes, want %d", len(got), want.Len())
+	}
+}
+
+func TestBBoltFs_OpenShared_PersistError(t *testing.T) {
+	fs := newTestFs(t)
+	a, err := fs.OpenShared("shared.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = a.Write([]byte("unsaved")); err != nil {
+		t.Fatal(err)
+	}
+	// 同名目录使写入失败
+	if err = fs.Remove("shared.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err = fs.Mkdir("shared.txt", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.Close(); err == nil {
+		t.Fatal("Close succeeded although persist should fail")
+	}
+	if _, ok := fs.shared["shared.txt"]; !ok {
+		t.Fatal("shared entry removed after a failed persist")
+	}
+
+	// 重新打开得到尚未写入的内容, 关闭时重试写入
+	if err = fs.Remove("shared.txt"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := fs.OpenShared("shared.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 7)
+	if _, err = b.ReadAt(buf, 0); err != nil || string(buf) != "unsaved" {
+		t.Fatalf("ReadAt = %q, %v; want unsaved", buf, err)
+	}
+	if err = b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, fs, "shared.txt"); got != "unsaved" {
+		t.Fatalf("persisted = %q, want unsaved", got)
+	}
+	if n := len(fs.shared); n != 0 {
+		t.Fatalf("%d shared entries left after close", n)
+	}
+}
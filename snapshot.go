@@ -0,0 +1,45 @@
+package bboltfs
+
+import (
+	"errors"
+	"os"
+
+	"go.etcd.io/bbolt"
+)
+
+var ErrSnapshotTooLarge = errors.New("bboltfs: snapshot exceeds size limit")
+
+// Snapshot 在一个读事务中返回所有文件 (不含目录和符号链接) 路径到内容的映射, 便于在测试中整体比较
+func (fs *BBolt) Snapshot() (map[string][]byte, error) {
+	return fs.SnapshotLimit(0)
+}
+
+// SnapshotLimit 与 Snapshot 相同, 但文件内容总大小超过 limit 字节时返回 ErrSnapshotTooLarge.
+// limit <= 0 表示不限制
+func (fs *BBolt) SnapshotLimit(limit int64) (map[string][]byte, error) {
+	snap := make(map[string][]byte)
+	var total int64
+	err := fs.view(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(bucketFiles)).ForEach(func(k, v []byte) error {
+			meta := fs.decodeMeta(v)
+			if meta.Mode&os.ModeSymlink != 0 {
+				return nil
+			}
+			total += meta.Size
+			if limit > 0 && total > limit {
+				return ErrSnapshotTooLarge
+			}
+			_, data, err := fs.fileContent(tx, v)
+			if err != nil {
+				return err
+			}
+			// bbolt 返回的内存只在事务内有效, 需要复制
+			snap[string(k)] = append([]byte{}, data...)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
@@ -0,0 +1,49 @@
+package bboltfs
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBBoltFs_Snapshot(t *testing.T) {
+	fs := newTestFs(t)
+
+	_ = fs.MkdirAll("a/b", 0755)
+	want := map[string]string{
+		"root.txt":  "root",
+		"a/one.txt": "one",
+		"a/b/two":   "two!",
+		"a/empty":   "",
+	}
+	for name, content := range want {
+		f, err := fs.CreateWith(name, []byte(content), 0644)
+		if err != nil {
+			t.Fatalf("CreateWith %s: %v", name, err)
+		}
+		f.Close()
+	}
+
+	snap, err := fs.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	if len(snap) != len(want) {
+		t.Errorf("Snapshot has %d entries, want %d: %v", len(snap), len(want), snap)
+	}
+	for name, content := range want {
+		got, ok := snap[name]
+		if !ok || string(got) != content {
+			t.Errorf("snap[%q] = %q, %v, want %q", name, got, ok, content)
+		}
+	}
+	if _, ok := snap["a/b"]; ok {
+		t.Errorf("Snapshot should not contain directories")
+	}
+
+	if _, err := fs.SnapshotLimit(5); !errors.Is(err, ErrSnapshotTooLarge) {
+		t.Errorf("SnapshotLimit(5) = %v, want ErrSnapshotTooLarge", err)
+	}
+	if _, err := fs.SnapshotLimit(11); err != nil {
+		t.Errorf("SnapshotLimit(11) = %v, want nil", err)
+	}
+}
@@ -0,0 +1,108 @@
+package bboltfs
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"go.etcd.io/bbolt"
+)
+
+// Hole 是文件中没有存储数据的区间, 读取时为 0
+type Hole struct {
+	Off int64
+	Len int64
+}
+
+// Holes 返回文件 name 中所有空洞, 按位置排列. 空洞由缺失或不足一块的分块推导, 内联存储的文件没有空洞
+func (fs *BBolt) Holes(name string) ([]Hole, error) {
+	name = fs.normalize(name)
+	var holes []Hole
+	err := fs.view(func(tx *bbolt.Tx) error {
+		val := tx.Bucket([]byte(bucketFiles)).Get([]byte(name))
+		if val == nil {
+			if tx.Bucket([]byte(bucketDirs)).Get([]byte(name)) != nil {
+				return ErrIsDirectory
+			}
+			return ErrFileNotFound
+		}
+		meta, _ := fs.splitMeta(val)
+		if meta.Storage != storageChunked {
+			return nil
+		}
+		var pos int64 // 已存储数据的末尾
+		add := func(end int64) {
+			if end > meta.Size {
+				end = meta.Size
+			}
+			if end > pos {
+				holes = append(holes, Hole{Off: pos, Len: end - pos})
+			}
+		}
+		cs := int64(meta.ChunkSize)
+		c := tx.Bucket([]byte(bucketChunks)).Cursor()
+		prefix := chunkKey(meta.Ino, 0)[:8]
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			start := int64(binary.BigEndian.Uint64(k[8:])) * cs
+			add(start)
+			pos = start + int64(len(v))
+		}
+		add(meta.Size)
+		return nil
+	})
+	return holes, err
+}
+
+// truncateTx 在事务 tx 中将文件 name 的大小改为 size. 分块存储的文件只删除或截短末尾的分块,
+// 扩展的部分作为空洞不写入数据; 内联文件扩展到内联阈值以上时先转换为分块存储, 缩小到阈值以下的文件改为内联存储
+func (fs *BBolt) truncateTx(tx *bbolt.Tx, name string, size, modTime int64) error {
+	b := tx.Bucket([]byte(bucketFiles))
+	val := b.Get([]byte(name))
+	if val == nil {
+		return ErrFileNotFound
+	}
+	meta, inline := fs.splitMeta(val)
+	old := meta
+	meta.Size, meta.ModTime = size, modTime
+	var err error
+	if meta.Version, err = b.NextSequence(); err != nil {
+		return err
+	}
+	chunks := tx.Bucket([]byte(bucketChunks))
+	switch {
+	case fs.inlineThreshold <= 0 || size < int64(fs.inlineThreshold):
+		data := make([]byte, size)
+		fs.readAt(tx, old, inline, data, 0)
+		enc, err := fs.encodeFile(tx, &old, meta, data)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(name), enc)
+	case meta.Storage != storageChunked:
+		// 原有内容按分块写入, 扩展的部分留作空洞
+		meta.Storage, meta.ChunkSize = storageChunked, uint32(fs.chunkSize)
+		if meta.Ino, err = chunks.NextSequence(); err != nil {
+			return err
+		}
+		if int64(len(inline)) > size {
+			inline = inline[:size]
+		}
+		if _, err = putChunks(chunks, meta, inline); err != nil {
+			return err
+		}
+	case size < old.Size:
+		cs := int64(meta.ChunkSize)
+		if err = fs.deleteChunks(tx, meta, (size+cs-1)/cs); err != nil {
+			return err
+		}
+		// 截短最后一个分块, 之后再扩展时不会读到原来的内容
+		key := chunkKey(meta.Ino, size/cs)
+		if in := size % cs; in > 0 {
+			if chunk := chunks.Get(key); int64(len(chunk)) > in {
+				if err = chunks.Put(key, append([]byte(nil), chunk[:in]...)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return b.Put([]byte(name), fs.encodeMeta(meta))
+}
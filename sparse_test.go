@@ -0,0 +1,255 @@
+package bboltfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestBBoltFs_SparseTruncate(t *testing.T) {
+	fs := newTestFs(t, WithInlineThreshold(16))
+	f, err := fs.CreateWith("sparse.bin", []byte("head"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	const size = 1 << 30
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if err = fs.Truncate("sparse.bin", size); err != nil {
+		t.Fatal(err)
+	}
+	sr, err := fs.NewSectionReader("sparse.bin", 0, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 8)
+	if _, err = sr.ReadAt(buf, 0); err != nil || string(buf) != "head\x00\x00\x00\x00" {
+		t.Fatalf("ReadAt(0) = %q, %v", buf, err)
+	}
+	big := make([]byte, 1<<20)
+	if _, err = sr.ReadAt(big, size/2); err != nil || !isZero(big) {
+		t.Fatalf("ReadAt(hole) = %v, zero %v", err, isZero(big))
+	}
+	if n, err := sr.ReadAt(buf, size-4); n != 4 || !isZero(buf[:4]) {
+		t.Fatalf("ReadAt(end) = %d, %v", n, err)
+	}
+	runtime.ReadMemStats(&after)
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 16<<20 {
+		t.Errorf("allocated %d bytes reading a sparse file", alloc)
+	}
+
+	if fi, _ := fs.Stat("sparse.bin"); fi.Size() != size {
+		t.Errorf("Size = %d, want %d", fi.Size(), size)
+	}
+	if disk, _ := fs.DiskSize("sparse.bin"); disk != 4 {
+		t.Errorf("DiskSize = %d, want 4", disk)
+	}
+	holes, err := fs.Holes("sparse.bin")
+	if err != nil || !reflect.DeepEqual(holes, []Hole{{Off: 4, Len: size - 4}}) {
+		t.Errorf("Holes = %v, %v", holes, err)
+	}
+
+	// 缩小后再扩展, 原来的内容不再可见
+	if err = fs.Truncate("sparse.bin", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err = fs.Truncate("sparse.bin", 32); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, fs, "sparse.bin"); got != "he"+string(bytes.Repeat([]byte{0}, 30)) {
+		t.Errorf("content = %q", got)
+	}
+}
+
+func TestBBoltFs_SparseOpenRead(t *testing.T) {
+	fs := newTestFs(t, WithInlineThreshold(16))
+	if err := fs.WriteString("sparse.bin", "head", 0644); err != nil {
+		t.Fatal(err)
+	}
+	const size = 1 << 30
+	if err := fs.Truncate("sparse.bin", size); err != nil {
+		t.Fatal(err)
+	}
+
+	// 通过 Open 得到的句柄读取时同样只访问涉及的分块
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	f, err := fs.Open("sparse.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	buf := make([]byte, 8)
+	if _, err = f.ReadAt(buf, 0); err != nil || string(buf) != "head\x00\x00\x00\x00" {
+		t.Fatalf("ReadAt(0) = %q, %v", buf, err)
+	}
+	big := make([]byte, 1<<20)
+	if _, err = f.ReadAt(big, size/2); err != nil || !isZero(big) {
+		t.Fatalf("ReadAt(hole) = %v, zero %v", err, isZero(big))
+	}
+	if n, err := f.ReadAt(buf, size-4); n != 4 || err != io.EOF || !isZero(buf[:4]) {
+		t.Fatalf("ReadAt(end) = %d, %v", n, err)
+	}
+	if _, err = f.Seek(2, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := f.Read(buf); n != 8 || err != nil || string(buf) != "ad\x00\x00\x00\x00\x00\x00" {
+		t.Fatalf("Read = %d %q, %v", n, buf, err)
+	}
+	if _, err = f.Seek(-3, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := f.Read(buf); n != 3 || err != nil {
+		t.Fatalf("Read(end) = %d, %v", n, err)
+	}
+	if _, err = f.Read(buf); err != io.EOF {
+		t.Fatalf("Read past end = %v, want EOF", err)
+	}
+	runtime.ReadMemStats(&after)
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 16<<20 {
+		t.Errorf("allocated %d bytes reading a sparse file through Open", alloc)
+	}
+
+	// 可写句柄改写一小段时也不载入整个文件
+	runtime.ReadMemStats(&before)
+	w, err := fs.OpenFile("sparse.bin", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.WriteAt([]byte("mid"), size/2); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	runtime.ReadMemStats(&after)
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 16<<20 {
+		t.Errorf("allocated %d bytes writing into a sparse file", alloc)
+	}
+	if _, err = f.ReadAt(buf[:3], size/2); err != nil || string(buf[:3]) != "mid" {
+		t.Errorf("ReadAt(mid) = %q, %v", buf[:3], err)
+	}
+	if fi, _ := fs.Stat("sparse.bin"); fi.Size() != size {
+		t.Errorf("Size = %d, want %d", fi.Size(), size)
+	}
+}
+
+func TestBBoltFile_TruncateSparse(t *testing.T) {
+	fs := newTestFs(t, WithInlineThreshold(16))
+	if err := fs.WriteString("sparse.bin", "head", 0644); err != nil {
+		t.Fatal(err)
+	}
+	const size = 1 << 30
+	if err := fs.Truncate("sparse.bin", size); err != nil {
+		t.Fatal(err)
+	}
+
+	// O_TRUNC 和句柄上的 Truncate 都按分块截断, 不载入整个文件
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	f, err := fs.OpenFile("sparse.bin", os.O_RDWR|os.O_TRUNC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := f.Stat(); fi.Size() != 0 {
+		t.Errorf("Size after O_TRUNC = %d", fi.Size())
+	}
+	if _, err = f.Write([]byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Truncate(size / 2); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if n, err := f.ReadAt(buf, 0); n != 4 || err != nil || string(buf) != "new\x00" {
+		t.Errorf("ReadAt(0) = %q, %v", buf[:n], err)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	runtime.ReadMemStats(&after)
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 16<<20 {
+		t.Errorf("allocated %d bytes truncating a sparse file", alloc)
+	}
+	if fi, _ := fs.Stat("sparse.bin"); fi.Size() != size/2 {
+		t.Errorf("Size = %d, want %d", fi.Size(), size/2)
+	}
+	if disk, _ := fs.DiskSize("sparse.bin"); disk != 3 {
+		t.Errorf("DiskSize = %d, want 3", disk)
+	}
+}
+
+func TestBBoltFile_TruncateNegative(t *testing.T) {
+	fs := newTestFs(t)
+	f, err := fs.CreateWith("a.txt", []byte("abc"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var pe *os.PathError
+	if err = f.Truncate(-1); !errors.As(err, &pe) || !errors.Is(err, os.ErrInvalid) {
+		t.Errorf("Truncate(-1) = %v, want PathError with ErrInvalid", err)
+	}
+	if got := readAll(t, fs, "a.txt"); got != "abc" {
+		t.Errorf("content = %q", got)
+	}
+}
+
+func TestBBoltFile_WriteAtSparseBuffered(t *testing.T) {
+	fs := newTestFs(t, WithInlineThreshold(16), WithWriteBuffer(1<<20))
+	if err := fs.WriteString("sparse.bin", "head", 0644); err != nil {
+		t.Fatal(err)
+	}
+	const size = 1 << 30
+	if err := fs.Truncate("sparse.bin", size); err != nil {
+		t.Fatal(err)
+	}
+
+	// 开启写缓冲时 WriteAt 同样只改写涉及的分块
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	f, err := fs.OpenFile("sparse.bin", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.Write([]byte("HE")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.WriteAt([]byte("mid"), size/2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.WriteAt([]byte("end"), size-3); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	runtime.ReadMemStats(&after)
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 16<<20 {
+		t.Errorf("allocated %d bytes patching a sparse file", alloc)
+	}
+
+	r, err := fs.Open("sparse.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for off, want := range map[int64]string{0: "HEad", size / 2: "mid", size - 3: "end"} {
+		buf := make([]byte, len(want))
+		if n, err := r.ReadAt(buf, off); n != len(want) || (err != nil && !errors.Is(err, io.EOF)) || string(buf) != want {
+			t.Errorf("ReadAt(%d) = %q, %v, want %q", off, buf[:n], err, want)
+		}
+	}
+	if fi, _ := fs.Stat("sparse.bin"); fi.Size() != size {
+		t.Errorf("Size = %d, want %d", fi.Size(), size)
+	}
+}
@@ -0,0 +1,104 @@
+package bboltfs
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// ExtensionStats 扫描一次文件元数据, 返回每种扩展名的文件数量和总大小.
+// 没有扩展名的文件归入 "" 分组, 符号链接不计入
+func (fs *BBolt) ExtensionStats() (map[string]int, map[string]int64, error) {
+	counts := make(map[string]int)
+	sizes := make(map[string]int64)
+	err := fs.view(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(bucketFiles)).ForEach(func(k, v []byte) error {
+			meta := fs.decodeMeta(v)
+			if meta.Mode&os.ModeSymlink != 0 {
+				return nil
+			}
+			ext := path.Ext(string(k))
+			counts[ext]++
+			sizes[ext] += meta.Size
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return counts, sizes, nil
+}
+
+// FilesBySize 扫描一次文件元数据, 返回大小在 [min, max] 范围内的文件 (不含符号链接), 按路径排列, 不读取文件内容.
+// FileInfo 的 Name 只是文件名, 完整路径可从 Sys().(*SysInfo).Key 获得
+func (fs *BBolt) FilesBySize(min, max int64) ([]os.FileInfo, error) {
+	var infos []os.FileInfo
+	err := fs.view(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(bucketFiles)).ForEach(func(k, v []byte) error {
+			meta := fs.decodeMeta(v)
+			if meta.Mode&os.ModeSymlink != 0 || meta.Size < min || meta.Size > max {
+				return nil
+			}
+			name := string(k)
+			infos = append(infos, &fileInfo{
+				key:     name,
+				name:    fs.displayName(tx, name, filepath.Base(name)),
+				size:    meta.Size,
+				mode:    meta.Mode,
+				modTime: time.Unix(0, meta.ModTime),
+				nlink:   1,
+				storage: storageOf(meta),
+				owner:   ownerOf(meta),
+			})
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return infos, nil
+}
+
+// fragCompactRatio 空闲页占比达到该值时建议压缩
+const fragCompactRatio = 0.5
+
+// FragReport 描述数据库文件的碎片情况
+type FragReport struct {
+	PageSize      int     // 页大小
+	TotalPages    int     // 数据库文件总页数
+	FreePages     int     // 空闲页数
+	PendingPages  int     // 等待释放的页数
+	BranchPages   int     // bucket 使用的分支页数
+	LeafPages     int     // bucket 使用的叶子页数 (含溢出页)
+	Ratio         float64 // (空闲页+等待释放页) / 总页数
+	ShouldCompact bool    // 是否建议压缩
+}
+
+// FragmentationReport 根据 bbolt 的页统计计算碎片率, 并给出是否需要压缩的建议
+func (fs *BBolt) FragmentationReport() (FragReport, error) {
+	var r FragReport
+	err := fs.view(func(tx *bbolt.Tx) error {
+		r.PageSize = tx.DB().Info().PageSize
+		r.TotalPages = int(tx.Size() / int64(r.PageSize))
+		st := tx.DB().Stats()
+		r.FreePages = st.FreePageN
+		r.PendingPages = st.PendingPageN
+		return tx.ForEach(func(_ []byte, b *bbolt.Bucket) error {
+			st := b.Stats()
+			r.BranchPages += st.BranchPageN
+			r.LeafPages += st.LeafPageN + st.LeafOverflowN
+			return nil
+		})
+	})
+	if err != nil {
+		return r, err
+	}
+	if r.TotalPages > 0 {
+		r.Ratio = float64(r.FreePages+r.PendingPages) / float64(r.TotalPages)
+	}
+	r.ShouldCompact = r.Ratio >= fragCompactRatio
+	return r, nil
+}
@@ -0,0 +1,122 @@
+package bboltfs
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestBBoltFs_ExtensionStats(t *testing.T) {
+	fs := newTestFs(t)
+
+	files := map[string]string{
+		"a.txt":        "abc",
+		"dir/b.txt":    "hello",
+		"main.go":      "go",
+		"Makefile":     "all:",
+		"dir/.hidden":  "x",
+		"dir/arch.tar": "",
+	}
+	for name, content := range files {
+		f, err := fs.CreateWith(name, []byte(content), 0644)
+		if err != nil {
+			t.Fatalf("CreateWith %s: %v", name, err)
+		}
+		f.Close()
+	}
+
+	counts, sizes, err := fs.ExtensionStats()
+	if err != nil {
+		t.Fatalf("ExtensionStats: %v", err)
+	}
+	wantCounts := map[string]int{".txt": 2, ".go": 1, "": 1, ".hidden": 1, ".tar": 1}
+	wantSizes := map[string]int64{".txt": 8, ".go": 2, "": 4, ".hidden": 1, ".tar": 0}
+	if len(counts) != len(wantCounts) {
+		t.Errorf("counts = %v, want %v", counts, wantCounts)
+	}
+	for ext, want := range wantCounts {
+		if counts[ext] != want {
+			t.Errorf("counts[%q] = %d, want %d", ext, counts[ext], want)
+		}
+		if sizes[ext] != wantSizes[ext] {
+			t.Errorf("sizes[%q] = %d, want %d", ext, sizes[ext], wantSizes[ext])
+		}
+	}
+}
+
+func TestBBoltFs_FilesBySize(t *testing.T) {
+	fs := newTestFs(t)
+	for name, size := range map[string]int{"empty": 0, "dir/tiny": 3, "dir/mid": 100, "large": 4096} {
+		f, err := fs.CreateWith(name, make([]byte, size), 0644)
+		if err != nil {
+			t.Fatalf("CreateWith %s: %v", name, err)
+		}
+		f.Close()
+	}
+	_ = fs.Mkdir("emptydir", 0755)
+
+	for _, tc := range []struct {
+		min, max int64
+		want     []string
+	}{
+		{0, 0, []string{"empty"}},
+		{1, 100, []string{"dir/mid", "dir/tiny"}},
+		{1000, 1 << 40, []string{"large"}},
+		{5000, 6000, nil},
+	} {
+		infos, err := fs.FilesBySize(tc.min, tc.max)
+		if err != nil {
+			t.Fatalf("FilesBySize(%d, %d): %v", tc.min, tc.max, err)
+		}
+		var got []string
+		for _, fi := range infos {
+			if fi.IsDir() || fi.Size() < tc.min || fi.Size() > tc.max {
+				t.Errorf("unexpected entry %s (size %d)", fi.Name(), fi.Size())
+			}
+			got = append(got, fi.Sys().(*SysInfo).Key)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("FilesBySize(%d, %d) = %v, want %v", tc.min, tc.max, got, tc.want)
+		}
+	}
+}
+
+func TestBBoltFs_FragmentationReport(t *testing.T) {
+	fs := newTestFs(t)
+
+	content := make([]byte, 4096)
+	err := fs.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucketFiles))
+		for i := 0; i < 2000; i++ {
+			val := append(fs.encodeMeta(fileMeta{Mode: 0644, Size: int64(len(content))}), content...)
+			if err := b.Put([]byte(fmt.Sprintf("big/f%05d", i)), val); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("populate: %v", err)
+	}
+
+	r, err := fs.FragmentationReport()
+	if err != nil {
+		t.Fatalf("FragmentationReport: %v", err)
+	}
+	if r.ShouldCompact || r.LeafPages == 0 {
+		t.Errorf("populated report = %+v, want in-use pages and no compaction", r)
+	}
+
+	if err := fs.RemoveAll("big"); err != nil {
+		t.Fatalf("RemoveAll: %v", err)
+	}
+	r, err = fs.FragmentationReport()
+	if err != nil {
+		t.Fatalf("FragmentationReport: %v", err)
+	}
+	if !r.ShouldCompact || r.Ratio < fragCompactRatio {
+		t.Errorf("report after delete = %+v, want compaction recommended", r)
+	}
+}
@@ -0,0 +1,79 @@
+package bboltfs
+
+import (
+	"bytes"
+	"sort"
+
+	"go.etcd.io/bbolt"
+)
+
+// subtreeEntry 是 SubtreeEqual 比较的一项, inline 只在读事务中有效
+type subtreeEntry struct {
+	meta   fileMeta
+	inline []byte
+}
+
+// SubtreeEqual 在一个读事务中比较 rootA 和 rootB 两棵子树, 返回它们是否相同以及不同之处的相对路径
+// (按字典序, 根自身为 "."). 比较结构、权限和文件内容, 大小相同的文件才逐块比较内容, 不比较修改时间.
+// root 也可以是文件, 此时比较两个文件本身
+func (fs *BBolt) SubtreeEqual(rootA, rootB string) (bool, []string, error) {
+	rootA, rootB = fs.normalize(rootA), fs.normalize(rootB)
+	var diffs []string
+	err := fs.view(func(tx *bbolt.Tx) error {
+		a, err := fs.subtree(tx, rootA)
+		if err != nil {
+			return err
+		}
+		b, err := fs.subtree(tx, rootB)
+		if err != nil {
+			return err
+		}
+		for rel, ea := range a {
+			eb, ok := b[rel]
+			if !ok || ea.meta.Mode != eb.meta.Mode || ea.meta.IsDir != eb.meta.IsDir ||
+				!ea.meta.IsDir && !fs.sameContent(tx, ea.meta, ea.inline, eb.meta, eb.inline) {
+				diffs = append(diffs, rel)
+			}
+		}
+		for rel := range b {
+			if _, ok := a[rel]; !ok {
+				diffs = append(diffs, rel)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, nil, err
+	}
+	sort.Strings(diffs)
+	return len(diffs) == 0, diffs, nil
+}
+
+// subtree 返回 root 及其下所有文件和目录, key 为相对于 root 的路径
+func (fs *BBolt) subtree(tx *bbolt.Tx, root string) (map[string]subtreeEntry, error) {
+	entries := make(map[string]subtreeEntry)
+	if val := tx.Bucket([]byte(bucketFiles)).Get([]byte(root)); val != nil {
+		meta, inline := fs.splitMeta(val)
+		entries["."] = subtreeEntry{meta, inline}
+		return entries, nil
+	}
+	prefix := []byte(root + "/")
+	if root == "" {
+		prefix = nil
+	} else if val := tx.Bucket([]byte(bucketDirs)).Get([]byte(root)); val != nil {
+		entries["."] = subtreeEntry{meta: fs.decodeMeta(val)}
+	} else if !fs.flat {
+		return nil, ErrFileNotFound
+	}
+	for _, bucket := range []string{bucketFiles, bucketDirs} {
+		c := tx.Bucket([]byte(bucket)).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			meta, inline := fs.splitMeta(v)
+			entries[string(k[len(prefix):])] = subtreeEntry{meta, inline}
+		}
+	}
+	if len(entries) == 0 && root != "" {
+		return nil, ErrFileNotFound
+	}
+	return entries, nil
+}
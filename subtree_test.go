@@ -0,0 +1,54 @@
+package bboltfs
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestBBoltFs_SubtreeEqual(t *testing.T) {
+	fs := newTestFs(t, WithInlineThreshold(16))
+	fs.chunkSize = 8
+	for _, root := range []string{"a", "b"} {
+		_ = fs.MkdirAll(root+"/sub", 0755)
+		for name, content := range map[string]string{
+			"/x.txt":     "x",
+			"/sub/y.bin": "0123456789abcdefghij", // 分块存储
+		} {
+			f, _ := fs.CreateWith(root+name, []byte(content), 0644)
+			f.Close()
+		}
+	}
+
+	equal, diffs, err := fs.SubtreeEqual("a", "b")
+	if err != nil || !equal || len(diffs) != 0 {
+		t.Fatalf("SubtreeEqual = %v, %v, %v; want equal", equal, diffs, err)
+	}
+
+	// 大小相同、内容不同
+	f, _ := fs.CreateWith("b/sub/y.bin", []byte("0123456789abcdefghiJ"), 0644)
+	f.Close()
+	equal, diffs, err = fs.SubtreeEqual("a", "b")
+	if err != nil || equal || !reflect.DeepEqual(diffs, []string{"sub/y.bin"}) {
+		t.Errorf("after content change = %v, %v, %v", equal, diffs, err)
+	}
+
+	// 权限不同、多出的文件和缺少的目录
+	f, _ = fs.CreateWith("b/sub/y.bin", []byte("0123456789abcdefghij"), 0644)
+	f.Close()
+	_ = fs.Chmod("b/x.txt", 0600)
+	f, _ = fs.CreateWith("b/extra", nil, 0644)
+	f.Close()
+	_ = fs.Mkdir("a/only", 0755)
+	_, diffs, _ = fs.SubtreeEqual("a", "b")
+	if want := []string{"extra", "only", "x.txt"}; !reflect.DeepEqual(diffs, want) {
+		t.Errorf("diffs = %v, want %v", diffs, want)
+	}
+
+	if equal, _, err = fs.SubtreeEqual("a/x.txt", "b/x.txt"); err != nil || equal {
+		t.Errorf("SubtreeEqual(files) = %v, %v", equal, err)
+	}
+	if _, _, err = fs.SubtreeEqual("a", "missing"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("SubtreeEqual(missing) = %v, want ErrFileNotFound", err)
+	}
+}
@@ -0,0 +1,214 @@
+package bboltfs
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// O_NOFOLLOW 可传给 OpenFile, 行为同 Linux 的 O_NOFOLLOW: 最后一个路径分量是符号链接时
+// 返回 ErrSymlinkLoop, 中间的符号链接仍然解析. 取值避开了 os 包的所有打开标志
+const O_NOFOLLOW = 1 << 29
+
+// maxSymlinks 是解析一个路径时最多跟随的符号链接数, 与 Linux 相同
+const maxSymlinks = 40
+
+// ErrSymlinkLoop 表示符号链接过多 (可能成环), 或 O_NOFOLLOW 打开了符号链接
+var ErrSymlinkLoop error = syscall.ELOOP
+
+// Symlinker 由支持符号链接的文件系统实现
+type Symlinker interface {
+	Symlink(oldname, newname string) error
+	Readlink(name string) (string, error)
+}
+
+var _ Symlinker = (*BBolt)(nil)
+
+// Symlink 创建指向 oldname 的符号链接 newname. 符号链接保存为内容是目标路径的文件,
+// 相对路径的目标相对于链接所在的目录解析
+func (fs *BBolt) Symlink(oldname, newname string) error {
+	raw := newname
+	newname = fs.normalize(newname)
+	meta := fileMeta{Mode: os.ModeSymlink | 0777, Size: int64(len(oldname)), ModTime: time.Now().UnixNano()}
+	return fs.update(func(tx *bbolt.Tx) error {
+		if exists(tx, newname) {
+			return ErrFileExists
+		}
+		if err := fs.putFileTx(tx, newname, []byte(oldname), meta, true); err != nil {
+			return err
+		}
+		if err := fs.keepCaseTx(tx, newname, raw); err != nil {
+			return err
+		}
+		return fs.recordTx(tx, JournalRecord{Op: OpSymlink, Path: newname, Target: oldname})
+	})
+}
+
+// Readlink 返回符号链接 name 的目标, name 不是符号链接时返回 os.ErrInvalid
+func (fs *BBolt) Readlink(name string) (string, error) {
+	name = fs.normalize(name)
+	var target string
+	err := fs.view(func(tx *bbolt.Tx) error {
+		val := tx.Bucket([]byte(bucketFiles)).Get([]byte(name))
+		if val == nil {
+			if tx.Bucket([]byte(bucketDirs)).Get([]byte(name)) != nil {
+				return os.ErrInvalid
+			}
+			return ErrFileNotFound
+		}
+		var ok bool
+		target, ok = fs.linkTarget(val)
+		if !ok {
+			return os.ErrInvalid
+		}
+		return nil
+	})
+	return target, err
+}
+
+// linkTarget 返回 files bucket 中的 value 是否为符号链接及其目标
+func (fs *BBolt) linkTarget(val []byte) (string, bool) {
+	meta, inline := fs.splitMeta(val)
+	if meta.Mode&os.ModeSymlink == 0 {
+		return "", false
+	}
+	return string(inline), true
+}
+
+// Lstat 返回 name 的元信息, 路径中间的符号链接会被解析, 最后一个分量是符号链接时返回链接本身的信息
+func (fs *BBolt) Lstat(name string) (os.FileInfo, error) {
+	name = fs.normalize(name)
+	var fi *fileInfo
+	err := fs.view(func(tx *bbolt.Tx) error {
+		key, err := fs.resolveTx(tx, name, false)
+		if err != nil {
+			return err
+		}
+		fi, err = fs.statTx(tx, key)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fi, nil
+}
+
+// writeTargetTx 跟随 name 中的所有符号链接, 返回修改文件内容时实际写入的 key. 链接被解析时
+// 用于记录原始大小写的 raw 也换成目标路径
+func (fs *BBolt) writeTargetTx(tx *bbolt.Tx, name, raw string) (string, string, error) {
+	key, err := fs.resolveTx(tx, name, true)
+	if err != nil || key == name {
+		return key, raw, err
+	}
+	return key, key, nil
+}
+
+// statFollowTx 与 os.Stat 一样跟随 name 中的所有符号链接, 返回最终目标的元信息, 名称仍为 name 的最后一个分量
+func (fs *BBolt) statFollowTx(tx *bbolt.Tx, name string) (*fileInfo, error) {
+	key, err := fs.resolveTx(tx, name, true)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := fs.statTx(tx, key)
+	if err != nil || key == name {
+		return fi, err
+	}
+	fi.name = fs.displayName(tx, name, filepath.Base(name))
+	return fi, nil
+}
+
+// IsSymlink 报告 name 的最后一个分量是否为符号链接, 不跟随该链接
+func (fs *BBolt) IsSymlink(name string) (bool, error) {
+	fi, err := fs.Lstat(name)
+	if err != nil {
+		return false, err
+	}
+	return fi.Mode()&os.ModeSymlink != 0, nil
+}
+
+// resolveTx 在事务 tx 中解析 name 路径中的符号链接, 返回最终的 key. follow 为 false 时
+// 不解析最后一个路径分量. 没有符号链接时原样返回 name
+func (fs *BBolt) resolveTx(tx *bbolt.Tx, name string, follow bool) (string, error) {
+	return fs.resolveUnderTx(tx, "", name, follow)
+}
+
+// resolveUnderTx 与 resolveTx 相同, 但 name 和链接的目标都相对于目录 root: 绝对路径的目标从 root 开始解析,
+// 跳出 root 的目标返回 ErrOutsideScope. 返回的 key 包含 root, root 为 "" 时即 resolveTx
+func (fs *BBolt) resolveUnderTx(tx *bbolt.Tx, root, name string, follow bool) (string, error) {
+	key := func(rel string) string {
+		if root == "" {
+			return rel
+		}
+		if rel == "" {
+			return root
+		}
+		return root + "/" + rel
+	}
+	if name == "" {
+		return key(name), nil
+	}
+	files := tx.Bucket([]byte(bucketFiles))
+	parts := strings.Split(name, "/")
+	resolved, hops := "", 0
+	for i := 0; i < len(parts); i++ {
+		cur := parts[i]
+		if i > 0 {
+			cur = resolved + "/" + parts[i]
+		}
+		if i == len(parts)-1 && !follow {
+			return key(cur), nil
+		}
+		val := files.Get([]byte(key(cur)))
+		target, ok := "", false
+		if val != nil {
+			target, ok = fs.linkTarget(val)
+		}
+		if !ok {
+			resolved = cur
+			continue
+		}
+		if hops++; hops > maxSymlinks {
+			return "", ErrSymlinkLoop
+		}
+		target = fs.normalize(target)
+		if path.IsAbs(target) {
+			target = strings.TrimPrefix(path.Clean(target), "/")
+		} else if i > 0 {
+			target = path.Join(resolved, target)
+		}
+		target = path.Clean(target)
+		if root != "" && (target == ".." || strings.HasPrefix(target, "../")) {
+			return "", ErrOutsideScope
+		}
+		// 用链接目标替换已解析的部分, 然后从头解析目标和剩余的路径分量
+		if target == "." || target == "" {
+			parts = parts[i+1:]
+		} else {
+			parts = append(strings.Split(target, "/"), parts[i+1:]...)
+		}
+		resolved, i = "", -1
+	}
+	return key(resolved), nil
+}
+
+// resolve 解析 name 中的符号链接, noFollow 为 true 且最后一个路径分量是符号链接时返回 ErrSymlinkLoop
+func (fs *BBolt) resolve(name string, noFollow bool) (string, error) {
+	err := fs.view(func(tx *bbolt.Tx) error {
+		var err error
+		if name, err = fs.resolveTx(tx, name, !noFollow); err != nil || !noFollow {
+			return err
+		}
+		if val := tx.Bucket([]byte(bucketFiles)).Get([]byte(name)); val != nil {
+			if _, ok := fs.linkTarget(val); ok {
+				return ErrSymlinkLoop
+			}
+		}
+		return nil
+	})
+	return name, err
+}
@@ -0,0 +1,273 @@
+package bboltfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestBBoltFs_Symlink(t *testing.T) {
+	fs := newTestFs(t)
+	if err := fs.MkdirAll("data", 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.CreateWith("data/real.txt", []byte("content"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	if err = fs.Symlink("real.txt", "data/link.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err = fs.Symlink("data", "dirlink"); err != nil {
+		t.Fatal(err)
+	}
+	if err = fs.Symlink("data", "dirlink"); !errors.Is(err, ErrFileExists) {
+		t.Errorf("second Symlink = %v, want ErrFileExists", err)
+	}
+	if target, err := fs.Readlink("data/link.txt"); err != nil || target != "real.txt" {
+		t.Errorf("Readlink = %q, %v", target, err)
+	}
+	if _, err := fs.Readlink("data/real.txt"); !errors.Is(err, os.ErrInvalid) {
+		t.Errorf("Readlink(regular) = %v, want ErrInvalid", err)
+	}
+
+	for _, name := range []string{"data/link.txt", "dirlink/real.txt", "dirlink/link.txt"} {
+		if got := readAll(t, fs, name); got != "content" {
+			t.Errorf("%s = %q, want content", name, got)
+		}
+	}
+	// Stat 跟随符号链接, Lstat 返回链接本身
+	fi, err := fs.Stat("data/link.txt")
+	if err != nil || fi.Mode()&os.ModeSymlink != 0 || fi.Size() != int64(len("content")) || fi.Name() != "link.txt" {
+		t.Errorf("Stat(link) = %v, %v", fi, err)
+	}
+	if fi, err = fs.Lstat("data/link.txt"); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Lstat(link) mode = %v, %v", fi, err)
+	}
+	if fi, err = fs.Stat("dirlink"); err != nil || !fi.IsDir() {
+		t.Errorf("Stat(dirlink) = %v, %v", fi, err)
+	}
+	if entries, err := fs.ReadDir("dirlink"); err != nil || len(entries) != 2 {
+		t.Errorf("ReadDir(dirlink) = %v, %v", entries, err)
+	}
+
+	// O_NOFOLLOW 只拒绝最后一个路径分量是符号链接的情况
+	if _, err := fs.OpenFile("data/link.txt", os.O_RDONLY|O_NOFOLLOW, 0); !errors.Is(err, syscall.ELOOP) {
+		t.Errorf("OpenFile(link, O_NOFOLLOW) = %v, want ELOOP", err)
+	}
+	f, err = fs.OpenFile("dirlink/real.txt", os.O_RDONLY|O_NOFOLLOW, 0)
+	if err != nil {
+		t.Fatalf("OpenFile(dirlink/real.txt, O_NOFOLLOW): %v", err)
+	}
+	data, _ := io.ReadAll(f)
+	_ = f.Close()
+	if string(data) != "content" {
+		t.Errorf("content = %q", data)
+	}
+
+	// 通过符号链接写入会修改目标文件
+	f, err = fs.Open("data/link.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.WriteAt([]byte("C"), 0); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	if got := readAll(t, fs, "data/real.txt"); got != "Content" {
+		t.Errorf("target after write = %q", got)
+	}
+}
+
+func TestBBoltFs_IsSymlink(t *testing.T) {
+	fs := newTestFs(t)
+	_ = fs.Mkdir("data", 0755)
+	f, _ := fs.CreateWith("data/real.txt", []byte("content"), 0644)
+	f.Close()
+	_ = fs.Symlink("real.txt", "data/link.txt")
+	_ = fs.Symlink("data", "dirlink")
+
+	for name, want := range map[string]bool{
+		"data/link.txt":    true,
+		"dirlink":          true,
+		"data/real.txt":    false,
+		"data":             false,
+		"dirlink/link.txt": true,  // 只解析中间的链接
+		"dirlink/real.txt": false, // 中间的链接被解析后是普通文件
+	} {
+		got, err := fs.IsSymlink(name)
+		if err != nil || got != want {
+			t.Errorf("IsSymlink(%s) = %v, %v, want %v", name, got, err, want)
+		}
+	}
+	if fi, err := fs.Lstat("data/link.txt"); err != nil || fi.Size() != int64(len("real.txt")) {
+		t.Errorf("Lstat(link) = %v, %v", fi, err)
+	}
+	if _, err := fs.IsSymlink("missing"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("IsSymlink(missing) = %v, want ErrFileNotFound", err)
+	}
+}
+
+func TestBBoltFs_SymlinkLoop(t *testing.T) {
+	fs := newTestFs(t)
+	_ = fs.Symlink("b", "a")
+	_ = fs.Symlink("a", "b")
+	if _, err := fs.Open("a"); !errors.Is(err, ErrSymlinkLoop) {
+		t.Errorf("Open(loop) = %v, want ErrSymlinkLoop", err)
+	}
+	if _, err := fs.Stat("a"); !errors.Is(err, ErrSymlinkLoop) {
+		t.Errorf("Stat(loop) = %v, want ErrSymlinkLoop", err)
+	}
+	if fi, err := fs.Lstat("a"); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Lstat(loop) = %v, %v", fi, err)
+	}
+	if err := fs.Symlink("missing", "dangling"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Open("dangling"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Open(dangling) = %v, want ErrFileNotFound", err)
+	}
+	if _, err := fs.Stat("dangling"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Stat(dangling) = %v, want ErrFileNotFound", err)
+	}
+	if target, err := fs.Readlink("dangling"); err != nil || target != "missing" {
+		t.Errorf("Readlink(dangling) = %q, %v", target, err)
+	}
+}
+
+func TestBBoltFs_SymlinkWritesTarget(t *testing.T) {
+	fs := newTestFs(t)
+	reset := func() {
+		if err := fs.WriteString("data.txt", "data", 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reset()
+	if err := fs.Symlink("data.txt", "link"); err != nil {
+		t.Fatal(err)
+	}
+	check := func(op, want string) {
+		t.Helper()
+		if target, err := fs.Readlink("link"); err != nil || target != "data.txt" {
+			t.Errorf("%s: Readlink = %q, %v, link was modified", op, target, err)
+		}
+		if got := readAll(t, fs, "data.txt"); got != want {
+			t.Errorf("%s: target = %q, want %q", op, got, want)
+		}
+	}
+
+	if err := fs.Truncate("link", 2); err != nil {
+		t.Fatal(err)
+	}
+	check("Truncate", "da")
+	reset()
+	if err := fs.CopyRange("link", 0, 2, 2); err != nil {
+		t.Fatal(err)
+	}
+	check("CopyRange", "dada")
+	reset()
+	if ok, err := fs.CompareAndSwap("link", []byte("data"), []byte("new")); err != nil || !ok {
+		t.Fatalf("CompareAndSwap = %v, %v", ok, err)
+	}
+	check("CompareAndSwap", "new")
+	reset()
+	if prev, err := fs.Swap("link", []byte("zzz")); err != nil || string(prev) != "data" {
+		t.Fatalf("Swap = %q, %v", prev, err)
+	}
+	check("Swap", "zzz")
+	reset()
+	if _, err := fs.Append("link", []byte("+")); err != nil {
+		t.Fatal(err)
+	}
+	check("Append", "data+")
+	if err := fs.WriteString("link", "written", 0644); err != nil {
+		t.Fatal(err)
+	}
+	check("WriteString", "written")
+	f, err := fs.Create("link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte("created"))
+	_ = f.Close()
+	check("Create", "created")
+	err = fs.Do(func(tx *TxFs) error {
+		return tx.Truncate("link", 3)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("TxFs.Truncate", "cre")
+	reset()
+	if f, err = fs.OpenBuffered("link", 1<<10); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte("XYZ"))
+	_ = f.Close()
+	check("OpenBuffered", "dataXYZ")
+	reset()
+	if f, err = fs.OpenShared("link"); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteAt([]byte("Q"), 0)
+	_ = f.Close()
+	check("OpenShared", "Qata")
+	if fi, err := fs.Lstat("link"); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Lstat(link) = %v, %v", fi, err)
+	}
+
+	// 指向不存在目标的链接上创建文件时创建目标
+	_ = fs.Symlink("later.txt", "dangling")
+	if err = fs.WriteString("dangling", "later", 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, fs, "later.txt"); got != "later" {
+		t.Errorf("dangling target = %q", got)
+	}
+}
+
+func TestBBoltFs_ScansSkipSymlinks(t *testing.T) {
+	fs := newTestFs(t)
+	_ = fs.WriteString("a.txt", "match me\n", 0644)
+	_ = fs.Symlink("a.txt", "link.txt")
+
+	if matches, err := fs.Grep("a", ""); err != nil || len(matches) != 1 || matches[0].Path != "a.txt" {
+		t.Errorf("Grep = %v, %v", matches, err)
+	}
+	if entries, err := fs.Manifest(); err != nil || len(entries) != 1 {
+		t.Errorf("Manifest = %v, %v", entries, err)
+	}
+	if snap, err := fs.Snapshot(); err != nil || len(snap) != 1 {
+		t.Errorf("Snapshot = %v, %v", snap, err)
+	}
+	if counts, _, err := fs.ExtensionStats(); err != nil || counts[".txt"] != 1 {
+		t.Errorf("ExtensionStats = %v, %v", counts, err)
+	}
+	if infos, err := fs.FilesBySize(0, 1<<20); err != nil || len(infos) != 1 {
+		t.Errorf("FilesBySize = %v, %v", infos, err)
+	}
+}
+
+func TestBBoltFs_SymlinkLongTarget(t *testing.T) {
+	fs := newTestFs(t, WithInlineThreshold(16))
+	target := "some/deeply/nested/directory/target.txt"
+	if err := fs.WriteString(target, "content", 0644); err != nil {
+		t.Fatal(err)
+	}
+	// 链接目标长于内联阈值时仍然内联存储
+	if err := fs.Symlink(target, "link"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := fs.Readlink("link"); err != nil || got != target {
+		t.Errorf("Readlink = %q, %v; want %q", got, err, target)
+	}
+	if got := readAll(t, fs, "link"); got != "content" {
+		t.Errorf("content through link = %q", got)
+	}
+	if fi, err := fs.Lstat("link"); err != nil || fi.Sys().(*SysInfo).Storage != StorageInline {
+		t.Errorf("Lstat(link) = %v, %v; want inline storage", fi, err)
+	}
+}
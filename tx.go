@@ -0,0 +1,435 @@
+package bboltfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// TxFs 是 Do 的回调中使用的文件系统, 所有操作都在同一个写事务中执行,
+// 回调返回 nil 时一起提交, 返回错误时全部回滚. TxFs 及其打开的句柄只在回调中有效
+type TxFs struct {
+	fs      *BBolt
+	tx      *bbolt.Tx
+	records []JournalRecord // 回调成功返回后写入同一个事务, 回滚时丢弃
+	done    bool
+}
+
+var (
+	_ Fs   = (*TxFs)(nil)
+	_ File = (*txFile)(nil)
+)
+
+// Do 开启一个写事务并在其中执行 fn, 适合批量创建、读取和删除等需要原子性的脚本任务,
+// 同时避免每次操作单独开启事务. 回调中不能再调用 fs 自身的写操作, 否则会等待当前事务而死锁
+func (fs *BBolt) Do(fn func(tx *TxFs) error) error {
+	t := &TxFs{fs: fs}
+	err := fs.update(func(tx *bbolt.Tx) error {
+		t.tx, t.records = tx, nil
+		if err := fn(t); err != nil {
+			return err
+		}
+		return fs.recordTx(tx, t.records...)
+	})
+	t.done = true
+	return err
+}
+
+func (t *TxFs) record(rec JournalRecord) {
+	t.records = append(t.records, rec)
+}
+
+func (t *TxFs) Create(name string) (File, error) {
+	raw := name
+	name = t.fs.normalize(name)
+	meta := fileMeta{Mode: 0666, ModTime: time.Now().UnixNano()}
+	name, raw, err := t.fs.writeTargetTx(t.tx, name, raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.fs.checkCreate(t.tx, name, false); err != nil {
+		return nil, err
+	}
+	if err := t.fs.putFileTx(t.tx, name, nil, meta, true); err != nil {
+		return nil, err
+	}
+	if err := t.fs.keepCaseTx(t.tx, name, raw); err != nil {
+		return nil, err
+	}
+	t.record(JournalRecord{Op: OpCreate, Path: name})
+	return &txFile{t: t, name: name, meta: meta}, nil
+}
+
+func (t *TxFs) Mkdir(name string, perm os.FileMode) error {
+	if t.fs.flat {
+		return nil
+	}
+	raw := name
+	name = t.fs.normalize(name)
+	meta := fileMeta{Mode: perm | os.ModeDir, ModTime: time.Now().UnixNano(), IsDir: true}
+	if err := t.fs.saveDirTx(t.tx, name, meta); err != nil {
+		return err
+	}
+	if err := t.fs.keepCaseTx(t.tx, name, raw); err != nil {
+		return err
+	}
+	t.record(JournalRecord{Op: OpMkdir, Path: name, Mode: perm})
+	return nil
+}
+
+func (t *TxFs) MkdirAll(p string, perm os.FileMode) error {
+	dir := ""
+	for _, d := range strings.Split(filepath.Clean(t.fs.separators(p)), string(os.PathSeparator)) {
+		if dir == "" {
+			dir = d
+		} else {
+			dir = path.Join(dir, d)
+		}
+		if err := t.Mkdir(dir, perm); err != nil && !errors.Is(err, os.ErrExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *TxFs) Open(name string) (File, error) {
+	name, err := t.fs.resolveTx(t.tx, t.fs.normalize(name), true)
+	if err != nil {
+		return nil, err
+	}
+	if val := t.tx.Bucket([]byte(bucketFiles)).Get([]byte(name)); val != nil {
+		meta, data, err := t.fs.fileContent(t.tx, val)
+		if err != nil {
+			return nil, err
+		}
+		return &txFile{t: t, name: name, meta: meta, data: data}, nil
+	}
+	fi, err := t.fs.statTx(t.tx, name)
+	if err != nil {
+		return nil, err
+	}
+	return &txFile{t: t, name: name, meta: fileMeta{Mode: fi.mode, ModTime: fi.modTime.UnixNano(), IsDir: true}}, nil
+}
+
+func (t *TxFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if flag&O_DIRECTORY != 0 {
+		if t.tx.Bucket([]byte(bucketFiles)).Get([]byte(t.fs.normalize(name))) != nil {
+			return nil, ErrNotDirectory
+		}
+		return t.Open(name)
+	}
+	if flag&(os.O_CREATE|os.O_RDWR|os.O_WRONLY|os.O_APPEND) == 0 {
+		return t.Open(name)
+	}
+	if flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+		if err := t.fs.checkCreate(t.tx, t.fs.normalize(name), true); err != nil {
+			return nil, err
+		}
+		return t.Create(name)
+	}
+	// 与 BBolt.OpenFile 一致, 只有 O_TRUNC 清空已有内容
+	f, err := t.Open(name)
+	if errors.Is(err, ErrFileNotFound) && flag&os.O_CREATE != 0 {
+		return t.Create(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	tf := f.(*txFile)
+	if tf.meta.IsDir {
+		return nil, ErrIsDirectory
+	}
+	if flag&os.O_TRUNC != 0 {
+		if err = tf.Truncate(0); err != nil {
+			return nil, err
+		}
+	}
+	if flag&os.O_APPEND != 0 {
+		tf.offset = int64(len(tf.data))
+	}
+	return tf, nil
+}
+
+func (t *TxFs) Remove(name string) error {
+	name = t.fs.normalize(name)
+	if _, err := t.fs.removeTx(t.tx, name); err != nil {
+		return err
+	}
+	t.record(JournalRecord{Op: OpRemove, Path: name})
+	return nil
+}
+
+func (t *TxFs) ReadDir(name string) ([]os.DirEntry, error) {
+	name = t.fs.normalize(name)
+	if _, err := t.fs.statTx(t.tx, name); err != nil && name != "" {
+		return nil, err
+	}
+	return dirEntries(t.fs.readDirTx(t.tx, name, 0)), nil
+}
+
+// RemoveAll 在事务中删除 p 及其下的所有文件和子目录, p 不存在时返回 nil
+func (t *TxFs) RemoveAll(p string) error {
+	p = t.fs.normalize(p)
+	if err := t.fs.removeAllTx(t.tx, p); err != nil {
+		return err
+	}
+	t.record(JournalRecord{Op: OpRemoveAll, Path: p})
+	return nil
+}
+
+func (t *TxFs) Rename(oldname, newname string) error {
+	rawNew := newname
+	oldname, newname = t.fs.normalize(oldname), t.fs.normalize(newname)
+	if t.fs.caseInsensitive && oldname == newname {
+		if err := t.fs.renameCase(t.tx, newname, rawNew); err != nil {
+			return err
+		}
+	} else if err := t.fs.rename(t.tx, oldname, newname); err != nil {
+		return err
+	} else if err = t.fs.setDisplayName(t.tx, newname, rawNew); err != nil {
+		return err
+	}
+	t.record(JournalRecord{Op: OpRename, Path: oldname, NewPath: newname})
+	return nil
+}
+
+func (t *TxFs) Stat(name string) (os.FileInfo, error) {
+	fi, err := t.fs.statFollowTx(t.tx, t.fs.normalize(name))
+	if err != nil {
+		return nil, err
+	}
+	return fi, nil
+}
+
+func (t *TxFs) Name() string { return t.fs.Name() }
+
+func (t *TxFs) Chmod(name string, mode os.FileMode) error {
+	name = t.fs.normalize(name)
+	meta, err := t.fs.updateMetaTx(t.tx, name, func(meta *fileMeta) {
+		meta.Mode = meta.Mode&os.ModeType | mode&^os.ModeType
+	})
+	if err != nil {
+		return err
+	}
+	t.record(JournalRecord{Op: OpChmod, Path: name, Mode: mode, Size: meta.Size})
+	return nil
+}
+
+func (t *TxFs) Chown(name string, uid, gid int) error {
+	name = t.fs.normalize(name)
+	_, err := t.fs.updateMetaTx(t.tx, name, func(meta *fileMeta) { meta.Uid, meta.Gid = int32(uid), int32(gid) })
+	if err != nil {
+		return err
+	}
+	t.record(JournalRecord{Op: OpChown, Path: name, Uid: uid, Gid: gid})
+	return nil
+}
+
+func (t *TxFs) Chtimes(name string, atime, mtime time.Time) error {
+	name = t.fs.normalize(name)
+	meta, err := t.fs.updateMetaTx(t.tx, name, func(meta *fileMeta) { meta.ModTime = mtime.UnixNano() })
+	if err != nil {
+		return err
+	}
+	t.record(JournalRecord{Op: OpChtimes, Path: name, ModTime: meta.ModTime, Size: meta.Size})
+	return nil
+}
+
+func (t *TxFs) Truncate(name string, size int64) error {
+	name = t.fs.normalize(name)
+	if size < 0 {
+		return os.ErrInvalid
+	}
+	name, err := t.fs.resolveTx(t.tx, name, true)
+	if err != nil {
+		return err
+	}
+	if err := t.fs.truncateTx(t.tx, name, size, time.Now().UnixNano()); err != nil {
+		return err
+	}
+	t.record(JournalRecord{Op: OpTruncate, Path: name, Size: size})
+	return nil
+}
+
+// Close 不做任何事, 事务由 Do 提交或回滚
+func (t *TxFs) Close() error { return nil }
+
+// txFile 是 TxFs 打开的句柄, 内容保存在内存中, 每次修改立即写入事务
+type txFile struct {
+	t      *TxFs
+	name   string
+	meta   fileMeta
+	data   []byte
+	offset int64
+	closed bool
+}
+
+func (f *txFile) check() error {
+	if f.closed || f.t.done {
+		return os.ErrClosed
+	}
+	return nil
+}
+
+func (f *txFile) Name() string { return f.name }
+
+func (f *txFile) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.offset)
+	f.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *txFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.check(); err != nil {
+		return 0, err
+	}
+	if f.meta.IsDir {
+		return 0, io.EOF
+	}
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *txFile) Seek(offset int64, whence int) (int64, error) {
+	if err := f.check(); err != nil {
+		return 0, err
+	}
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = f.offset + offset
+	case io.SeekEnd:
+		abs = int64(len(f.data)) + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("negative position")
+	}
+	f.offset = abs
+	return abs, nil
+}
+
+func (f *txFile) Write(p []byte) (int, error) {
+	n, err := f.WriteAt(p, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *txFile) WriteAt(p []byte, off int64) (int, error) {
+	if err := f.check(); err != nil {
+		return 0, err
+	}
+	if f.meta.IsDir {
+		return 0, ErrIsDirectory
+	}
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if end := off + int64(len(p)); end > int64(len(f.data)) {
+		f.data = append(f.data, make([]byte, end-int64(len(f.data)))...)
+	}
+	copy(f.data[off:], p)
+	if err := f.save(); err != nil {
+		return 0, err
+	}
+	f.t.record(JournalRecord{Op: OpWrite, Path: f.name, Offset: off, Data: append([]byte(nil), p...), Size: f.meta.Size})
+	return len(p), nil
+}
+
+func (f *txFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *txFile) Truncate(size int64) error {
+	if err := f.check(); err != nil {
+		return err
+	}
+	if f.meta.IsDir {
+		return ErrIsDirectory
+	}
+	if size < 0 {
+		return os.ErrInvalid
+	}
+	if size < int64(len(f.data)) {
+		f.data = f.data[:size]
+	} else {
+		f.data = append(f.data, make([]byte, size-int64(len(f.data)))...)
+	}
+	if err := f.save(); err != nil {
+		return err
+	}
+	f.t.record(JournalRecord{Op: OpTruncate, Path: f.name, Size: size})
+	return nil
+}
+
+// save 将句柄中的内容写入事务
+func (f *txFile) save() error {
+	f.meta.Size = int64(len(f.data))
+	f.meta.ModTime = time.Now().UnixNano()
+	return f.t.fs.putFileTx(f.t.tx, f.name, f.data, f.meta, true)
+}
+
+func (f *txFile) Stat() (os.FileInfo, error) {
+	if err := f.check(); err != nil {
+		return nil, err
+	}
+	return f.t.Stat(f.name)
+}
+
+func (f *txFile) Sync() error { return f.check() }
+
+func (f *txFile) Close() error {
+	f.closed = true
+	return nil
+}
+
+func (f *txFile) Readdir(count int) ([]os.FileInfo, error) {
+	if err := f.check(); err != nil {
+		return nil, err
+	}
+	if !f.meta.IsDir {
+		return nil, ErrNotDirectory
+	}
+	return f.t.fs.readDirTx(f.t.tx, f.name, count), nil
+}
+
+func (f *txFile) ReadDir(n int) ([]os.DirEntry, error) {
+	infos, err := f.Readdir(n)
+	if err != nil {
+		return nil, err
+	}
+	return dirEntries(infos), nil
+}
+
+func (f *txFile) Readdirnames(n int) ([]string, error) {
+	infos, err := f.Readdir(n)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, fi := range infos {
+		names = append(names, fi.Name())
+	}
+	return names, nil
+}
@@ -0,0 +1,134 @@
+package bboltfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestBBoltFs_Do(t *testing.T) {
+	fs := newTestFs(t)
+	f, _ := fs.CreateWith("old.txt", []byte("old"), 0644)
+	f.Close()
+
+	var handle File
+	err := fs.Do(func(tx *TxFs) error {
+		if err := tx.MkdirAll("a/b", 0755); err != nil {
+			return err
+		}
+		f, err := tx.Create("a/b/new.txt")
+		if err != nil {
+			return err
+		}
+		if _, err = f.Write([]byte("hello")); err != nil {
+			return err
+		}
+		handle = f
+		// 事务中的读取能看到尚未提交的修改
+		g, err := tx.Open("a/b/new.txt")
+		if err != nil {
+			return err
+		}
+		if data, _ := io.ReadAll(g); string(data) != "hello" {
+			t.Errorf("read inside Do = %q", data)
+		}
+		if err = tx.Rename("old.txt", "a/renamed.txt"); err != nil {
+			return err
+		}
+		entries, err := tx.ReadDir("a")
+		if err != nil || len(entries) != 2 {
+			t.Errorf("ReadDir inside Do = %v, %v", entries, err)
+		}
+		if err = tx.Truncate("a/renamed.txt", 1); err != nil {
+			return err
+		}
+		return tx.Chmod("a/renamed.txt", 0600)
+	})
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if got := readAll(t, fs, "a/b/new.txt"); got != "hello" {
+		t.Errorf("new.txt = %q", got)
+	}
+	if got := readAll(t, fs, "a/renamed.txt"); got != "o" {
+		t.Errorf("renamed.txt = %q", got)
+	}
+	if fi, err := fs.Stat("a/renamed.txt"); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("Stat = %v, %v", fi, err)
+	}
+	if _, err := fs.Stat("old.txt"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("old.txt still exists: %v", err)
+	}
+	if _, err := handle.Write([]byte("x")); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Write after Do = %v, want ErrClosed", err)
+	}
+}
+
+func TestBBoltFs_DoRollback(t *testing.T) {
+	fs := newTestFs(t)
+	f, _ := fs.CreateWith("keep.txt", []byte("keep"), 0644)
+	f.Close()
+
+	boom := errors.New("boom")
+	err := fs.Do(func(tx *TxFs) error {
+		if err := tx.Mkdir("dir", 0755); err != nil {
+			return err
+		}
+		f, err := tx.Create("dir/partial.txt")
+		if err != nil {
+			return err
+		}
+		if _, err = f.Write([]byte("partial")); err != nil {
+			return err
+		}
+		if err = tx.RemoveAll("keep.txt"); err != nil {
+			return err
+		}
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("Do = %v, want boom", err)
+	}
+	for _, name := range []string{"dir", "dir/partial.txt"} {
+		if _, err := fs.Stat(name); !errors.Is(err, ErrFileNotFound) {
+			t.Errorf("%s exists after rollback: %v", name, err)
+		}
+	}
+	if got := readAll(t, fs, "keep.txt"); got != "keep" {
+		t.Errorf("keep.txt = %q after rollback", got)
+	}
+}
+
+func TestBBoltFs_DoOpenFile(t *testing.T) {
+	fs := newTestFs(t)
+	f, _ := fs.CreateWith("keep.txt", []byte("keep"), 0644)
+	f.Close()
+	f, _ = fs.CreateWith("trunc.txt", []byte("trunc"), 0644)
+	f.Close()
+
+	err := fs.Do(func(tx *TxFs) error {
+		f, err := tx.OpenFile("keep.txt", os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			return err
+		}
+		if _, err = f.Write([]byte("!")); err != nil {
+			return err
+		}
+		f, err = tx.OpenFile("trunc.txt", os.O_WRONLY|os.O_TRUNC, 0)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write([]byte("new"))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, fs, "keep.txt"); got != "keep!" {
+		t.Errorf("keep.txt = %q, want keep!", got)
+	}
+	if got := readAll(t, fs, "trunc.txt"); got != "new" {
+		t.Errorf("trunc.txt = %q, want new", got)
+	}
+}
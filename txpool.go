@@ -0,0 +1,117 @@
+package bboltfs
+
+import (
+	"sync"
+
+	"go.etcd.io/bbolt"
+)
+
+// txPool 缓存少量只读事务供 Stat/Open/Readdir 等读操作复用, 减少事务的开启和关闭.
+//
+// 每个事务同一时间只借给一个调用方. 写事务开始前和提交后都会关闭所有空闲事务并增加 gen,
+// 归还时 gen 已变化的事务直接关闭, 因此通过 fs 进行的写入提交后, 之后的读取总能看到最新数据.
+// 写事务进行期间归还的事务也直接关闭: 空闲事务持有 bbolt 的 mmap 读锁, 提交时扩容重新映射会一直等待它.
+// 代价是: 绕过 fs 直接通过 DB 写入时, 空闲事务仍停留在旧快照上, 需要调用 InvalidateAll;
+// 此外空闲事务会使旧页面在下一次写入前无法被回收
+type txPool struct {
+	db   *bbolt.DB
+	size int
+
+	mu      sync.Mutex
+	gen     uint64
+	idle    []*bbolt.Tx
+	writers int // 正在进行的写事务数
+	closed  bool
+}
+
+func newTxPool(db *bbolt.DB, size int) *txPool {
+	return &txPool{db: db, size: size}
+}
+
+func (p *txPool) get() (*bbolt.Tx, uint64, error) {
+	p.mu.Lock()
+	gen := p.gen
+	if n := len(p.idle); n > 0 {
+		tx := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		return tx, gen, nil
+	}
+	p.mu.Unlock()
+	tx, err := p.db.Begin(false)
+	return tx, gen, err
+}
+
+func (p *txPool) put(tx *bbolt.Tx, gen uint64) {
+	p.mu.Lock()
+	if !p.closed && p.writers == 0 && gen == p.gen && len(p.idle) < p.size {
+		p.idle = append(p.idle, tx)
+		p.mu.Unlock()
+		return
+	}
+	p.mu.Unlock()
+	_ = tx.Rollback()
+}
+
+// drain 关闭所有空闲事务, 之后归还的旧事务也会被关闭
+func (p *txPool) drain() {
+	p.mu.Lock()
+	p.gen++
+	idle := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+	for _, tx := range idle {
+		_ = tx.Rollback()
+	}
+}
+
+// beginWrite 在写事务开始前调用, 关闭所有空闲事务, 直到对应的 endWrite 之前归还的事务都不再缓存
+func (p *txPool) beginWrite() {
+	p.mu.Lock()
+	p.writers++
+	p.mu.Unlock()
+	p.drain()
+}
+
+// endWrite 在写事务结束后调用, 丢弃写事务期间开启的旧快照
+func (p *txPool) endWrite() {
+	p.mu.Lock()
+	p.writers--
+	p.mu.Unlock()
+	p.drain()
+}
+
+// close 关闭所有空闲事务并不再缓存新的事务. bbolt 关闭数据库时会等待所有事务结束
+func (p *txPool) close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	p.drain()
+}
+
+// view 在只读事务中执行 fn, 开启了事务池时复用缓存的事务
+func (fs *BBolt) view(fn func(tx *bbolt.Tx) error) error {
+	fs.dbMu.RLock()
+	defer fs.dbMu.RUnlock()
+	if fs.dbErr != nil {
+		return fs.dbErr
+	}
+	if fs.txPool == nil {
+		return translateErr(fs.db.View(fn))
+	}
+	tx, gen, err := fs.txPool.get()
+	if err != nil {
+		return translateErr(err)
+	}
+	ok := false
+	defer func() {
+		if ok {
+			fs.txPool.put(tx, gen)
+		} else {
+			_ = tx.Rollback()
+		}
+	}()
+	err = fn(tx)
+	ok = true
+	return err
+}
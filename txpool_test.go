@@ -0,0 +1,119 @@
+package bboltfs
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBBoltFs_TxPool(t *testing.T) {
+	fs := newTestFs(t, WithTxPool(4))
+	f, err := fs.CreateWith("a", []byte("v1"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	if got := readAll(t, fs, "a"); got != "v1" {
+		t.Fatalf("content = %q", got)
+	}
+	// 写入提交后不会读到缓存事务中的旧快照
+	if err := fs.Truncate("a", 1); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := fs.Stat("a"); err != nil || fi.Size() != 1 {
+		t.Fatalf("Stat after write = %v, %v", fi, err)
+	}
+
+	// 并发读写, 大块写入会触发数据库扩容和重新映射, 不能被缓存的事务阻塞
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				name := fmt.Sprintf("w%d-%d", i, j)
+				f, err := fs.CreateWith(name, bytes.Repeat([]byte("x"), 256<<10), 0644)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				_ = f.Close()
+				if _, err := fs.Stat(name); err != nil {
+					t.Error(err)
+					return
+				}
+				if _, err := fs.ReadDir(""); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestBBoltFs_TxPool_ReadDuringGrowingWrite(t *testing.T) {
+	fs := newTestFs(t, WithTxPool(2))
+	f, _ := fs.CreateWith("small", []byte("x"), 0644)
+	_ = f.Close()
+
+	// 写事务进行期间开启的只读事务不能进入缓存, 否则提交时扩容重新映射会一直等待它
+	var once sync.Once
+	fs.updateHook = func() {
+		once.Do(func() {
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				if _, err := fs.ReadDir(""); err != nil {
+					t.Error(err)
+				}
+			}()
+			<-done
+		})
+	}
+	done := make(chan error, 1)
+	go func() {
+		f, err := fs.CreateWith("big", make([]byte, 64<<20), 0644)
+		if err == nil {
+			err = f.Close()
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(20 * time.Second):
+		t.Fatal("write growing the database blocked by a pooled read transaction")
+	}
+	fs.updateHook = nil
+	if fi, err := fs.Stat("big"); err != nil || fi.Size() != 64<<20 {
+		t.Errorf("Stat(big) = %v, %v", fi, err)
+	}
+}
+
+func benchmarkStats(b *testing.B, opts ...Option) {
+	fs := newTestFs(b, opts...)
+	f, err := fs.CreateWith("f", []byte("data"), 0644)
+	if err != nil {
+		b.Fatal(err)
+	}
+	_ = f.Close()
+	before := fs.db.Stats().TxN
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := fs.Stat("f"); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+	b.ReportMetric(float64(fs.db.Stats().TxN-before)/float64(b.N), "txopens/op")
+}
+
+func BenchmarkBBoltFs_Stat(b *testing.B)        { benchmarkStats(b) }
+func BenchmarkBBoltFs_Stat_TxPool(b *testing.B) { benchmarkStats(b, WithTxPool(8)) }
@@ -0,0 +1,47 @@
+package bboltfs
+
+import (
+	"os"
+
+	"go.etcd.io/bbolt"
+)
+
+// View 在同一个只读事务中执行多次查询, 所有结果来自同一个一致的快照.
+// View 只在 WithView 的回调中有效
+type View struct {
+	fs *BBolt
+	tx *bbolt.Tx
+}
+
+// WithView 开启一个只读事务并在其中执行 fn, 适合循环列出大量目录等需要多次查询的场景,
+// 避免每次调用都单独开启事务
+func (fs *BBolt) WithView(fn func(v *View) error) error {
+	return fs.view(func(tx *bbolt.Tx) error {
+		return fn(&View{fs: fs, tx: tx})
+	})
+}
+
+func (v *View) Stat(name string) (os.FileInfo, error) {
+	fi, err := v.fs.statFollowTx(v.tx, v.fs.normalize(name))
+	if err != nil {
+		return nil, err
+	}
+	return fi, nil
+}
+
+func (v *View) ReadDir(name string) ([]os.DirEntry, error) {
+	name = v.fs.normalize(name)
+	if _, err := v.fs.statTx(v.tx, name); err != nil && name != "" {
+		return nil, err
+	}
+	return dirEntries(v.fs.readDirTx(v.tx, name, 0)), nil
+}
+
+// Open 打开文件或目录, 返回的句柄在 WithView 返回后依然可用, 需要调用方关闭
+func (v *View) Open(name string) (File, error) {
+	f, err := v.fs.openTx(v.tx, v.fs.normalize(name))
+	if err != nil {
+		return nil, err
+	}
+	return v.fs.track(f), nil
+}
@@ -0,0 +1,102 @@
+package bboltfs
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBBoltFs_WithView(t *testing.T) {
+	fs := newTestFs(t)
+	_ = fs.MkdirAll("a/b", 0755)
+	f, err := fs.CreateWith("a/f.txt", []byte("hello"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	err = fs.WithView(func(v *View) error {
+		entries, err := v.ReadDir("a")
+		if err != nil {
+			return err
+		}
+		if len(entries) != 2 || entries[0].Name() != "b" || entries[1].Name() != "f.txt" {
+			t.Errorf("ReadDir = %v", entries)
+		}
+		fi, err := v.Stat("a/f.txt")
+		if err != nil {
+			return err
+		}
+		if fi.Size() != 5 || fi.IsDir() {
+			t.Errorf("Stat = %d/%v", fi.Size(), fi.IsDir())
+		}
+		if _, err := v.Stat("missing"); err == nil {
+			t.Error("Stat missing should fail")
+		}
+		if _, err := v.ReadDir("missing"); err == nil {
+			t.Error("ReadDir missing should fail")
+		}
+		f, err := v.Open("a/f.txt")
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		buf := make([]byte, 5)
+		if _, err := f.ReadAt(buf, 0); err != nil || string(buf) != "hello" {
+			t.Errorf("ReadAt = %q, %v", buf, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithView: %v", err)
+	}
+	if handles := fs.OpenHandles(); len(handles) != 0 {
+		t.Errorf("leaked handles: %v", handles)
+	}
+}
+
+func benchmarkDirs(b *testing.B) (*BBolt, []string) {
+	fs := newTestFs(b)
+	dirs := make([]string, 200)
+	for i := range dirs {
+		dirs[i] = fmt.Sprintf("d%03d", i)
+		if err := fs.Mkdir(dirs[i], 0755); err != nil {
+			b.Fatal(err)
+		}
+		populate(b, fs, dirs[i], 5)
+	}
+	// populate 直接写入 files bucket, 需要重建索引
+	if err := fs.RebuildIndex(); err != nil {
+		b.Fatal(err)
+	}
+	return fs, dirs
+}
+
+func BenchmarkBBoltFs_ReadDir_Separate(b *testing.B) {
+	fs, dirs := benchmarkDirs(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, d := range dirs {
+			if _, err := fs.ReadDir(d); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkBBoltFs_ReadDir_WithView(b *testing.B) {
+	fs, dirs := benchmarkDirs(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := fs.WithView(func(v *View) error {
+			for _, d := range dirs {
+				if _, err := v.ReadDir(d); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
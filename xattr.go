@@ -0,0 +1,221 @@
+package bboltfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// bucketXattrs 存储扩展属性, key 为 路径 + "\x00" + 属性名. 旧版本数据库没有该 bucket,
+// 只读模式下读取时视为没有任何扩展属性
+const bucketXattrs = "xattrs"
+
+var ErrNoXattr = errors.New("bboltfs: no such attribute")
+
+// XattrFs 由支持扩展属性的文件系统实现, CopyAcross 在源和目标都实现该接口时复制扩展属性
+type XattrFs interface {
+	GetXattr(name, attr string) ([]byte, error)
+	SetXattr(name, attr string, value []byte) error
+	ListXattr(name string) ([]string, error)
+	RemoveXattr(name, attr string) error
+}
+
+var _ XattrFs = (*BBolt)(nil)
+
+func xattrPrefix(name string) []byte {
+	return []byte(name + "\x00")
+}
+
+func xattrKey(name, attr string) []byte {
+	return append(xattrPrefix(name), attr...)
+}
+
+// exists 判断 name 是否为已存在的文件或目录
+func exists(tx *bbolt.Tx, name string) bool {
+	return tx.Bucket([]byte(bucketFiles)).Get([]byte(name)) != nil ||
+		tx.Bucket([]byte(bucketDirs)).Get([]byte(name)) != nil
+}
+
+func (fs *BBolt) GetXattr(name, attr string) ([]byte, error) {
+	name = fs.normalize(name)
+	var value []byte
+	err := fs.view(func(tx *bbolt.Tx) error {
+		if !exists(tx, name) {
+			return ErrFileNotFound
+		}
+		b := tx.Bucket([]byte(bucketXattrs))
+		var v []byte
+		if b != nil {
+			v = b.Get(xattrKey(name, attr))
+		}
+		if v == nil {
+			return ErrNoXattr
+		}
+		value = append([]byte{}, v...)
+		return nil
+	})
+	return value, err
+}
+
+func (fs *BBolt) SetXattr(name, attr string, value []byte) error {
+	name = fs.normalize(name)
+	if attr == "" {
+		return os.ErrInvalid
+	}
+	return fs.update(func(tx *bbolt.Tx) error {
+		if !exists(tx, name) {
+			return ErrFileNotFound
+		}
+		b, err := tx.CreateBucketIfNotExists([]byte(bucketXattrs))
+		if err != nil {
+			return err
+		}
+		return b.Put(xattrKey(name, attr), value)
+	})
+}
+
+// ListXattr 返回 name 的所有扩展属性名, 按字典序排列
+func (fs *BBolt) ListXattr(name string) ([]string, error) {
+	name = fs.normalize(name)
+	var attrs []string
+	err := fs.view(func(tx *bbolt.Tx) error {
+		if !exists(tx, name) {
+			return ErrFileNotFound
+		}
+		b := tx.Bucket([]byte(bucketXattrs))
+		if b == nil {
+			return nil
+		}
+		prefix := xattrPrefix(name)
+		c := b.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			attrs = append(attrs, string(k[len(prefix):]))
+		}
+		return nil
+	})
+	return attrs, err
+}
+
+func (fs *BBolt) RemoveXattr(name, attr string) error {
+	name = fs.normalize(name)
+	return fs.update(func(tx *bbolt.Tx) error {
+		if !exists(tx, name) {
+			return ErrFileNotFound
+		}
+		b := tx.Bucket([]byte(bucketXattrs))
+		if b == nil || b.Get(xattrKey(name, attr)) == nil {
+			return ErrNoXattr
+		}
+		return b.Delete(xattrKey(name, attr))
+	})
+}
+
+// deleteXattrs 删除 name 的所有扩展属性
+func deleteXattrs(tx *bbolt.Tx, name string) error {
+	b := tx.Bucket([]byte(bucketXattrs))
+	if b == nil {
+		return nil
+	}
+	prefix := xattrPrefix(name)
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Seek(prefix) {
+		if err := c.Delete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveXattrs 将 oldname 的扩展属性移动到 newname, newname 原有的扩展属性被丢弃
+func moveXattrs(tx *bbolt.Tx, oldname, newname string) error {
+	b := tx.Bucket([]byte(bucketXattrs))
+	if b == nil {
+		return nil
+	}
+	if err := deleteXattrs(tx, newname); err != nil {
+		return err
+	}
+	prefix := xattrPrefix(oldname)
+	c := b.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Seek(prefix) {
+		attr, value := string(k[len(prefix):]), append([]byte{}, v...)
+		if err := c.Delete(); err != nil {
+			return err
+		}
+		if err := b.Put(xattrKey(newname, attr), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CopyAcross 将文件系统 src 中的 srcName 复制到文件系统 dst 的 dstName, 同时复制权限和修改时间.
+// 源和目标都实现 XattrFs 时一并复制扩展属性, 否则只复制内容和元数据
+func CopyAcross(src Fs, srcName string, dst Fs, dstName string) error {
+	fi, err := src.Stat(srcName)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return ErrIsDirectory
+	}
+	in, err := src.Open(srcName)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	data, err := io.ReadAll(io.NewSectionReader(in, 0, fi.Size()))
+	if err != nil {
+		return err
+	}
+	if err = writeAcross(dst, dstName, data, fi.Mode(), fi.ModTime()); err != nil {
+		return err
+	}
+
+	sx, ok1 := src.(XattrFs)
+	dx, ok2 := dst.(XattrFs)
+	if !ok1 || !ok2 {
+		return nil
+	}
+	attrs, err := sx.ListXattr(srcName)
+	if err != nil {
+		return err
+	}
+	for _, attr := range attrs {
+		value, err := sx.GetXattr(srcName, attr)
+		if err != nil {
+			return err
+		}
+		if err = dx.SetXattr(dstName, attr, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeAcross(dst Fs, name string, data []byte, mode os.FileMode, mtime time.Time) error {
+	var f File
+	var err error
+	if b, ok := dst.(*BBolt); ok {
+		f, err = b.CreateWith(name, data, mode)
+	} else if f, err = dst.Create(name); err == nil {
+		_, err = f.Write(data)
+	}
+	if err != nil {
+		if f != nil {
+			_ = f.Close()
+		}
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = dst.Chmod(name, mode); err != nil {
+		return err
+	}
+	return dst.Chtimes(name, mtime, mtime)
+}
@@ -0,0 +1,88 @@
+package bboltfs
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBBoltFs_Xattr(t *testing.T) {
+	fs := newTestFs(t)
+	f, err := fs.CreateWith("a", []byte("data"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	if err := fs.SetXattr("a", "user.color", []byte("red")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.SetXattr("a", "user.tag", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := fs.GetXattr("a", "user.color"); err != nil || string(v) != "red" {
+		t.Fatalf("GetXattr = %q, %v", v, err)
+	}
+	if _, err := fs.GetXattr("a", "user.none"); !errors.Is(err, ErrNoXattr) {
+		t.Fatalf("GetXattr missing: %v", err)
+	}
+	if err := fs.SetXattr("missing", "user.color", nil); !errors.Is(err, ErrFileNotFound) {
+		t.Fatalf("SetXattr on missing file: %v", err)
+	}
+
+	// 重命名时扩展属性随文件移动
+	if err := fs.Rename("a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if attrs, err := fs.ListXattr("b"); err != nil || !reflect.DeepEqual(attrs, []string{"user.color", "user.tag"}) {
+		t.Fatalf("ListXattr after rename = %v, %v", attrs, err)
+	}
+	if err := fs.RemoveXattr("b", "user.tag"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 删除后重建的同名文件不会继承扩展属性
+	if err := fs.Remove("b"); err != nil {
+		t.Fatal(err)
+	}
+	f, err = fs.CreateWith("b", nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	if attrs, err := fs.ListXattr("b"); err != nil || len(attrs) != 0 {
+		t.Fatalf("ListXattr after recreate = %v, %v", attrs, err)
+	}
+}
+
+func TestCopyAcross_Xattrs(t *testing.T) {
+	src, dst := newTestFs(t), newTestFs(t)
+	mtime := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+	f, err := src.CreateWith("f.txt", []byte("payload"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	_ = src.Chtimes("f.txt", mtime, mtime)
+	_ = src.SetXattr("f.txt", "user.a", []byte("1"))
+	_ = src.SetXattr("f.txt", "user.b", []byte("2"))
+
+	if err := CopyAcross(src, "f.txt", dst, "copy.txt"); err != nil {
+		t.Fatalf("CopyAcross: %v", err)
+	}
+	if got := readAll(t, dst, "copy.txt"); got != "payload" {
+		t.Fatalf("content = %q", got)
+	}
+	fi, err := dst.Stat("copy.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode() != 0600 || !fi.ModTime().Equal(mtime) {
+		t.Errorf("mode %v, mtime %v", fi.Mode(), fi.ModTime())
+	}
+	for attr, want := range map[string]string{"user.a": "1", "user.b": "2"} {
+		if v, err := dst.GetXattr("copy.txt", attr); err != nil || string(v) != want {
+			t.Errorf("%s = %q, %v", attr, v, err)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package bboltfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// zipExportBlock 是导出内联文件时每次写入的大小, 分块存储的文件按分块大小写入
+const zipExportBlock = 64 * 1024
+
+// ExportZip 将 root 目录下的整棵子树写成 zip 归档, 条目名为相对 root 的路径, 保留权限和修改时间.
+// 整个导出在一个读事务中完成, 文件内容逐块写入, 不会一次性读入内存
+func (fs *BBolt) ExportZip(root string, w io.Writer) error {
+	root = strings.TrimSuffix(fs.normalize(root), "/")
+	zw := zip.NewWriter(w)
+	err := fs.view(func(tx *bbolt.Tx) error {
+		if root != "" {
+			fi, err := fs.statTx(tx, root)
+			if err != nil {
+				return err
+			}
+			if !fi.IsDir() {
+				return ErrNotDirectory
+			}
+		}
+		prefix := []byte(root + "/")
+		rel := func(k []byte) string {
+			if root == "" {
+				return strings.TrimPrefix(string(k), "/")
+			}
+			return string(k[len(prefix):])
+		}
+		// 先写目录再写文件, 解压时父目录总是先于其中的文件出现
+		c := tx.Bucket([]byte(bucketDirs)).Cursor()
+		for k, v := seekPrefix(c, prefix, root == ""); k != nil && (root == "" || bytes.HasPrefix(k, prefix)); k, v = c.Next() {
+			meta := fs.decodeMeta(v)
+			hdr := &zip.FileHeader{Name: rel(k) + "/", Modified: time.Unix(0, meta.ModTime)}
+			hdr.SetMode(meta.Mode | os.ModeDir)
+			if _, err := zw.CreateHeader(hdr); err != nil {
+				return err
+			}
+		}
+		c = tx.Bucket([]byte(bucketFiles)).Cursor()
+		for k, v := seekPrefix(c, prefix, root == ""); k != nil && (root == "" || bytes.HasPrefix(k, prefix)); k, v = c.Next() {
+			meta, inline := fs.splitMeta(v)
+			hdr := &zip.FileHeader{Name: rel(k), Method: zip.Deflate, Modified: time.Unix(0, meta.ModTime)}
+			hdr.SetMode(meta.Mode)
+			fw, err := zw.CreateHeader(hdr)
+			if err != nil {
+				return err
+			}
+			block := int64(zipExportBlock)
+			if meta.Storage == storageChunked {
+				block = int64(meta.ChunkSize)
+			}
+			buf := make([]byte, block)
+			for off := int64(0); off < meta.Size; off += block {
+				n := fs.readAt(tx, meta, inline, buf, off)
+				if _, err := fw.Write(buf[:n]); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// ImportZip 将 zip 归档中的条目写入 dest 目录下, 自动创建父目录, 保留权限和文件的修改时间.
+// 包含 ".." 的条目可能写到 dest 之外, 会被跳过; 经 dest 下已有的符号链接解析到 dest 之外的条目返回 ErrOutsideScope
+func (fs *BBolt) ImportZip(r io.ReaderAt, size int64, dest string) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	dest = strings.TrimSuffix(fs.normalize(dest), "/")
+	if dest != "" {
+		// dest 本身可以是符号链接, 条目的位置按解析后的目录检查
+		if dest, err = fs.resolve(dest, false); err != nil {
+			return err
+		}
+	}
+	for _, zf := range zr.File {
+		name, ok := zipEntryName(zf.Name)
+		if !ok {
+			continue
+		}
+		if dest != "" {
+			name = dest + "/" + name
+		}
+		key, err := fs.insideDest(dest, name)
+		if err != nil {
+			return &os.PathError{Op: "import", Path: zf.Name, Err: err}
+		}
+		if key != fs.normalize(name) {
+			// 经过符号链接的条目直接写入解析后的位置; 其余条目保留原名, 以便记录原始大小写
+			name = key
+		}
+		if zf.Mode().IsDir() {
+			if err = fs.MkdirAll(name, zf.Mode().Perm()); err != nil {
+				return err
+			}
+			continue
+		}
+		if err = fs.importZipFile(zf, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fs *BBolt) importZipFile(zf *zip.File, name string) error {
+	if dir, _ := splitPath(name); dir != "" {
+		if err := fs.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	rc, err := zf.Open()
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(rc)
+	_ = rc.Close()
+	if err != nil {
+		return err
+	}
+	f, err := fs.CreateWith(name, data, zf.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return fs.Chtimes(name, zf.Modified, zf.Modified)
+}
+
+// insideDest 跟随 name 路径上已有的符号链接并返回解析后的 key, 解析到 dest 之外时返回 ErrOutsideScope.
+// dest 为 "" 表示根目录
+func (fs *BBolt) insideDest(dest, name string) (string, error) {
+	key, err := fs.resolve(name, false)
+	if err != nil {
+		return "", err
+	}
+	if dest != "" && key != dest && !strings.HasPrefix(key, dest+"/") {
+		return "", ErrOutsideScope
+	}
+	return key, nil
+}
+
+// zipEntryName 将条目名转换为相对路径, 含有 ".." 的条目返回 false
+func zipEntryName(name string) (string, bool) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	var parts []string
+	for _, p := range strings.Split(name, "/") {
+		switch p {
+		case "", ".":
+		case "..":
+			return "", false
+		default:
+			parts = append(parts, p)
+		}
+	}
+	if len(parts) == 0 {
+		return "", false
+	}
+	return strings.Join(parts, "/"), true
+}
+
+// seekPrefix 将游标定位到 prefix 开头的第一个 key, all 为 true 时从第一个 key 开始
+func seekPrefix(c *bbolt.Cursor, prefix []byte, all bool) ([]byte, []byte) {
+	if all {
+		return c.First()
+	}
+	return c.Seek(prefix)
+}
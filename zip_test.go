@@ -0,0 +1,195 @@
+package bboltfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBBoltFs_ExportZip(t *testing.T) {
+	fs := newTestFs(t, WithInlineThreshold(16))
+	fs.chunkSize = 8
+	_ = fs.MkdirAll("root/sub/deep", 0750)
+	_ = fs.MkdirAll("other", 0755)
+	mtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	files := map[string]string{
+		"root/a.txt":     "small",
+		"root/sub/b.bin": strings.Repeat("chunked-", 5),
+		"other/c.txt":    "outside",
+	}
+	for name, content := range files {
+		f, err := fs.CreateWith(name, []byte(content), 0640)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+		if err := fs.Chtimes(name, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := fs.ExportZip("root", &buf); err != nil {
+		t.Fatalf("ExportZip: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]*zip.File)
+	for _, zf := range zr.File {
+		got[zf.Name] = zf
+	}
+	if len(got) != 4 {
+		t.Fatalf("entries = %v", got)
+	}
+	for _, name := range []string{"sub/", "sub/deep/"} {
+		zf, ok := got[name]
+		if !ok || !zf.Mode().IsDir() {
+			t.Errorf("missing dir entry %s", name)
+		}
+	}
+	for name, want := range map[string]string{"a.txt": "small", "sub/b.bin": files["root/sub/b.bin"]} {
+		zf, ok := got[name]
+		if !ok {
+			t.Fatalf("missing entry %s", name)
+		}
+		if zf.Mode().Perm() != 0640 || !zf.Modified.Equal(mtime) {
+			t.Errorf("%s: mode %v, mtime %v", name, zf.Mode(), zf.Modified)
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(rc)
+		_ = rc.Close()
+		if err != nil || string(data) != want {
+			t.Errorf("%s: content = %q, %v", name, data, err)
+		}
+	}
+
+	if err := fs.ExportZip("root/a.txt", io.Discard); err != ErrNotDirectory {
+		t.Errorf("export file: err = %v", err)
+	}
+	if err := fs.ExportZip("missing", io.Discard); !os.IsNotExist(err) {
+		t.Errorf("export missing: err = %v", err)
+	}
+}
+
+func TestBBoltFs_ImportZip(t *testing.T) {
+	mtime := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	add := func(name string, mode os.FileMode, content string) {
+		hdr := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: mtime}
+		hdr.SetMode(mode)
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write([]byte(content))
+	}
+	add("empty/", os.ModeDir|0700, "")
+	add("top.txt", 0600, "top")
+	add("a/b/c.txt", 0644, "nested")
+	add("../escape", 0644, "evil")
+	add("a/../../escape2", 0644, "evil")
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := newTestFs(t)
+	if err := fs.Mkdir("dest", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.ImportZip(bytes.NewReader(buf.Bytes()), int64(buf.Len()), "dest"); err != nil {
+		t.Fatalf("ImportZip: %v", err)
+	}
+
+	for name, want := range map[string]string{"dest/top.txt": "top", "dest/a/b/c.txt": "nested"} {
+		if got := readAll(t, fs, name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	fi, err := fs.Stat("dest/top.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 || !fi.ModTime().Equal(mtime) {
+		t.Errorf("top.txt: mode %v, mtime %v", fi.Mode(), fi.ModTime())
+	}
+	for _, dir := range []string{"dest/empty", "dest/a", "dest/a/b"} {
+		if fi, err := fs.Stat(dir); err != nil || !fi.IsDir() {
+			t.Errorf("%s: %v", dir, err)
+		}
+	}
+
+	// 目录穿越的条目不会写入任何位置
+	snap, err := fs.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snap) != 2 {
+		t.Errorf("files after import = %v", snap)
+	}
+	for name := range snap {
+		if strings.Contains(name, "escape") {
+			t.Errorf("traversal entry imported as %s", name)
+		}
+	}
+}
+
+func TestBBoltFs_ImportZipSymlinkEscape(t *testing.T) {
+	zipOf := func(name, content string) []byte {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write([]byte(content))
+		if err = zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	fs := newTestFs(t)
+	_ = fs.MkdirAll("dest/in", 0755)
+	_ = fs.Mkdir("outside", 0755)
+	if err := fs.WriteString("outside/secret", "keep", 0644); err != nil {
+		t.Fatal(err)
+	}
+	_ = fs.Symlink("../outside", "dest/dir")
+	_ = fs.Symlink("../outside/secret", "dest/file")
+	_ = fs.Symlink("in", "dest/inner")
+
+	// 经 dest 下的符号链接写到 dest 之外的条目被拒绝
+	for _, name := range []string{"dir/x", "file", "dir/sub/y"} {
+		data := zipOf(name, "evil")
+		if err := fs.ImportZip(bytes.NewReader(data), int64(len(data)), "dest"); !errors.Is(err, ErrOutsideScope) {
+			t.Errorf("ImportZip(%s) = %v, want ErrOutsideScope", name, err)
+		}
+	}
+	if got := readAll(t, fs, "outside/secret"); got != "keep" {
+		t.Errorf("outside/secret = %q", got)
+	}
+	for _, name := range []string{"outside/x", "outside/sub"} {
+		if _, err := fs.Lstat(name); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s created: %v", name, err)
+		}
+	}
+
+	// 指向 dest 之内的链接照常跟随
+	data := zipOf("inner/z", "ok")
+	if err := fs.ImportZip(bytes.NewReader(data), int64(len(data)), "dest"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, fs, "dest/in/z"); got != "ok" {
+		t.Errorf("dest/in/z = %q", got)
+	}
+}